@@ -1,13 +1,19 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/oug-t/difi/internal/config"
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/export"
+	"github.com/oug-t/difi/internal/review"
 	"github.com/oug-t/difi/internal/ui"
 	"github.com/oug-t/difi/internal/vcs"
 )
@@ -17,8 +23,31 @@ var version = "dev"
 func main() {
 	showVersion := flag.Bool("version", false, "Show version")
 	plain := flag.Bool("plain", false, "Print a plain summary")
-	forceVCS := flag.String("vcs", "", "Force specific VCS (git or hg)")
+	forceVCS := flag.String("vcs", "", "Force specific VCS (git, hg or jj)")
+	interdiff := flag.Bool("interdiff", false, "Compare two versions of a branch: difi --interdiff old new")
+	interBase := flag.String("base", "", "Branch both versions of --interdiff are based on")
+	difftool := flag.Bool("difftool", false, "Show the files git difftool passes: difi --difftool $LOCAL $REMOTE [$MERGED]")
+	format := flag.String("format", "", "Output format: json, numstat or name-status with --plain; md or json for difi comments")
+	htmlOut := flag.String("html", "", "File difi export writes the HTML review to")
 	flag.Parse()
+	args := parseArgs()
+
+	// difi comments [target] prints the review comments instead of
+	// starting the TUI
+	printComments := len(args) > 0 && args[0] == "comments"
+	if printComments {
+		args = args[1:]
+	}
+
+	// difi export --html out.html [target] writes the review as a web page
+	exportReview := len(args) > 0 && args[0] == "export"
+	if exportReview {
+		args = args[1:]
+		if *htmlOut == "" {
+			fmt.Fprintln(os.Stderr, "Usage: difi export --html out.html [target]")
+			os.Exit(1)
+		}
+	}
 
 	if *showVersion {
 		fmt.Printf("difi version %s\n", version)
@@ -26,9 +55,21 @@ func main() {
 	}
 
 	var pipedDiff string
-	if stat, _ := os.Stdin.Stat(); (stat.Mode() & os.ModeCharDevice) == 0 {
+	if stat, _ := os.Stdin.Stat(); !*difftool && (stat.Mode()&os.ModeCharDevice) == 0 {
 		b, _ := io.ReadAll(os.Stdin)
 		pipedDiff = string(b)
+
+		// As core.pager, difi receives the output of every git command
+		// that pages, with GIT_PAGER_IN_USE set. Anything but a single
+		// diff, such as the patches of several commits git log -p prints,
+		// is paged as usual.
+		if os.Getenv("GIT_PAGER_IN_USE") != "" && !singleDiff(pipedDiff) {
+			if err := pageText(pipedDiff); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
 	}
 
 	// Detect or force VCS type
@@ -39,8 +80,10 @@ func main() {
 			vcsClient = vcs.GitVCS{}
 		case "hg":
 			vcsClient = vcs.HgVCS{}
+		case "jj":
+			vcsClient = vcs.JjVCS{}
 		default:
-			fmt.Fprintf(os.Stderr, "Error: unsupported VCS '%s'. Supported values: git, hg\n", *forceVCS)
+			fmt.Fprintf(os.Stderr, "Error: unsupported VCS '%s'. Supported values: git, hg, jj\n", *forceVCS)
 			os.Exit(1)
 		}
 	} else {
@@ -48,24 +91,107 @@ func main() {
 	}
 
 	target := "HEAD"
-	if flag.NArg() > 0 {
-		target = flag.Arg(0)
+	if len(args) > 0 {
+		target = args[0]
 	}
 
+	// An empty side of a range (A.. or ..B) means the current revision
+	current := "HEAD"
+
 	// For Mercurial, use "tip" as default instead of "HEAD"
-	if _, isHg := vcsClient.(vcs.HgVCS); isHg && target == "HEAD" {
-		target = "tip"
+	if _, isHg := vcsClient.(vcs.HgVCS); isHg {
+		current = "."
+		if target == "HEAD" {
+			target = "tip"
+		}
+	}
+
+	// For Jujutsu, compare the working-copy change against its parent
+	if _, isJj := vcsClient.(vcs.JjVCS); isJj {
+		current = "@"
+		if target == "HEAD" {
+			target = "@-"
+		}
 	}
 
-	if *plain && pipedDiff == "" {
-		// Use VCS-specific commands for plain output
-		files, err := vcsClient.ListChangedFiles(target)
+	rng := vcs.Range{Base: target}
+	if *interdiff {
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "Usage: difi --interdiff old new [--base branch]")
+			os.Exit(1)
+		}
+		text, err := vcs.Interdiff(vcsClient, args[0], args[1], *interBase)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error listing changed files: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		for _, file := range files {
-			fmt.Println(file)
+		if text == "" {
+			fmt.Printf("%s and %s make the same changes\n", args[0], args[1])
+			os.Exit(0)
+		}
+		pipedDiff = text
+		rng = vcs.Range{Base: args[0], Head: args[1]}
+	} else if *difftool {
+		if len(args) < 2 || len(args) > 3 {
+			fmt.Fprintln(os.Stderr, "Usage: difi --difftool $LOCAL $REMOTE [$MERGED]")
+			os.Exit(1)
+		}
+		merged := ""
+		if len(args) == 3 {
+			merged = args[2]
+		}
+		text, err := vcs.Difftool(args[0], args[1], merged)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if text == "" {
+			fmt.Println("No differences")
+			os.Exit(0)
+		}
+		pipedDiff = text
+	} else if pipedDiff == "" {
+		var err error
+		rng, err = vcs.ResolveRange(vcsClient, target, current)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if printComments {
+		target := review.Target(rng, pipedDiff)
+		comments := review.LoadComments(vcsClient.GetStateDir(), target).List()
+		switch *format {
+		case "", "md":
+			fmt.Print(review.Markdown(target, comments))
+		case "json":
+			out, err := review.JSON(target, comments)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Stdout.Write(out)
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unsupported format '%s'. Supported values: md, json\n", *format)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if exportReview {
+		if err := exportHTML(vcsClient, rng, pipedDiff, *htmlOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %s\n", *htmlOut)
+		os.Exit(0)
+	}
+
+	if *plain {
+		if err := printPlain(vcsClient, rng, pipedDiff, *format); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
 		os.Exit(0)
 	}
@@ -79,9 +205,147 @@ func main() {
 		}
 	}
 
-	p := tea.NewProgram(ui.NewModel(cfg, target, pipedDiff, vcsClient), opts...)
-	if _, err := p.Run(); err != nil {
+	p := tea.NewProgram(ui.NewModel(cfg, rng, pipedDiff, vcsClient), opts...)
+	final, err := p.Run()
+	if m, ok := final.(ui.Model); ok {
+		m.Close()
+	}
+	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// printPlain prints the changed files one per line or, given a format, as
+// JSON or in the style of git diff --numstat or --name-status.
+func printPlain(client vcs.VCS, rng vcs.Range, pipedDiff, format string) error {
+	if format == "" {
+		files := diff.Paths(diff.Parse(pipedDiff))
+		if pipedDiff == "" {
+			var err error
+			if files, err = client.ListChangedFiles(rng); err != nil {
+				return fmt.Errorf("listing changed files: %w", err)
+			}
+		}
+		for _, file := range files {
+			fmt.Println(file)
+		}
+		return nil
+	}
+
+	if format != "json" && format != "numstat" && format != "name-status" {
+		return fmt.Errorf("unsupported format '%s'. Supported values: json, numstat, name-status", format)
+	}
+	reports := vcs.ReportDiff(pipedDiff)
+	if pipedDiff == "" {
+		var err error
+		if reports, err = vcs.Report(client, rng); err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case "json":
+		if reports == nil {
+			reports = []vcs.FileReport{}
+		}
+		out, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	case "numstat":
+		for _, r := range reports {
+			fmt.Println(r.Numstat())
+		}
+	case "name-status":
+		for _, r := range reports {
+			fmt.Println(r.NameStatus())
+		}
+	}
+	return nil
+}
+
+// exportHTML writes the diff of rng, or the piped diff, to path as an HTML
+// page, along with the review comments and viewed files saved for it.
+func exportHTML(client vcs.VCS, rng vcs.Range, pipedDiff, path string) error {
+	rv := export.Review{Title: "Review of " + rng.String()}
+	var hashes map[string]string
+	if pipedDiff != "" {
+		rv.Title = "Review of piped diff"
+		rv.Files = diff.Parse(pipedDiff)
+		hashes = review.FileHashes(pipedDiff)
+	} else {
+		var err error
+		if rv.Files, err = vcs.Files(client, rng); err != nil {
+			return err
+		}
+		if rv.Stats, err = client.DiffStatsByFile(rng); err != nil {
+			return err
+		}
+		if hashes, err = review.DiffHashes(client, rng, diff.Paths(rv.Files)); err != nil {
+			return err
+		}
+	}
+
+	stateDir := client.GetStateDir()
+	for _, c := range review.LoadComments(stateDir, review.Target(rng, pipedDiff)).List() {
+		// Comments made while stepping through commits are left out
+		if c.Commit == "" {
+			rv.Comments = append(rv.Comments, c)
+		}
+	}
+	viewed := review.LoadViewed(stateDir)
+	rv.Viewed = make(map[string]bool)
+	for p, h := range hashes {
+		if viewed.IsViewed(p, h) {
+			rv.Viewed[p] = true
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := export.HTML(f, rv); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// singleDiff reports whether text is a diff that changes each file once.
+// The tree lists a file once, so a series of diffs touching the same file
+// cannot be shown.
+func singleDiff(text string) bool {
+	files := diff.Parse(text)
+	return len(files) > 0 && len(diff.Paths(files)) == len(files)
+}
+
+// pageText shows text the way git's default pager would, or prints it
+// when less is not installed.
+func pageText(text string) error {
+	if text == "" {
+		return nil
+	}
+	less, err := exec.LookPath("less")
+	if err != nil {
+		_, err = io.WriteString(os.Stdout, text)
+		return err
+	}
+	cmd := exec.Command(less, "-R")
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// parseArgs returns the positional arguments, parsing flags that follow
+// them as in "difi --interdiff old new --base main".
+func parseArgs() []string {
+	var args []string
+	for flag.NArg() > 0 {
+		args = append(args, flag.Arg(0))
+		_ = flag.CommandLine.Parse(flag.Args()[1:])
+	}
+	return args
+}
@@ -8,8 +8,9 @@ import (
 )
 
 type Config struct {
-	Editor string   `yaml:"editor"`
-	UI     UIConfig `yaml:"ui"`
+	Editor       string   `yaml:"editor"`
+	ContextLines int      `yaml:"context_lines"`
+	UI           UIConfig `yaml:"ui"`
 }
 
 type UIConfig struct {
@@ -17,13 +18,17 @@ type UIConfig struct {
 	Theme       string `yaml:"theme"`
 	DiffAddBg   string `yaml:"diff_add_bg"`
 	DiffDelBg   string `yaml:"diff_del_bg"`
+	SideBySide  bool   `yaml:"side_by_side"`
+	InlineDiff  string `yaml:"inline_diff"`
 }
 
 func Load() Config {
 	cfg := Config{
+		ContextLines: 3,
 		UI: UIConfig{
 			LineNumbers: "hybrid",
 			Theme:       "default",
+			InlineDiff:  "word",
 		},
 	}
 
@@ -34,6 +39,10 @@ func Load() Config {
 		_ = yaml.Unmarshal(data, &cfg)
 	}
 
+	if cfg.ContextLines < 0 {
+		cfg.ContextLines = 3
+	}
+
 	if cfg.Editor == "" {
 		cfg.Editor = os.Getenv("DIFI_EDITOR")
 	}
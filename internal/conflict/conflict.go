@@ -0,0 +1,202 @@
+// Package conflict splits a file left with merge conflict markers into the
+// text both sides agree on and the conflicts between them, and writes it
+// back once a side has been picked for every conflict.
+package conflict
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Marker lines, as written by git, hg and diff3. The diff3 and zdiff3
+// styles add the common ancestor after a "|||||||" line.
+const (
+	oursMarker   = "<<<<<<<"
+	baseMarker   = "|||||||"
+	sepMarker    = "======="
+	theirsMarker = ">>>>>>>"
+)
+
+// Choice is how a conflict is resolved.
+type Choice int
+
+const (
+	Unresolved Choice = iota
+	Ours              // keep our side
+	Theirs            // keep their side
+	Both              // keep ours followed by theirs
+)
+
+func (c Choice) String() string {
+	switch c {
+	case Ours:
+		return "ours"
+	case Theirs:
+		return "theirs"
+	case Both:
+		return "both"
+	}
+	return "unresolved"
+}
+
+// Region is a run of lines of a conflicted file: text outside any conflict,
+// or one conflict with the lines of each side.
+type Region struct {
+	Conflict bool
+	Lines    []string // text of a region outside any conflict
+
+	Ours, Base, Theirs []string
+	OursLabel          string // name after the markers, such as HEAD
+	BaseLabel          string
+	TheirsLabel        string
+	HasBase            bool // the markers include the common ancestor
+
+	// Start is the 1-based line of the region in the file, its opening
+	// marker for a conflict.
+	Start  int
+	Choice Choice
+}
+
+// File is a conflicted file split into regions.
+type File struct {
+	Regions []*Region
+
+	// newline reports whether the file ends with a newline.
+	newline bool
+}
+
+// Parse splits content into regions. It fails on markers that do not nest
+// the way conflict markers do, such as a separator outside a conflict.
+func Parse(content string) (*File, error) {
+	f := &File{newline: strings.HasSuffix(content, "\n")}
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	const (
+		outside = iota
+		inOurs
+		inBase
+		inTheirs
+	)
+	state := outside
+	var text, cur *Region
+	for i, line := range lines {
+		no := i + 1
+		switch {
+		case isMarker(line, oursMarker) && state == outside:
+			text = nil
+			cur = &Region{Conflict: true, OursLabel: label(line), Start: no}
+			f.Regions = append(f.Regions, cur)
+			state = inOurs
+		case isMarker(line, baseMarker) && state == inOurs:
+			cur.HasBase = true
+			cur.BaseLabel = label(line)
+			state = inBase
+		case isMarker(line, sepMarker) && (state == inOurs || state == inBase):
+			state = inTheirs
+		case isMarker(line, theirsMarker) && state == inTheirs:
+			cur.TheirsLabel = label(line)
+			cur = nil
+			state = outside
+		case state == outside:
+			if isMarker(line, baseMarker) || isMarker(line, sepMarker) || isMarker(line, theirsMarker) {
+				return nil, fmt.Errorf("line %d: conflict marker outside a conflict", no)
+			}
+			if text == nil {
+				text = &Region{Start: no}
+				f.Regions = append(f.Regions, text)
+			}
+			text.Lines = append(text.Lines, line)
+		case state == inOurs:
+			cur.Ours = append(cur.Ours, line)
+		case state == inBase:
+			cur.Base = append(cur.Base, line)
+		case state == inTheirs:
+			cur.Theirs = append(cur.Theirs, line)
+		}
+	}
+	if state != outside {
+		return nil, fmt.Errorf("conflict at line %d is not closed", cur.Start)
+	}
+	return f, nil
+}
+
+// isMarker reports whether line is a conflict marker of the given kind:
+// the marker alone, or followed by a space and a label.
+func isMarker(line, marker string) bool {
+	return line == marker || strings.HasPrefix(line, marker+" ")
+}
+
+func label(line string) string {
+	return strings.TrimSpace(line[len(oursMarker):])
+}
+
+// Conflicts returns the conflict regions in file order.
+func (f *File) Conflicts() []*Region {
+	var conflicts []*Region
+	for _, r := range f.Regions {
+		if r.Conflict {
+			conflicts = append(conflicts, r)
+		}
+	}
+	return conflicts
+}
+
+// Unresolved counts the conflicts without a choice.
+func (f *File) Unresolved() int {
+	n := 0
+	for _, r := range f.Conflicts() {
+		if r.Choice == Unresolved {
+			n++
+		}
+	}
+	return n
+}
+
+// Result returns the lines a region stands for once resolved. An
+// unresolved conflict keeps its markers.
+func (r *Region) Result() []string {
+	if !r.Conflict {
+		return r.Lines
+	}
+	switch r.Choice {
+	case Ours:
+		return r.Ours
+	case Theirs:
+		return r.Theirs
+	case Both:
+		return append(append([]string{}, r.Ours...), r.Theirs...)
+	}
+	lines := []string{withLabel(oursMarker, r.OursLabel)}
+	lines = append(lines, r.Ours...)
+	if r.HasBase {
+		lines = append(lines, withLabel(baseMarker, r.BaseLabel))
+		lines = append(lines, r.Base...)
+	}
+	lines = append(lines, sepMarker)
+	lines = append(lines, r.Theirs...)
+	return append(lines, withLabel(theirsMarker, r.TheirsLabel))
+}
+
+func withLabel(marker, label string) string {
+	if label == "" {
+		return marker
+	}
+	return marker + " " + label
+}
+
+// String returns the content of the file with every resolved conflict
+// replaced by the side chosen for it.
+func (f *File) String() string {
+	var lines []string
+	for _, r := range f.Regions {
+		lines = append(lines, r.Result()...)
+	}
+	s := strings.Join(lines, "\n")
+	if f.newline && len(lines) > 0 {
+		s += "\n"
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package conflict
+
+import (
+	"reflect"
+	"testing"
+)
+
+const conflicted = `package main
+<<<<<<< HEAD
+func a() int { return 1 }
+=======
+func a() int { return 2 }
+>>>>>>> feature
+shared
+<<<<<<< ours
+x
+||||||| base
+w
+=======
+y
+z
+>>>>>>> theirs
+end
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse(conflicted)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(f.Regions) != 5 {
+		t.Fatalf("got %d regions, want 5", len(f.Regions))
+	}
+
+	conflicts := f.Conflicts()
+	if len(conflicts) != 2 || f.Unresolved() != 2 {
+		t.Fatalf("got %d conflicts, %d unresolved", len(conflicts), f.Unresolved())
+	}
+	first, second := conflicts[0], conflicts[1]
+	if first.Start != 2 || first.OursLabel != "HEAD" || first.TheirsLabel != "feature" || first.HasBase {
+		t.Errorf("first conflict: %+v", first)
+	}
+	if !reflect.DeepEqual(first.Ours, []string{"func a() int { return 1 }"}) ||
+		!reflect.DeepEqual(first.Theirs, []string{"func a() int { return 2 }"}) {
+		t.Errorf("first conflict sides: %q / %q", first.Ours, first.Theirs)
+	}
+	if !second.HasBase || second.BaseLabel != "base" || !reflect.DeepEqual(second.Base, []string{"w"}) ||
+		!reflect.DeepEqual(second.Theirs, []string{"y", "z"}) {
+		t.Errorf("second conflict: %+v", second)
+	}
+	if text := f.Regions[2]; text.Conflict || text.Start != 7 || !reflect.DeepEqual(text.Lines, []string{"shared"}) {
+		t.Errorf("text between conflicts: %+v", text)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	f, err := Parse(conflicted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.String(); got != conflicted {
+		t.Errorf("unresolved file should round-trip, got:\n%s", got)
+	}
+
+	conflicts := f.Conflicts()
+	conflicts[0].Choice = Theirs
+	conflicts[1].Choice = Both
+	want := "package main\nfunc a() int { return 2 }\nshared\nx\ny\nz\nend\n"
+	if got := f.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if f.Unresolved() != 0 {
+		t.Errorf("Unresolved() = %d, want 0", f.Unresolved())
+	}
+
+	conflicts[1].Choice = Ours
+	want = "package main\nfunc a() int { return 2 }\nshared\nx\nend\n"
+	if got := f.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, content := range []string{
+		"a\n=======\nb\n",
+		"<<<<<<< HEAD\na\n=======\nb\n",
+		"a\n>>>>>>> x\n",
+	} {
+		if _, err := Parse(content); err == nil {
+			t.Errorf("Parse(%q) should fail", content)
+		}
+	}
+}
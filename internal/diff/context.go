@@ -0,0 +1,116 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Hidden returns the number of unchanged lines between hunk i and the one
+// before it, or the start of the file for the first hunk.
+func (f *File) Hidden(i int) int {
+	end := 0
+	if i > 0 {
+		prev := f.Hunks[i-1]
+		end = firstLine(prev.NewStart, prev.NewLines) + prev.NewLines - 1
+	}
+	h := f.Hunks[i]
+	return max(firstLine(h.NewStart, h.NewLines)-end-1, 0)
+}
+
+// NewRange returns the first and last line of hunk i in the new file. The
+// last line is first-1 for a hunk that only deletes.
+func (f *File) NewRange(i int) (first, last int) {
+	h := f.Hunks[i]
+	first = firstLine(h.NewStart, h.NewLines)
+	return first, first + h.NewLines - 1
+}
+
+// Expand returns a copy of f whose hunks also show the unchanged lines
+// shown accepts, read from content, the text of the new side. Lines are
+// numbered from 1 in the new file. Hunks that are no longer separated by a
+// hidden line merge into one.
+func (f *File) Expand(content string, shown func(newLine int) bool) *File {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+	noNewline := content != "" && !strings.HasSuffix(content, "\n")
+
+	out := *f
+	out.Hunks = nil
+	var cur *Hunk
+	// gap adds the unchanged new lines from..to, whose old line numbers
+	// are delta away.
+	gap := func(from, to, delta int) {
+		for n := from; n <= to && n <= len(lines); n++ {
+			if !shown(n) {
+				cur = nil
+				continue
+			}
+			if cur == nil {
+				cur = &Hunk{index: -1}
+				out.Hunks = append(out.Hunks, cur)
+			}
+			cur.Lines = append(cur.Lines, Line{
+				Kind:      Context,
+				Content:   lines[n-1],
+				OldLine:   n + delta,
+				NewLine:   n,
+				NoNewline: noNewline && n == len(lines),
+				index:     -1,
+			})
+		}
+	}
+
+	next := 1
+	for i, h := range f.Hunks {
+		first, last := f.NewRange(i)
+		gap(next, first-1, firstLine(h.OldStart, h.OldLines)-first)
+		if cur == nil {
+			cur = &Hunk{OldStart: h.OldStart, NewStart: h.NewStart, Section: h.Section, index: h.index}
+			out.Hunks = append(out.Hunks, cur)
+		}
+		cur.Lines = append(cur.Lines, h.Lines...)
+		next = last + 1
+	}
+	if n := len(f.Hunks); n > 0 {
+		h := f.Hunks[n-1]
+		gap(next, len(lines), firstLine(h.OldStart, h.OldLines)+h.OldLines-next)
+	}
+
+	for _, h := range out.Hunks {
+		h.recount()
+	}
+	return &out
+}
+
+// recount sets the ranges and header of a hunk from its lines. A side
+// without lines keeps its start, which points at the line before the hunk.
+func (h *Hunk) recount() {
+	h.OldLines, h.NewLines = 0, 0
+	oldStart, newStart := 0, 0
+	for _, l := range h.Lines {
+		if l.OldLine > 0 {
+			h.OldLines++
+			if oldStart == 0 {
+				oldStart = l.OldLine
+			}
+		}
+		if l.NewLine > 0 {
+			h.NewLines++
+			if newStart == 0 {
+				newStart = l.NewLine
+			}
+		}
+	}
+	if oldStart > 0 {
+		h.OldStart = oldStart
+	}
+	if newStart > 0 {
+		h.NewStart = newStart
+	}
+	h.Header = fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+	if h.Section != "" {
+		h.Header += " " + h.Section
+	}
+}
@@ -0,0 +1,113 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// twoHunks changes lines 3 and 12 of a 15-line file and adds a line after
+// line 12, so the new file has 16 lines.
+const twoHunks = `diff --git a/f.txt b/f.txt
+--- a/f.txt
++++ b/f.txt
+@@ -2,3 +2,3 @@ func a()
+ 2
+-3
++three
+ 4
+@@ -11,3 +11,4 @@ func b()
+ 11
+-12
++twelve
++twelve and a half
+ 13
+`
+
+func numbered(from, to int) string {
+	var b strings.Builder
+	for n := from; n <= to; n++ {
+		switch n {
+		case 3:
+			b.WriteString("three\n")
+		case 12:
+			b.WriteString("twelve\ntwelve and a half\n")
+		default:
+			fmt.Fprintf(&b, "%d\n", n)
+		}
+	}
+	return b.String()
+}
+
+func TestHidden(t *testing.T) {
+	f := Parse(twoHunks)[0]
+	if got := f.Hidden(0); got != 1 {
+		t.Errorf("Hidden(0) = %d, want 1", got)
+	}
+	if got := f.Hidden(1); got != 6 {
+		t.Errorf("Hidden(1) = %d, want 6", got)
+	}
+	if first, last := f.NewRange(1); first != 11 || last != 14 {
+		t.Errorf("NewRange(1) = %d, %d, want 11, 14", first, last)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	f := Parse(twoHunks)[0]
+	content := numbered(1, 15)
+
+	// Three lines above the second hunk and the line after it.
+	shown := map[int]bool{8: true, 9: true, 10: true, 15: true}
+	e := f.Expand(content, func(n int) bool { return shown[n] })
+	if len(e.Hunks) != 2 {
+		t.Fatalf("got %d hunks, want 2", len(e.Hunks))
+	}
+	h := e.Hunks[1]
+	if h.Header != "@@ -8,7 +8,8 @@" {
+		t.Errorf("header = %q", h.Header)
+	}
+	if first := h.Lines[0]; first.Kind != Context || first.Content != "8" || first.OldLine != 8 || first.NewLine != 8 {
+		t.Errorf("first line = %+v", first)
+	}
+	if last := h.Lines[len(h.Lines)-1]; last.Content != "14" || last.OldLine != 14 || last.NewLine != 15 {
+		t.Errorf("last line = %+v", last)
+	}
+	if e.Hidden(1) != 3 {
+		t.Errorf("Hidden(1) = %d, want 3", e.Hidden(1))
+	}
+	if f.Hunks[1].Header != "@@ -11,3 +11,4 @@ func b()" {
+		t.Errorf("Expand changed the original file: %q", f.Hunks[1].Header)
+	}
+
+	// Revealing the whole file merges the hunks.
+	e = f.Expand(content, func(int) bool { return true })
+	if len(e.Hunks) != 1 {
+		t.Fatalf("got %d hunks, want 1", len(e.Hunks))
+	}
+	if h := e.Hunks[0]; h.Header != "@@ -1,15 +1,16 @@" || len(h.Lines) != 18 {
+		t.Errorf("whole file: %q with %d lines", h.Header, len(h.Lines))
+	}
+	if e.Hidden(0) != 0 {
+		t.Errorf("Hidden(0) = %d, want 0", e.Hidden(0))
+	}
+}
+
+func TestExpandPatch(t *testing.T) {
+	f := Parse(twoHunks)[0]
+	e := f.Expand(numbered(1, 15), func(n int) bool { return n >= 5 && n <= 10 })
+	patch := e.Patch(func(Line) bool { return true }, false)
+	want := "@@ -2,12 +2,13 @@\n 2\n-3\n+three\n 4\n 5\n"
+	if !strings.Contains(patch, want) {
+		t.Errorf("patch does not start with the merged hunk:\n%s", patch)
+	}
+}
+
+func TestExpandNoNewline(t *testing.T) {
+	f := Parse(twoHunks)[0]
+	content := strings.TrimSuffix(numbered(1, 15), "\n")
+	e := f.Expand(content, func(n int) bool { return n == 16 })
+	h := e.Hunks[len(e.Hunks)-1]
+	if last := h.Lines[len(h.Lines)-1]; last.Content != "15" || !last.NoNewline {
+		t.Errorf("last line = %+v, want 15 without a newline", last)
+	}
+}
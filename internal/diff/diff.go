@@ -0,0 +1,681 @@
+// Package diff parses unified diffs (git, hg, svn and plain diff -u output)
+// into typed files, hunks and lines so that every backend and the UI agree
+// on paths and line numbers.
+package diff
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ansiRe = regexp.MustCompile("[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-Z\\d]*)*)?\u0007)|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PRZcf-ntqry=><~]))")
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// combinedHeaderRe matches the hunk header of a combined diff, one "-"
+// range per parent: "@@@ -1,5 -1,4 +1,7 @@@".
+var combinedHeaderRe = regexp.MustCompile(`^(@@@+) ((?:-\d+(?:,\d+)? )+)\+(\d+)(?:,(\d+))? @@@+ ?(.*)$`)
+
+// Kind identifies what a Line represents.
+type Kind int
+
+const (
+	Context Kind = iota
+	Added
+	Deleted
+	HunkHeader
+)
+
+// Line is a single row of a hunk. OldLine and NewLine are 1-based and zero
+// when the line does not exist on that side.
+type Line struct {
+	Kind      Kind
+	Content   string // text without the leading marker; the full header for HunkHeader
+	OldLine   int
+	NewLine   int
+	NoNewline bool // followed by "\ No newline at end of file"
+
+	anchor int // new-file line a deletion or hunk header sits after
+	after  int // old-file line an addition sits after
+	index  int // line index in the parsed text
+}
+
+// Hunk is one "@@ -a,b +c,d @@" block.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Section            string // function context after the closing @@
+	Header             string
+	Lines              []Line
+
+	index int
+}
+
+// File is the diff of a single path.
+type File struct {
+	OldPath string // empty when the file did not exist before
+	NewPath string // empty when the file was deleted
+	Header  []string
+
+	OldMode     string
+	NewMode     string
+	NewFile     bool
+	DeletedFile bool
+	Binary      bool
+	Copied      bool // NewPath is a copy of OldPath, which still exists
+	Similarity  int  // percent of a rename or copy; 0 when not scored
+
+	// Parents is the number of parents of a combined diff (diff --cc) of
+	// a merge, whose old side is the first parent; 0 for other diffs.
+	Parents int
+
+	Hunks []*Hunk
+	Raw   string // original text of this section, color codes included
+
+	start, end int
+	onlyIn     string // path of an "Only in" line of diff -r
+}
+
+// StripANSI removes terminal escape sequences from s.
+func StripANSI(s string) string {
+	return ansiRe.ReplaceAllString(s, "")
+}
+
+// String renders the line back into unified diff form.
+func (l Line) String() string {
+	switch l.Kind {
+	case Added:
+		return "+" + l.Content
+	case Deleted:
+		return "-" + l.Content
+	case HunkHeader:
+		return l.Content
+	default:
+		return " " + l.Content
+	}
+}
+
+// FileLine returns the line in the new file an editor should jump to.
+// Deleted lines and hunk headers map to the new-file line just before them.
+func (l Line) FileLine() int {
+	switch l.Kind {
+	case Added, Context:
+		return l.NewLine
+	default:
+		return l.anchor
+	}
+}
+
+// HeaderLine returns the hunk header as a Line for flattened display.
+func (h *Hunk) HeaderLine() Line {
+	return Line{
+		Kind:    HunkHeader,
+		Content: h.Header,
+		OldLine: h.OldStart,
+		NewLine: h.NewStart,
+		anchor:  h.NewStart - 1,
+		index:   h.index,
+	}
+}
+
+// Path returns the path the file is known by after the change.
+func (f *File) Path() string {
+	if f.NewPath != "" {
+		return f.NewPath
+	}
+	return f.OldPath
+}
+
+// Renamed reports whether the file moved from OldPath to NewPath.
+func (f *File) Renamed() bool {
+	return !f.Copied && f.OldPath != "" && f.NewPath != "" && f.OldPath != f.NewPath
+}
+
+// ModeChanged reports whether the file mode changed, such as the executable
+// bit or a file turning into a symlink.
+func (f *File) ModeChanged() bool {
+	return f.OldMode != "" && f.NewMode != "" && f.OldMode != f.NewMode
+}
+
+// Symlink reports whether either side of the file is a symbolic link, whose
+// diff lines are the link targets.
+func (f *File) Symlink() bool {
+	return f.OldMode == symlinkMode || f.NewMode == symlinkMode
+}
+
+const symlinkMode = "120000"
+
+// Stats counts added and deleted lines.
+func (f *File) Stats() (added, deleted int) {
+	for _, h := range f.Hunks {
+		for _, l := range h.Lines {
+			switch l.Kind {
+			case Added:
+				added++
+			case Deleted:
+				deleted++
+			}
+		}
+	}
+	return added, deleted
+}
+
+// Rows flattens the hunks into display rows, each hunk preceded by its header.
+func (f *File) Rows() []Line {
+	var rows []Line
+	for _, h := range f.Hunks {
+		rows = append(rows, h.HeaderLine())
+		rows = append(rows, h.Lines...)
+	}
+	return rows
+}
+
+// Paths lists the file paths in order of appearance without duplicates.
+func Paths(files []*File) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, f := range files {
+		p := f.Path()
+		if p != "" && !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// Find returns the first file whose old or new path equals path.
+func Find(files []*File, path string) *File {
+	if path == "" {
+		return nil
+	}
+	for _, f := range files {
+		if f.Path() == path {
+			return f
+		}
+	}
+	for _, f := range files {
+		if f.OldPath == path {
+			return f
+		}
+	}
+	return nil
+}
+
+// Extract returns the section of text that diffs path, or "".
+func Extract(text, path string) string {
+	if f := Find(Parse(text), path); f != nil {
+		return f.Raw
+	}
+	return ""
+}
+
+// FileLine maps a line index of a raw diff text to a new-file line number.
+// It returns 0 when index is out of range and 1 when it precedes any hunk.
+func FileLine(text string, index int) int {
+	if index < 0 || index >= strings.Count(text, "\n")+1 {
+		return 0
+	}
+	for _, f := range Parse(text) {
+		if index < f.start || index >= f.end {
+			continue
+		}
+		line := 1
+		for _, h := range f.Hunks {
+			if h.index > index {
+				break
+			}
+			line = h.HeaderLine().FileLine()
+			for _, l := range h.Lines {
+				if l.index > index {
+					break
+				}
+				line = l.FileLine()
+			}
+		}
+		return line
+	}
+	return 1
+}
+
+type parser struct {
+	raw    []string
+	format Format
+	files  []*File
+	file   *File
+	hunk   *Hunk
+
+	// oldRoot and newRoot are the directories diff -r compared.
+	oldRoot, newRoot string
+
+	oldLeft, newLeft int
+	oldNo, newNo     int
+}
+
+// Parse splits a unified diff into files, reading its headers the way the
+// format Sniff detects calls for. Color codes are ignored.
+func Parse(text string) []*File {
+	if text == "" {
+		return nil
+	}
+	p := &parser{raw: strings.Split(text, "\n"), format: Sniff(text)}
+	for i := range p.raw {
+		p.line(i)
+	}
+	p.finish(len(p.raw))
+	p.resolveOnlyIn()
+	return p.files
+}
+
+func (p *parser) line(i int) {
+	line := StripANSI(p.raw[i])
+
+	if p.hunk != nil && p.file.Parents > 0 {
+		if p.combinedLine(line, i) {
+			return
+		}
+		p.hunk = nil
+	} else if p.hunk != nil && (p.oldLeft > 0 || p.newLeft > 0) {
+		if p.hunkLine(line, i) {
+			return
+		}
+		p.hunk = nil
+	}
+
+	switch {
+	case strings.HasPrefix(line, `\`):
+		if p.hunk != nil && len(p.hunk.Lines) > 0 {
+			p.hunk.Lines[len(p.hunk.Lines)-1].NoNewline = true
+		}
+
+	case strings.HasPrefix(line, "diff --git "):
+		p.begin(i)
+		p.file.OldPath, p.file.NewPath = parseGitPaths(strings.TrimPrefix(line, "diff --git "))
+		p.file.Header = append(p.file.Header, line)
+
+	case strings.HasPrefix(line, "diff --cc "), strings.HasPrefix(line, "diff --combined "):
+		p.begin(i)
+		_, path, _ := strings.Cut(line[len("diff --"):], " ")
+		p.file.OldPath, p.file.NewPath = unquote(path), unquote(path)
+		p.file.Parents = 2
+		p.file.Header = append(p.file.Header, line)
+
+	case strings.HasPrefix(line, "diff "):
+		p.begin(i)
+		fields := strings.Fields(line)
+		path := trimPrefixDir(fields[len(fields)-1])
+		p.file.OldPath, p.file.NewPath = path, path
+		if n := len(fields); p.format == FormatUnified && n >= 3 && !strings.HasPrefix(fields[n-2], "-") {
+			// diff -r names the file in both directories.
+			p.file.OldPath, p.file.NewPath = fields[n-2], fields[n-1]
+		}
+		p.file.Header = append(p.file.Header, line)
+
+	case p.format == FormatSvn && strings.HasPrefix(line, "Index: ") && p.next(i, "===="):
+		p.begin(i)
+		path := strings.TrimSpace(strings.TrimPrefix(line, "Index: "))
+		p.file.OldPath, p.file.NewPath = path, path
+		p.file.Header = append(p.file.Header, line)
+
+	case p.format == FormatUnified && strings.HasPrefix(line, "Binary files ") && !p.inDiffHeader():
+		// diff -r reports binary files without a "diff" line.
+		p.begin(i)
+		names := strings.TrimSuffix(strings.TrimPrefix(line, "Binary files "), " differ")
+		p.file.OldPath, p.file.NewPath, _ = strings.Cut(names, " and ")
+		p.headerLine(line)
+
+	case p.format == FormatUnified && strings.HasPrefix(line, "Only in "):
+		p.begin(i)
+		dir, name, _ := strings.Cut(strings.TrimPrefix(line, "Only in "), ": ")
+		p.file.onlyIn = strings.TrimSuffix(dir, "/") + "/" + name
+		p.file.Header = append(p.file.Header, line)
+
+	case strings.HasPrefix(line, "--- ") && p.startsHeaderless(i):
+		p.begin(i)
+		p.file.OldPath = parseMarkerPath(line[4:])
+		p.file.Header = append(p.file.Header, line)
+
+	case p.file == nil:
+		// Preamble such as commit messages before the first file.
+
+	case strings.HasPrefix(line, "--- ") && len(p.file.Hunks) == 0:
+		p.file.OldPath = parseMarkerPath(line[4:])
+		p.file.NewFile = p.file.NewFile || p.file.OldPath == ""
+		p.file.Header = append(p.file.Header, line)
+
+	case strings.HasPrefix(line, "+++ ") && len(p.file.Hunks) == 0:
+		p.file.NewPath = parseMarkerPath(line[4:])
+		p.file.DeletedFile = p.file.DeletedFile || p.file.NewPath == ""
+		p.file.Header = append(p.file.Header, line)
+
+	case strings.HasPrefix(line, "@@ "):
+		p.beginHunk(line, i)
+
+	case strings.HasPrefix(line, "@@@") && p.file.Parents > 0:
+		p.beginCombinedHunk(line, i)
+
+	case len(p.file.Hunks) == 0:
+		p.headerLine(line)
+	}
+}
+
+// startsHeaderless reports whether a "---" line opens a new file in a diff
+// without "diff" command lines, as produced by plain diff -u.
+func (p *parser) startsHeaderless(i int) bool {
+	if !p.next(i, "+++ ") {
+		return false
+	}
+	return p.file == nil || len(p.file.Hunks) > 0
+}
+
+// inDiffHeader reports whether the current file was opened by a "diff" line
+// and has no content yet.
+func (p *parser) inDiffHeader() bool {
+	f := p.file
+	return f != nil && len(f.Hunks) == 0 && !f.Binary && f.onlyIn == "" &&
+		len(f.Header) > 0 && strings.HasPrefix(f.Header[0], "diff ")
+}
+
+// next reports whether the line after i starts with prefix.
+func (p *parser) next(i int, prefix string) bool {
+	return i+1 < len(p.raw) && strings.HasPrefix(StripANSI(p.raw[i+1]), prefix)
+}
+
+func (p *parser) headerLine(line string) {
+	f := p.file
+	f.Header = append(f.Header, line)
+	switch {
+	case strings.HasPrefix(line, "new file mode "):
+		f.NewFile = true
+		f.NewMode = strings.TrimPrefix(line, "new file mode ")
+	case strings.HasPrefix(line, "deleted file mode "):
+		f.DeletedFile = true
+		f.OldMode = strings.TrimPrefix(line, "deleted file mode ")
+	case strings.HasPrefix(line, "old mode "):
+		f.OldMode = strings.TrimPrefix(line, "old mode ")
+	case strings.HasPrefix(line, "new mode "):
+		f.NewMode = strings.TrimPrefix(line, "new mode ")
+	case strings.HasPrefix(line, "index ") && f.OldMode == "" && f.NewMode == "":
+		// An unchanged mode is only given on the index line.
+		if fields := strings.Fields(line); len(fields) == 3 {
+			f.OldMode, f.NewMode = fields[2], fields[2]
+		}
+	case strings.HasPrefix(line, "similarity index "):
+		f.Similarity = atoi(strings.TrimSuffix(strings.TrimPrefix(line, "similarity index "), "%"), 0)
+	case strings.HasPrefix(line, "rename from "):
+		f.OldPath = unquote(strings.TrimPrefix(line, "rename from "))
+	case strings.HasPrefix(line, "rename to "):
+		f.NewPath = unquote(strings.TrimPrefix(line, "rename to "))
+	case strings.HasPrefix(line, "copy from "):
+		f.OldPath = unquote(strings.TrimPrefix(line, "copy from "))
+		f.Copied = true
+	case strings.HasPrefix(line, "copy to "):
+		f.NewPath = unquote(strings.TrimPrefix(line, "copy to "))
+		f.Copied = true
+	case strings.HasPrefix(line, "Binary files "), strings.HasPrefix(line, "GIT binary patch"),
+		strings.HasPrefix(line, "Cannot display: file marked as a binary type"):
+		f.Binary = true
+	}
+}
+
+func (p *parser) begin(i int) {
+	p.finish(i)
+	p.file = &File{start: i}
+	p.files = append(p.files, p.file)
+}
+
+func (p *parser) finish(i int) {
+	if p.file != nil {
+		p.file.end = i
+		p.file.Raw = strings.Join(p.raw[p.file.start:i], "\n")
+		if p.format == FormatUnified {
+			p.unified(p.file)
+		}
+		if p.file.NewFile {
+			p.file.OldPath = ""
+		}
+		if p.file.DeletedFile {
+			p.file.NewPath = ""
+		}
+	}
+	p.file = nil
+	p.hunk = nil
+}
+
+// unified fills in what plain diff leaves implicit: the path below the
+// directories diff -r compared, and the empty side diff -N stands in for a
+// missing file with.
+func (p *parser) unified(f *File) {
+	if f.OldPath != "" && f.NewPath != "" && f.OldPath != f.NewPath {
+		if rel := commonSuffix(f.OldPath, f.NewPath); rel != "" {
+			if p.oldRoot == "" && rel != f.OldPath && rel != f.NewPath {
+				p.oldRoot = strings.TrimSuffix(f.OldPath, "/"+rel)
+				p.newRoot = strings.TrimSuffix(f.NewPath, "/"+rel)
+			}
+			f.OldPath, f.NewPath = rel, rel
+		}
+	}
+	if len(f.Hunks) == 1 {
+		h := f.Hunks[0]
+		f.NewFile = f.NewFile || (h.OldStart == 0 && h.OldLines == 0)
+		f.DeletedFile = f.DeletedFile || (h.NewStart == 0 && h.NewLines == 0)
+	}
+}
+
+// resolveOnlyIn turns "Only in" lines into added or deleted files once the
+// compared directories are known from the rest of the diff.
+func (p *parser) resolveOnlyIn() {
+	for _, f := range p.files {
+		if f.onlyIn == "" {
+			continue
+		}
+		switch {
+		case p.oldRoot != "" && strings.HasPrefix(f.onlyIn, p.oldRoot+"/"):
+			f.OldPath = strings.TrimPrefix(f.onlyIn, p.oldRoot+"/")
+			f.DeletedFile = true
+		case p.newRoot != "" && strings.HasPrefix(f.onlyIn, p.newRoot+"/"):
+			f.NewPath = strings.TrimPrefix(f.onlyIn, p.newRoot+"/")
+			f.NewFile = true
+		default:
+			f.OldPath, f.NewPath = f.onlyIn, f.onlyIn
+		}
+	}
+}
+
+func (p *parser) beginHunk(line string, i int) {
+	m := hunkHeaderRe.FindStringSubmatch(line)
+	if m == nil {
+		p.file.Header = append(p.file.Header, line)
+		return
+	}
+	h := &Hunk{
+		OldStart: atoi(m[1], 0),
+		OldLines: atoi(m[2], 1),
+		NewStart: atoi(m[3], 0),
+		NewLines: atoi(m[4], 1),
+		Section:  m[5],
+		Header:   line,
+		index:    i,
+	}
+	p.file.Hunks = append(p.file.Hunks, h)
+	p.hunk = h
+	p.oldLeft, p.newLeft = h.OldLines, h.NewLines
+	p.oldNo, p.newNo = h.OldStart, h.NewStart
+}
+
+func (p *parser) hunkLine(line string, i int) bool {
+	var l Line
+	switch {
+	case line == "":
+		// Some tools strip the trailing space of empty context lines.
+		if i == len(p.raw)-1 {
+			return false
+		}
+		l = Line{Kind: Context}
+	case line[0] == ' ':
+		l = Line{Kind: Context, Content: line[1:]}
+	case line[0] == '+':
+		l = Line{Kind: Added, Content: line[1:]}
+	case line[0] == '-':
+		l = Line{Kind: Deleted, Content: line[1:]}
+	case line[0] == '\\':
+		if len(p.hunk.Lines) > 0 {
+			p.hunk.Lines[len(p.hunk.Lines)-1].NoNewline = true
+		}
+		return true
+	default:
+		return false
+	}
+
+	l.index = i
+	switch l.Kind {
+	case Context:
+		l.OldLine, l.NewLine = p.oldNo, p.newNo
+		p.oldNo++
+		p.newNo++
+		p.oldLeft--
+		p.newLeft--
+	case Added:
+		l.NewLine = p.newNo
+		l.after = p.oldNo - 1
+		p.newNo++
+		p.newLeft--
+	case Deleted:
+		l.OldLine = p.oldNo
+		l.anchor = p.newNo - 1
+		p.oldNo++
+		p.oldLeft--
+	}
+	p.hunk.Lines = append(p.hunk.Lines, l)
+	return true
+}
+
+// beginCombinedHunk starts a hunk of a combined diff. Its old range is the
+// one of the first parent.
+func (p *parser) beginCombinedHunk(line string, i int) {
+	m := combinedHeaderRe.FindStringSubmatch(line)
+	if m == nil {
+		p.file.Header = append(p.file.Header, line)
+		return
+	}
+	ranges := strings.Fields(m[2])
+	p.file.Parents = len(ranges)
+	oldStart, oldLines, _ := strings.Cut(strings.TrimPrefix(ranges[0], "-"), ",")
+	h := &Hunk{
+		OldStart: atoi(oldStart, 0),
+		OldLines: atoi(oldLines, 1),
+		NewStart: atoi(m[3], 0),
+		NewLines: atoi(m[4], 1),
+		Section:  m[5],
+		Header:   line,
+		index:    i,
+	}
+	p.file.Hunks = append(p.file.Hunks, h)
+	p.hunk = h
+	p.oldNo, p.newNo = h.OldStart, h.NewStart
+}
+
+// combinedLine reads a line of a combined diff hunk, which has one marker
+// column per parent. A "-" in any column is a line the merge result drops,
+// a "+" one the result has and that parent did not; the line counts as
+// deleted, added or context accordingly. Old line numbers follow the first
+// parent.
+func (p *parser) combinedLine(line string, i int) bool {
+	n := p.file.Parents
+	if strings.HasPrefix(line, `\`) {
+		if len(p.hunk.Lines) > 0 {
+			p.hunk.Lines[len(p.hunk.Lines)-1].NoNewline = true
+		}
+		return true
+	}
+	if len(line) < n || strings.Trim(line[:n], " +-") != "" {
+		return false
+	}
+	cols := line[:n]
+	l := Line{Content: line[n:], index: i}
+	inFirst := cols[0] == '-' || cols[0] == ' ' && !strings.Contains(cols, "-")
+	switch {
+	case strings.Contains(cols, "-"):
+		l.Kind = Deleted
+		l.anchor = p.newNo - 1
+	case strings.Contains(cols, "+"):
+		l.Kind = Added
+		l.after = p.oldNo - 1
+	default:
+		l.Kind = Context
+	}
+	if inFirst {
+		l.OldLine = p.oldNo
+		p.oldNo++
+	}
+	if l.Kind != Deleted {
+		l.NewLine = p.newNo
+		p.newNo++
+	}
+	p.hunk.Lines = append(p.hunk.Lines, l)
+	return true
+}
+
+// parseGitPaths splits the "a/X b/Y" part of a "diff --git" line.
+func parseGitPaths(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	// Identical paths are the common case and the only reliable split when
+	// the name itself contains " b/".
+	if n := len(s); n%2 == 1 {
+		half := (n - 1) / 2
+		a, b := s[:half], s[half+1:]
+		if strings.HasPrefix(a, "a/") && strings.HasPrefix(b, "b/") && a[2:] == b[2:] {
+			return a[2:], b[2:]
+		}
+	}
+	if idx := strings.Index(s, " b/"); idx != -1 {
+		return trimPrefixDir(unquote(s[:idx])), trimPrefixDir(unquote(s[idx+1:]))
+	}
+	if idx := strings.Index(s, " \"b/"); idx != -1 {
+		return trimPrefixDir(unquote(s[:idx])), trimPrefixDir(unquote(s[idx+1:]))
+	}
+	return trimPrefixDir(s), trimPrefixDir(s)
+}
+
+// parseMarkerPath extracts the path from the rest of a "---" or "+++" line.
+func parseMarkerPath(s string) string {
+	if idx := strings.Index(s, "\t"); idx != -1 {
+		// svn marks the missing side of an added or deleted file
+		if stamp := strings.TrimSpace(s[idx+1:]); stamp == "(nonexistent)" || stamp == "(revision 0)" {
+			return ""
+		}
+		s = s[:idx]
+	}
+	s = unquote(strings.TrimSpace(s))
+	if s == "/dev/null" {
+		return ""
+	}
+	return trimPrefixDir(s)
+}
+
+func trimPrefixDir(s string) string {
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		return s[2:]
+	}
+	return s
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+	}
+	return s
+}
+
+func atoi(s string, def int) int {
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return def
+	}
+	return n
+}
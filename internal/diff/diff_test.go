@@ -0,0 +1,502 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const gitDiff = `diff --git a/main.go b/main.go
+index 83db48f..bf269f4 100644
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,5 @@ package main
+ package main
+-import "fmt"
++import "log"
++import "os"
+
+ func main() {}
+diff --git a/new.txt b/new.txt
+new file mode 100644
+index 0000000..3b18e51
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++hello
+\ No newline at end of file
+`
+
+func TestParseGit(t *testing.T) {
+	files := Parse(gitDiff)
+	if len(files) != 2 {
+		t.Fatalf("Parse() returned %d files, want 2", len(files))
+	}
+
+	f := files[0]
+	if f.OldPath != "main.go" || f.NewPath != "main.go" {
+		t.Errorf("paths = %q, %q, want main.go, main.go", f.OldPath, f.NewPath)
+	}
+	if len(f.Hunks) != 1 {
+		t.Fatalf("got %d hunks, want 1", len(f.Hunks))
+	}
+	h := f.Hunks[0]
+	if h.OldStart != 1 || h.OldLines != 4 || h.NewStart != 1 || h.NewLines != 5 {
+		t.Errorf("hunk range = -%d,%d +%d,%d, want -1,4 +1,5", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+	}
+	if h.Section != "package main" {
+		t.Errorf("Section = %q, want %q", h.Section, "package main")
+	}
+
+	want := []Line{
+		{Kind: Context, Content: "package main", OldLine: 1, NewLine: 1},
+		{Kind: Deleted, Content: `import "fmt"`, OldLine: 2},
+		{Kind: Added, Content: `import "log"`, NewLine: 2},
+		{Kind: Added, Content: `import "os"`, NewLine: 3},
+		{Kind: Context, Content: "", OldLine: 3, NewLine: 4},
+		{Kind: Context, Content: "func main() {}", OldLine: 4, NewLine: 5},
+	}
+	if len(h.Lines) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(h.Lines), len(want))
+	}
+	for i, w := range want {
+		got := h.Lines[i]
+		if got.Kind != w.Kind || got.Content != w.Content || got.OldLine != w.OldLine || got.NewLine != w.NewLine {
+			t.Errorf("line %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	added, deleted := f.Stats()
+	if added != 2 || deleted != 1 {
+		t.Errorf("Stats() = +%d -%d, want +2 -1", added, deleted)
+	}
+
+	nf := files[1]
+	if !nf.NewFile || nf.OldPath != "" || nf.NewPath != "new.txt" {
+		t.Errorf("new file = %+v, want NewFile with path new.txt", nf)
+	}
+	if len(nf.Hunks) != 1 || len(nf.Hunks[0].Lines) != 1 || !nf.Hunks[0].Lines[0].NoNewline {
+		t.Errorf("expected single added line with no-newline marker")
+	}
+}
+
+func TestParseHg(t *testing.T) {
+	diffText := `diff -r 123456 dir/file name.go
+--- a/dir/file name.go	Tue Jan 01 00:00:00 2024 +0000
++++ b/dir/file name.go	Tue Jan 01 00:00:01 2024 +0000
+@@ -1,1 +1,1 @@
+-old
++new
+`
+	files := Parse(diffText)
+	if len(files) != 1 {
+		t.Fatalf("Parse() returned %d files, want 1", len(files))
+	}
+	if got := files[0].Path(); got != "dir/file name.go" {
+		t.Errorf("Path() = %q, want %q", got, "dir/file name.go")
+	}
+}
+
+func TestParseHeaderless(t *testing.T) {
+	diffText := `--- a.txt	2024-01-01
++++ a.txt	2024-01-02
+@@ -1 +1 @@
+-a
++b
+--- b.txt
++++ b.txt
+@@ -1 +1 @@
+-c
++d
+`
+	got := Paths(Parse(diffText))
+	if strings.Join(got, ",") != "a.txt,b.txt" {
+		t.Errorf("Paths() = %v, want [a.txt b.txt]", got)
+	}
+}
+
+func TestParseDiffRecursive(t *testing.T) {
+	diffText := `Binary files old/logo.png and new/logo.png differ
+Only in new/docs: added.md
+Only in old: gone.txt
+diff -ruN old/src/f.go new/src/f.go
+--- old/src/f.go	2024-01-01 00:00:00.000000000 +0000
++++ new/src/f.go	2024-01-02 00:00:00.000000000 +0000
+@@ -1 +1 @@
+-a
++b
+diff -ruN old/src/new.go new/src/new.go
+--- old/src/new.go	1970-01-01 00:00:00.000000000 +0000
++++ new/src/new.go	2024-01-02 00:00:00.000000000 +0000
+@@ -0,0 +1 @@
++c
+`
+	files := Parse(diffText)
+	if got := strings.Join(Paths(files), ","); got != "logo.png,docs/added.md,gone.txt,src/f.go,src/new.go" {
+		t.Fatalf("Paths() = %v", got)
+	}
+	if !Find(files, "logo.png").Binary {
+		t.Error("logo.png is not binary")
+	}
+	if f := Find(files, "docs/added.md"); !f.NewFile || f.OldPath != "" {
+		t.Errorf("docs/added.md = %+v, want an added file", f)
+	}
+	if f := Find(files, "gone.txt"); !f.DeletedFile || f.NewPath != "" {
+		t.Errorf("gone.txt = %+v, want a deleted file", f)
+	}
+	if f := Find(files, "src/f.go"); f.NewFile || f.DeletedFile || f.OldPath != "src/f.go" {
+		t.Errorf("src/f.go = %+v, want a modified file", f)
+	}
+	if !Find(files, "src/new.go").NewFile {
+		t.Error("the file diff -N compares with an empty one is not new")
+	}
+}
+
+func TestParseSvn(t *testing.T) {
+	diffText := `Index: src/f.go
+===================================================================
+--- src/f.go	(revision 12)
++++ src/f.go	(working copy)
+@@ -1,2 +1,2 @@
+ a
+-b
++c
+Index: new.txt
+===================================================================
+--- new.txt	(nonexistent)
++++ new.txt	(working copy)
+@@ -0,0 +1 @@
++x
+Index: img.png
+===================================================================
+Cannot display: file marked as a binary type.
+svn:mime-type = application/octet-stream
+`
+	files := Parse(diffText)
+	if got := strings.Join(Paths(files), ","); got != "src/f.go,new.txt,img.png" {
+		t.Fatalf("Paths() = %v", got)
+	}
+	if !strings.HasPrefix(files[1].Raw, "Index: new.txt\n") {
+		t.Errorf("Raw of new.txt = %q, want it to start at its Index line", files[1].Raw)
+	}
+	if !files[1].NewFile || !files[2].Binary {
+		t.Errorf("new.txt new = %v, img.png binary = %v", files[1].NewFile, files[2].Binary)
+	}
+}
+
+const renameDiff = `diff --git a/a.txt "b/dir with space/renamed.txt"
+similarity index 96%
+rename from a.txt
+rename to "dir with space/renamed.txt"
+index 3be11c6..f3a5c4e 100644
+--- a/a.txt
++++ "b/dir with space/renamed.txt"
+@@ -30,0 +31 @@
++more
+diff --git a/keep.txt b/copy.txt
+similarity index 100%
+copy from keep.txt
+copy to copy.txt
+diff --git a/link b/link
+index 9d5bb5b..3b8b5ac 120000
+--- a/link
++++ b/link
+@@ -1 +1 @@
+-l.txt
+\ No newline at end of file
++run.sh
+\ No newline at end of file
+diff --git a/run.sh b/run.sh
+old mode 100644
+new mode 100755
+`
+
+func TestParseRenames(t *testing.T) {
+	files := Parse(renameDiff)
+	if len(files) != 4 {
+		t.Fatalf("Parse() returned %d files, want 4", len(files))
+	}
+
+	renamed, copied, link, script := files[0], files[1], files[2], files[3]
+	if !renamed.Renamed() || renamed.OldPath != "a.txt" || renamed.NewPath != "dir with space/renamed.txt" || renamed.Similarity != 96 {
+		t.Errorf("renamed file: %+v", renamed)
+	}
+	if renamed.ModeChanged() || renamed.Symlink() {
+		t.Errorf("renamed file should keep mode 100644, got %q -> %q", renamed.OldMode, renamed.NewMode)
+	}
+	if !copied.Copied || copied.Renamed() || copied.OldPath != "keep.txt" || copied.NewPath != "copy.txt" || copied.Similarity != 100 {
+		t.Errorf("copied file: %+v", copied)
+	}
+	if !link.Symlink() || link.ModeChanged() || len(link.Hunks) != 1 {
+		t.Errorf("symlink: %+v", link)
+	}
+	if !script.ModeChanged() || script.OldMode != "100644" || script.NewMode != "100755" || len(script.Hunks) != 0 {
+		t.Errorf("mode change: %+v", script)
+	}
+}
+
+const combinedDiff = `diff --cc f.txt
+index ed75e4e,af6af34..12b84da
+--- a/f.txt
++++ b/f.txt
+@@@ -1,8 -1,8 +1,8 @@@
+  1
+ -2
+ +two
+  3
+--5
+++five
+  6
+diff --git a/g.txt b/g.txt
+index 3be11c6..f3a5c4e 100644
+--- a/g.txt
++++ b/g.txt
+@@ -1 +1 @@
+-x
++y
+`
+
+func TestParseCombined(t *testing.T) {
+	if got := Sniff(combinedDiff); got != FormatGit {
+		t.Errorf("Sniff() = %v, want git", got)
+	}
+	files := Parse(combinedDiff)
+	if len(files) != 2 || files[0].Path() != "f.txt" || files[1].Path() != "g.txt" {
+		t.Fatalf("Parse() = %+v, want f.txt and g.txt", files)
+	}
+
+	f := files[0]
+	if f.Parents != 2 || len(f.Hunks) != 1 {
+		t.Fatalf("combined file: %+v", f)
+	}
+	want := []struct {
+		kind             Kind
+		content          string
+		oldLine, newLine int
+	}{
+		{Context, "1", 1, 1},
+		{Deleted, "2", 0, 0}, // only in the second parent
+		{Added, "two", 2, 2}, // from the first parent
+		{Context, "3", 3, 3},
+		{Deleted, "5", 4, 0},
+		{Added, "five", 0, 4},
+		{Context, "6", 5, 5},
+	}
+	lines := f.Hunks[0].Lines
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(lines), len(want), lines)
+	}
+	for i, w := range want {
+		l := lines[i]
+		if l.Kind != w.kind || l.Content != w.content || l.OldLine != w.oldLine || l.NewLine != w.newLine {
+			t.Errorf("line %d = %+v, want %+v", i, l, w)
+		}
+	}
+	if files[1].Parents != 0 || len(files[1].Hunks[0].Lines) != 2 {
+		t.Errorf("file after the combined diff: %+v", files[1])
+	}
+}
+
+func TestParseDeletionLooksLikeHeader(t *testing.T) {
+	// A deleted line whose content starts with "-- " must not be taken
+	// for a file header.
+	diffText := `diff --git a/q.sql b/q.sql
+--- a/q.sql
++++ b/q.sql
+@@ -1,2 +1,1 @@
+--- comment
+ select 1;
+`
+	files := Parse(diffText)
+	if len(files) != 1 || len(files[0].Hunks[0].Lines) != 2 {
+		t.Fatalf("expected one file with two lines, got %+v", files)
+	}
+	if l := files[0].Hunks[0].Lines[0]; l.Kind != Deleted || l.Content != "-- comment" {
+		t.Errorf("line 0 = %+v, want deletion of %q", l, "-- comment")
+	}
+}
+
+func TestParseColored(t *testing.T) {
+	diffText := "\033[1mdiff --git a/x.go b/x.go\033[m\n" +
+		"\033[1m--- a/x.go\033[m\n" +
+		"\033[1m+++ b/x.go\033[m\n" +
+		"\033[36m@@ -1 +1 @@\033[m\n" +
+		"\033[31m-a\033[m\n" +
+		"\033[32m+b\033[m\n"
+
+	files := Parse(diffText)
+	if len(files) != 1 || files[0].Path() != "x.go" {
+		t.Fatalf("Parse() = %+v, want x.go", files)
+	}
+	if !strings.Contains(files[0].Raw, "\033[31m-a") {
+		t.Errorf("Raw should keep original color codes, got %q", files[0].Raw)
+	}
+}
+
+func TestParseGitPaths(t *testing.T) {
+	tests := []struct {
+		input    string
+		old, new string
+	}{
+		{"a/foo.go b/foo.go", "foo.go", "foo.go"},
+		{"a/x b/y.go b/x b/y.go", "x b/y.go", "x b/y.go"},
+		{"a/old.go b/new.go", "old.go", "new.go"},
+		{`"a/sp ace.go" "b/sp ace.go"`, "sp ace.go", "sp ace.go"},
+	}
+	for _, tt := range tests {
+		old, new := parseGitPaths(tt.input)
+		if old != tt.old || new != tt.new {
+			t.Errorf("parseGitPaths(%q) = %q, %q, want %q, %q", tt.input, old, new, tt.old, tt.new)
+		}
+	}
+}
+
+func TestFileLine(t *testing.T) {
+	tests := []struct {
+		index int
+		want  int
+	}{
+		{0, 1},  // diff --git
+		{4, 0},  // @@ header at line 1
+		{5, 1},  // context
+		{6, 1},  // deleted, sits after new line 1
+		{7, 2},  // added
+		{8, 3},  // added
+		{10, 5}, // context
+		{12, 1}, // header of new.txt
+		{99, 0}, // out of range
+	}
+	for _, tt := range tests {
+		if got := FileLine(gitDiff, tt.index); got != tt.want {
+			t.Errorf("FileLine(%d) = %d, want %d", tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestRows(t *testing.T) {
+	rows := Parse(gitDiff)[0].Rows()
+	if len(rows) != 7 {
+		t.Fatalf("Rows() returned %d rows, want 7", len(rows))
+	}
+	if rows[0].Kind != HunkHeader || rows[0].String() != "@@ -1,4 +1,5 @@ package main" {
+		t.Errorf("rows[0] = %q, want hunk header", rows[0].String())
+	}
+	if rows[2].String() != `-import "fmt"` {
+		t.Errorf("rows[2] = %q", rows[2].String())
+	}
+}
+
+func TestFind(t *testing.T) {
+	files := Parse(gitDiff)
+	if f := Find(files, "new.txt"); f == nil || f != files[1] {
+		t.Errorf("Find(new.txt) = %v, want second file", f)
+	}
+	if f := Find(files, "main"); f != nil {
+		t.Errorf("Find(main) = %v, want nil for partial name", f)
+	}
+	if f := Find(files, ""); f != nil {
+		t.Errorf("Find(\"\") = %v, want nil", f)
+	}
+}
+
+// hgDiff is the output of hg diff without --git.
+const hgDiff = `diff -r 123456 file1.go
+--- a/file1.go	Tue Jan 01 00:00:00 2024 +0000
++++ b/file1.go	Tue Jan 01 00:00:01 2024 +0000
+@@ -10,7 +10,8 @@
+ func main() {
+-	fmt.Println("old")
++	fmt.Println("new")
++	fmt.Println("added")
+ }
+diff -r 123456 file2.py
+--- a/file2.py	Tue Jan 01 00:00:00 2024 +0000
++++ b/file2.py	Tue Jan 01 00:00:01 2024 +0000
+@@ -1,2 +1,2 @@
+-print("hello")
++print("world")
+`
+
+func TestFileLineHg(t *testing.T) {
+	tests := []struct {
+		index int
+		want  int
+	}{
+		{0, 1},  // diff -r
+		{3, 9},  // @@ header at line 10
+		{4, 10}, // context
+		{5, 10}, // deleted, sits after new line 10
+		{6, 11}, // added
+		{7, 12}, // added
+	}
+	for _, tt := range tests {
+		if got := FileLine(hgDiff, tt.index); got != tt.want {
+			t.Errorf("FileLine(%d) = %d, want %d", tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestFileLineEmpty(t *testing.T) {
+	if got := FileLine("", 0); got != 0 && got != 1 {
+		t.Errorf("FileLine(\"\", 0) = %d, want 0 or 1", got)
+	}
+	if got := FileLine("single line", 10); got != 0 {
+		t.Errorf("FileLine out of range = %d, want 0", got)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	want := []string{"file1.go", "file2.py"}
+	if got := Paths(Parse(hgDiff)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Paths() = %q, want %q", got, want)
+	}
+
+	// A file diffed twice is listed once.
+	twice := hgDiff[:strings.Index(hgDiff, "diff -r 123456 file2.py")]
+	if got := Paths(Parse(twice + twice)); !reflect.DeepEqual(got, []string{"file1.go"}) {
+		t.Errorf("Paths() = %q, want [file1.go]", got)
+	}
+
+	for _, text := range []string{"", "not a diff"} {
+		if got := Paths(Parse(text)); len(got) != 0 {
+			t.Errorf("Paths(Parse(%q)) = %q, want none", text, got)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	want := hgDiff[:strings.Index(hgDiff, "diff -r 123456 file2.py")]
+	if got := Extract(hgDiff, "file1.go"); strings.TrimSpace(got) != strings.TrimSpace(want) {
+		t.Errorf("Extract(file1.go):\ngot:\n%s\nwant:\n%s", got, want)
+	}
+	tests := []struct{ text, path string }{
+		{hgDiff, "nonexistent.go"},
+		{"", "file.txt"},
+		{"some diff", ""},
+	}
+	for _, tt := range tests {
+		if got := Extract(tt.text, tt.path); got != "" {
+			t.Errorf("Extract(%q, %q) = %q, want empty", tt.text, tt.path, got)
+		}
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"no ansi codes", "plain text", "plain text"},
+		{"colored text", "\033[31mred text\033[0m", "red text"},
+		{"multiple colors", "\033[32m+added\033[0m \033[31m-deleted\033[0m", "+added -deleted"},
+		{"complex ansi", "\033[1;32m+\033[0m\033[32mline\033[0m", "+line"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripANSI(tt.input); got != tt.want {
+				t.Errorf("StripANSI(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
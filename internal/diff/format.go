@@ -0,0 +1,72 @@
+package diff
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Format is the tool a diff was produced by, which decides how its file
+// headers are read.
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatGit            // git diff, with "diff --git" and extended headers
+	FormatHg             // hg diff without --git: "diff -r <rev>" lines
+	FormatUnified        // plain diff -u or diff -ruN, with "Only in" lines
+	FormatSvn            // svn diff: "Index:" blocks
+)
+
+var hgDiffRe = regexp.MustCompile(`^diff -r [0-9a-f]{6,40} `)
+
+func (f Format) String() string {
+	switch f {
+	case FormatGit:
+		return "git"
+	case FormatHg:
+		return "hg"
+	case FormatUnified:
+		return "diff"
+	case FormatSvn:
+		return "svn"
+	}
+	return "unknown"
+}
+
+// Sniff returns the format of a diff from its first file header, ignoring
+// any preamble such as commit messages.
+func Sniff(text string) Format {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		line = StripANSI(line)
+		next := ""
+		if i+1 < len(lines) {
+			next = StripANSI(lines[i+1])
+		}
+		switch {
+		case strings.HasPrefix(line, "diff --git "), strings.HasPrefix(line, "diff --cc "),
+			strings.HasPrefix(line, "diff --combined "):
+			return FormatGit
+		case hgDiffRe.MatchString(line):
+			return FormatHg
+		case strings.HasPrefix(line, "Index: ") && strings.HasPrefix(next, "===="):
+			return FormatSvn
+		case strings.HasPrefix(line, "diff "), strings.HasPrefix(line, "Only in "):
+			return FormatUnified
+		case strings.HasPrefix(line, "--- ") && strings.HasPrefix(next, "+++ "):
+			return FormatUnified
+		}
+	}
+	return FormatUnknown
+}
+
+// commonSuffix returns the trailing path components a and b share, which
+// for diff -r output is the path below the two compared directories.
+func commonSuffix(a, b string) string {
+	ap, bp := strings.Split(a, "/"), strings.Split(b, "/")
+	n := 0
+	for n < len(ap) && n < len(bp) && ap[len(ap)-1-n] == bp[len(bp)-1-n] {
+		n++
+	}
+	return strings.Join(ap[len(ap)-n:], "/")
+}
@@ -0,0 +1,41 @@
+package diff
+
+import "testing"
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want Format
+	}{
+		{"git", "commit abc\n\n    msg\n\ndiff --git a/x b/x\n", FormatGit},
+		{"git colored", "\x1b[1mdiff --git a/x b/x\x1b[m\n", FormatGit},
+		{"hg", "diff -r 8b3dbe0a1c2f -r 1a2b3c4d5e6f x\n--- a/x\n+++ b/x\n", FormatHg},
+		{"diff -ruN", "diff -ruN old/x new/x\n--- old/x\t2024-01-01\n+++ new/x\t2024-01-01\n", FormatUnified},
+		{"diff -r only", "Only in old: x\n", FormatUnified},
+		{"diff -u", "--- x.orig\n+++ x\n@@ -1 +1 @@\n", FormatUnified},
+		{"svn", "Index: x\n===================================================================\n--- x\t(revision 1)\n", FormatSvn},
+		{"not a diff", "hello\n", FormatUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sniff(tt.text); got != tt.want {
+				t.Errorf("Sniff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommonSuffix(t *testing.T) {
+	tests := []struct{ a, b, want string }{
+		{"old/sub/f.go", "new/sub/f.go", "sub/f.go"},
+		{"proj/f.go", "proj-2/f.go", "f.go"},
+		{"a.txt", "b.txt", ""},
+		{"x/ab.go", "y/b.go", ""},
+	}
+	for _, tt := range tests {
+		if got := commonSuffix(tt.a, tt.b); got != tt.want {
+			t.Errorf("commonSuffix(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Interdiff compares two versions of a change, such as a patch series before
+// and after a force-push, and returns a unified diff of the two diffs.
+//
+// The lines of the result are the patch lines of the versions, so a line
+// added only by the new version reads "++line" and one the old version
+// deleted but the new one keeps reads "- line". Hunks with the same changes
+// in both versions are left out, as are files whose diff did not change.
+// Each remaining hunk opens with a context line such as
+// "## modified @@ -10,4 +10,6 @@" telling whether it was added, dropped or
+// modified between the versions.
+func Interdiff(old, new []*File) string {
+	var b strings.Builder
+	seen := make(map[string]bool)
+	for _, nf := range new {
+		seen[nf.Path()] = true
+		of := Find(old, nf.Path())
+		if of == nil && nf.OldPath != "" {
+			of = Find(old, nf.OldPath)
+		}
+		if of != nil {
+			seen[of.Path()] = true
+		}
+		writeInterdiff(&b, nf.Path(), hunksOf(of), nf.Hunks)
+	}
+	for _, of := range old {
+		if !seen[of.Path()] {
+			writeInterdiff(&b, of.Path(), of.Hunks, nil)
+		}
+	}
+	return b.String()
+}
+
+func hunksOf(f *File) []*Hunk {
+	if f == nil {
+		return nil
+	}
+	return f.Hunks
+}
+
+// interHunk is one hunk of an interdiff: a marker followed by patch lines,
+// each prefixed with its outer marker.
+type interHunk struct {
+	marker string
+	lines  []string
+}
+
+// writeInterdiff appends the interdiff of one file's hunks to b.
+func writeInterdiff(b *strings.Builder, path string, old, new []*Hunk) {
+	hunks := pairHunks(old, new)
+	if len(hunks) == 0 {
+		return
+	}
+
+	fmt.Fprintf(b, "diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n", path, path, path, path)
+	oldNo, newNo := 1, 1
+	for _, h := range hunks {
+		oldCount, newCount := 1, 1 // the marker line
+		for _, l := range h.lines {
+			switch l[0] {
+			case '-':
+				oldCount++
+			case '+':
+				newCount++
+			default:
+				oldCount++
+				newCount++
+			}
+		}
+		fmt.Fprintf(b, "@@ -%d,%d +%d,%d @@\n", oldNo, oldCount, newNo, newCount)
+		b.WriteString(" " + h.marker + "\n")
+		for _, l := range h.lines {
+			b.WriteString(l + "\n")
+		}
+		oldNo += oldCount
+		newNo += newCount
+	}
+}
+
+// pairHunks lines up the hunks of both versions. Hunks making identical
+// changes anchor the comparison and are dropped; between anchors, hunks
+// touching overlapping lines of the base are compared line by line and the
+// rest count as added or dropped.
+func pairHunks(old, new []*Hunk) []interHunk {
+	oldCommon, newCommon := lcs(hunkTokens(old), hunkTokens(new))
+
+	var out []interHunk
+	i, j := 0, 0
+	for {
+		gi, gj := i, j
+		for gi < len(old) && !oldCommon[gi] {
+			gi++
+		}
+		for gj < len(new) && !newCommon[gj] {
+			gj++
+		}
+		out = append(out, pairGap(old[i:gi], new[j:gj])...)
+		if gi == len(old) || gj == len(new) {
+			return out
+		}
+		i, j = gi+1, gj+1
+	}
+}
+
+// pairGap compares the unmatched hunks between two anchors.
+func pairGap(old, new []*Hunk) []interHunk {
+	var out []interHunk
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		switch {
+		case i < len(old) && j < len(new) && overlaps(old[i], new[j]):
+			out = append(out, modifiedHunk(old[i], new[j]))
+			i++
+			j++
+		case j == len(new) || (i < len(old) && old[i].OldStart < new[j].OldStart):
+			out = append(out, droppedHunk(old[i]))
+			i++
+		default:
+			out = append(out, addedHunk(new[j]))
+			j++
+		}
+	}
+	return out
+}
+
+// hunkTokens keys each hunk by the changes it makes, ignoring context and
+// line numbers, so that hunks moved by unrelated edits still match.
+func hunkTokens(hunks []*Hunk) []token {
+	toks := make([]token, len(hunks))
+	for i, h := range hunks {
+		var key strings.Builder
+		for _, l := range h.Lines {
+			if l.Kind == Added || l.Kind == Deleted {
+				key.WriteString(l.String() + "\n")
+			}
+		}
+		toks[i] = token{text: key.String()}
+	}
+	return toks
+}
+
+// overlaps reports whether a and b change overlapping lines of the base.
+func overlaps(a, b *Hunk) bool {
+	aEnd := a.OldStart + max(a.OldLines, 1)
+	bEnd := b.OldStart + max(b.OldLines, 1)
+	return a.OldStart < bEnd && b.OldStart < aEnd
+}
+
+func addedHunk(h *Hunk) interHunk {
+	return interHunk{marker: "## added " + h.Header, lines: prefixed("+", h.Lines)}
+}
+
+func droppedHunk(h *Hunk) interHunk {
+	return interHunk{marker: "## dropped " + h.Header, lines: prefixed("-", h.Lines)}
+}
+
+func prefixed(marker string, lines []Line) []string {
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = marker + l.String()
+	}
+	return out
+}
+
+// modifiedHunk diffs the patch lines of two versions of a hunk.
+func modifiedHunk(old, new *Hunk) interHunk {
+	a, b := lineTokens(old.Lines), lineTokens(new.Lines)
+	aCommon, bCommon := lcs(a, b)
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && !aCommon[i]:
+			lines = append(lines, "-"+a[i].text)
+			i++
+		case j < len(b) && !bCommon[j]:
+			lines = append(lines, "+"+b[j].text)
+			j++
+		default:
+			lines = append(lines, " "+b[j].text)
+			i++
+			j++
+		}
+	}
+	return interHunk{marker: "## modified " + new.Header, lines: lines}
+}
+
+func lineTokens(lines []Line) []token {
+	toks := make([]token, len(lines))
+	for i, l := range lines {
+		toks[i] = token{text: l.String()}
+	}
+	return toks
+}
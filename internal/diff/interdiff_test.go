@@ -0,0 +1,111 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+const interdiffOld = `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -1,3 +1,3 @@ package a
+ one
+-two
++TWO
+ three
+@@ -10,3 +10,3 @@ func f()
+ ten
+-eleven
++ELEVEN
+ twelve
+@@ -20,2 +20,3 @@ func g()
+ twenty
++dropped later
+ twentyone
+diff --git a/gone.go b/gone.go
+--- a/gone.go
++++ b/gone.go
+@@ -1,1 +1,1 @@
+-x
++y
+`
+
+const interdiffNew = `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -1,3 +1,3 @@ package a
+ one
+-two
++TWO
+ three
+@@ -10,3 +10,3 @@ func f()
+ ten
+-eleven
++Eleven
+ twelve
+@@ -30,2 +30,3 @@ func h()
+ thirty
++added later
+ thirtyone
+diff --git a/same.go b/same.go
+--- a/same.go
++++ b/same.go
+@@ -5,1 +5,1 @@
+-p
++q
+`
+
+func TestInterdiff(t *testing.T) {
+	old := Parse(interdiffOld + "diff --git a/same.go b/same.go\n--- a/same.go\n+++ b/same.go\n@@ -1,1 +1,1 @@\n-p\n+q\n")
+	got := Interdiff(old, Parse(interdiffNew))
+
+	files := Parse(got)
+	if paths := Paths(files); strings.Join(paths, ",") != "a.go,gone.go" {
+		t.Fatalf("interdiff paths = %v, want [a.go gone.go]\n%s", paths, got)
+	}
+
+	var markers []string
+	for _, h := range files[0].Hunks {
+		markers = append(markers, h.Lines[0].Content)
+	}
+	want := []string{
+		"## modified @@ -10,3 +10,3 @@ func f()",
+		"## dropped @@ -20,2 +20,3 @@ func g()",
+		"## added @@ -30,2 +30,3 @@ func h()",
+	}
+	if strings.Join(markers, "\n") != strings.Join(want, "\n") {
+		t.Errorf("markers =\n%s\nwant\n%s", strings.Join(markers, "\n"), strings.Join(want, "\n"))
+	}
+
+	modified := files[0].Hunks[0].Lines
+	var changed []string
+	for _, l := range modified {
+		if l.Kind != Context {
+			changed = append(changed, l.String())
+		}
+	}
+	if strings.Join(changed, ",") != "-+ELEVEN,++Eleven" {
+		t.Errorf("modified hunk changes = %v, want [-+ELEVEN ++Eleven]", changed)
+	}
+
+	if added, deleted := files[1].Stats(); added != 0 || deleted != 2 {
+		t.Errorf("dropped file stats = +%d -%d, want +0 -2", added, deleted)
+	}
+}
+
+func TestInterdiffIdentical(t *testing.T) {
+	files := Parse(interdiffOld)
+	if got := Interdiff(files, Parse(interdiffOld)); got != "" {
+		t.Errorf("Interdiff of identical diffs = %q, want empty", got)
+	}
+}
+
+func TestInterdiffMovedHunk(t *testing.T) {
+	// A hunk shifted by an unrelated rebase makes the same change and is
+	// not reported.
+	old := Parse("--- a/x\n+++ b/x\n@@ -5,2 +5,2 @@\n a\n-b\n+c\n")
+	new := Parse("--- a/x\n+++ b/x\n@@ -9,2 +9,2 @@\n a\n-b\n+c\n")
+	if got := Interdiff(old, new); got != "" {
+		t.Errorf("Interdiff of moved hunk = %q, want empty", got)
+	}
+}
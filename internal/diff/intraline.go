@@ -0,0 +1,186 @@
+package diff
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Granularity selects how Intraline splits lines before comparing them.
+type Granularity int
+
+const (
+	Words Granularity = iota
+	Chars
+)
+
+// Span is a byte range [Start, End) of a line's Content.
+type Span struct {
+	Start, End int
+}
+
+// maxIntralineCells bounds the LCS table so huge lines do not stall the UI.
+const maxIntralineCells = 1 << 20
+
+// Intraline returns the spans of a and b that differ. Both are nil when the
+// lines have too little in common for a token-level diff to be useful.
+func Intraline(a, b string, g Granularity) (aSpans, bSpans []Span) {
+	at, bt := tokenize(a, g), tokenize(b, g)
+
+	// Common prefix and suffix are cheap and keep the table small.
+	pre := 0
+	for pre < len(at) && pre < len(bt) && at[pre].text == bt[pre].text {
+		pre++
+	}
+	suf := 0
+	for suf < len(at)-pre && suf < len(bt)-pre && at[len(at)-1-suf].text == bt[len(bt)-1-suf].text {
+		suf++
+	}
+	am, bm := at[pre:len(at)-suf], bt[pre:len(bt)-suf]
+	if len(am)*len(bm) > maxIntralineCells {
+		return nil, nil
+	}
+
+	aCommon, bCommon := lcs(am, bm)
+
+	common := 0
+	for _, t := range at[:pre] {
+		common += len(t.text)
+	}
+	for _, t := range at[len(at)-suf:] {
+		common += len(t.text)
+	}
+	for i, t := range am {
+		if aCommon[i] {
+			common += len(t.text)
+		}
+	}
+	if longest := max(len(a), len(b)); longest > 0 && common*3 < longest {
+		return nil, nil
+	}
+
+	return spans(am, aCommon), spans(bm, bCommon)
+}
+
+// Emphasis pairs each run of deletions with the additions that follow it and
+// returns the changed spans per line, indexed like lines.
+func Emphasis(lines []Line, g Granularity) [][]Span {
+	out := make([][]Span, len(lines))
+	var dels, adds []int
+
+	flush := func() {
+		for k := 0; k < len(dels) && k < len(adds); k++ {
+			d, a := dels[k], adds[k]
+			out[d], out[a] = Intraline(lines[d].Content, lines[a].Content, g)
+		}
+		dels, adds = nil, nil
+	}
+
+	for i, l := range lines {
+		switch l.Kind {
+		case Deleted:
+			if len(adds) > 0 {
+				flush()
+			}
+			dels = append(dels, i)
+		case Added:
+			adds = append(adds, i)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return out
+}
+
+type token struct {
+	text  string
+	start int
+}
+
+func tokenize(s string, g Granularity) []token {
+	var toks []token
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		end := i + size
+		if g == Words {
+			class := runeClass(r)
+			for end < len(s) && class != classPunct {
+				next, n := utf8.DecodeRuneInString(s[end:])
+				if runeClass(next) != class {
+					break
+				}
+				end += n
+			}
+		}
+		toks = append(toks, token{text: s[i:end], start: i})
+		i = end
+	}
+	return toks
+}
+
+const (
+	classWord = iota
+	classSpace
+	classPunct
+)
+
+func runeClass(r rune) int {
+	switch {
+	case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return classWord
+	case unicode.IsSpace(r):
+		return classSpace
+	}
+	return classPunct
+}
+
+// lcs marks the tokens of a and b that belong to a longest common subsequence.
+func lcs(a, b []token) ([]bool, []bool) {
+	n, m := len(a), len(b)
+	table := make([]int32, (n+1)*(m+1))
+	at := func(i, j int) int32 { return table[i*(m+1)+j] }
+
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			v := at(i+1, j)
+			if a[i].text == b[j].text {
+				v = at(i+1, j+1) + 1
+			} else if w := at(i, j+1); w > v {
+				v = w
+			}
+			table[i*(m+1)+j] = v
+		}
+	}
+
+	aCommon, bCommon := make([]bool, n), make([]bool, m)
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case a[i].text == b[j].text:
+			aCommon[i], bCommon[j] = true, true
+			i++
+			j++
+		case at(i+1, j) >= at(i, j+1):
+			i++
+		default:
+			j++
+		}
+	}
+	return aCommon, bCommon
+}
+
+// spans merges adjacent uncommon tokens into byte ranges.
+func spans(toks []token, common []bool) []Span {
+	var out []Span
+	for i, t := range toks {
+		if common[i] {
+			continue
+		}
+		end := t.start + len(t.text)
+		if n := len(out); n > 0 && out[n-1].End == t.start {
+			out[n-1].End = end
+		} else {
+			out = append(out, Span{Start: t.start, End: end})
+		}
+	}
+	return out
+}
@@ -0,0 +1,54 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIntralineWords(t *testing.T) {
+	a := "return foo(bar, 1)"
+	b := "return foo(baz, 1)"
+	as, bs := Intraline(a, b, Words)
+	if want := []Span{{11, 14}}; !reflect.DeepEqual(as, want) {
+		t.Errorf("old spans = %v, want %v", as, want)
+	}
+	if want := []Span{{11, 14}}; !reflect.DeepEqual(bs, want) {
+		t.Errorf("new spans = %v, want %v", bs, want)
+	}
+}
+
+func TestIntralineChars(t *testing.T) {
+	as, bs := Intraline("colour", "color", Chars)
+	if want := []Span{{4, 5}}; !reflect.DeepEqual(as, want) {
+		t.Errorf("old spans = %v, want %v", as, want)
+	}
+	if len(bs) != 0 {
+		t.Errorf("new spans = %v, want none", bs)
+	}
+}
+
+func TestIntralineUnrelated(t *testing.T) {
+	as, bs := Intraline("alpha beta gamma", "x := 42", Words)
+	if as != nil || bs != nil {
+		t.Errorf("got %v, %v; want nil for unrelated lines", as, bs)
+	}
+}
+
+func TestEmphasisPairsRuns(t *testing.T) {
+	lines := []Line{
+		{Kind: HunkHeader},
+		{Kind: Context, Content: "a"},
+		{Kind: Deleted, Content: "x = 1"},
+		{Kind: Deleted, Content: "y = 2"},
+		{Kind: Added, Content: "x = 10"},
+		{Kind: Context, Content: "b"},
+		{Kind: Added, Content: "z = 3"},
+	}
+	got := Emphasis(lines, Words)
+	if got[2] == nil || got[4] == nil {
+		t.Fatalf("paired lines not emphasized: %v", got)
+	}
+	if got[3] != nil || got[6] != nil {
+		t.Errorf("unpaired lines emphasized: %v", got)
+	}
+}
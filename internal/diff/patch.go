@@ -0,0 +1,256 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Patch renders f as a patch containing only the changed lines keep accepts.
+//
+// By default the result applies to the old side of f: unselected deletions
+// turn into context and unselected additions are dropped. With reverse set
+// the result is meant to be reverse-applied to the new side instead, so
+// unselected additions become context and unselected deletions are dropped.
+// Patch returns "" when nothing is selected.
+func (f *File) Patch(keep func(Line) bool, reverse bool) string {
+	var body strings.Builder
+	delta := 0
+	partial := false
+
+	for _, h := range f.Hunks {
+		var lines []string
+		oldCount, newCount, changes := 0, 0, 0
+
+		for _, l := range h.Lines {
+			kept := l.Kind != Context && keep(l)
+			var out string
+			switch {
+			case l.Kind == Context:
+				out = l.String()
+				oldCount++
+				newCount++
+			case kept:
+				out = l.String()
+				changes++
+				if l.Kind == Added {
+					newCount++
+				} else {
+					oldCount++
+				}
+			case (l.Kind == Deleted) != reverse:
+				// Left alone on the side the patch applies to.
+				out = " " + l.Content
+				oldCount++
+				newCount++
+				partial = true
+			default:
+				partial = true
+				continue
+			}
+			lines = append(lines, out)
+			if l.NoNewline {
+				lines = append(lines, `\ No newline at end of file`)
+			}
+		}
+
+		if changes == 0 {
+			continue
+		}
+
+		// The side the patch applies to keeps its position; the other one
+		// shifts by what earlier hunks added or removed. An empty side
+		// points at the line before the hunk.
+		var oldStart, newStart int
+		if reverse {
+			newStart = h.NewStart
+			oldStart = firstLine(h.NewStart, h.NewLines) - delta
+			if oldCount == 0 {
+				oldStart--
+			}
+		} else {
+			oldStart = h.OldStart
+			newStart = firstLine(h.OldStart, h.OldLines) + delta
+			if newCount == 0 {
+				newStart--
+			}
+		}
+		delta += newCount - oldCount
+
+		fmt.Fprintf(&body, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, line := range lines {
+			body.WriteString(line + "\n")
+		}
+	}
+
+	if body.Len() == 0 {
+		return ""
+	}
+	// A partial deletion no longer removes the file, and a partially
+	// reverted addition no longer removes it either, so both become plain
+	// modifications.
+	newFile := f.NewFile && !(partial && reverse)
+	deletedFile := f.DeletedFile && !(partial && !reverse)
+	return f.patchHeader(newFile, deletedFile) + body.String()
+}
+
+// patchHeader returns the file header for a patch built from f.
+func (f *File) patchHeader(newFile, deletedFile bool) string {
+	oldName, newName := "a/"+f.oldOrNew(), "b/"+f.Path()
+	if newFile {
+		oldName = "/dev/null"
+	}
+	if deletedFile {
+		newName = "/dev/null"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "diff --git a/%s b/%s\n", f.oldOrNew(), f.Path())
+	switch {
+	case newFile:
+		fmt.Fprintf(&b, "new file mode %s\n", orDefault(f.NewMode, "100644"))
+	case deletedFile:
+		fmt.Fprintf(&b, "deleted file mode %s\n", orDefault(f.OldMode, "100644"))
+	}
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	return b.String()
+}
+
+func (f *File) oldOrNew() string {
+	if f.OldPath != "" {
+		return f.OldPath
+	}
+	return f.NewPath
+}
+
+func firstLine(start, count int) int {
+	if count == 0 {
+		return start + 1
+	}
+	return start
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// MatchNew selects the lines of f that correspond to sel, where sel comes
+// from another diff sharing the same new side (for example the working tree).
+// Additions match by new line number and deletions by position and content.
+func MatchNew(sel []Line) func(Line) bool {
+	added := make(map[int]bool)
+	deleted := make(map[string]bool)
+	for _, l := range sel {
+		switch l.Kind {
+		case Added:
+			added[l.NewLine] = true
+		case Deleted:
+			deleted[fmt.Sprintf("%d\x00%s", l.anchor, l.Content)] = true
+		}
+	}
+	return func(l Line) bool {
+		switch l.Kind {
+		case Added:
+			return added[l.NewLine]
+		case Deleted:
+			return deleted[fmt.Sprintf("%d\x00%s", l.anchor, l.Content)]
+		}
+		return false
+	}
+}
+
+// MatchOld selects the lines of f that correspond to sel, where sel comes
+// from another diff sharing the same old side (for example the staged
+// changes seen against HEAD). Deletions match by old line number and
+// additions by the old line they follow, both along with their content.
+func MatchOld(sel []Line) func(Line) bool {
+	deleted := make(map[string]bool)
+	added := make(map[string]bool)
+	for _, l := range sel {
+		switch l.Kind {
+		case Deleted:
+			deleted[fmt.Sprintf("%d\x00%s", l.OldLine, l.Content)] = true
+		case Added:
+			added[fmt.Sprintf("%d\x00%s", l.after, l.Content)] = true
+		}
+	}
+	return func(l Line) bool {
+		switch l.Kind {
+		case Deleted:
+			return deleted[fmt.Sprintf("%d\x00%s", l.OldLine, l.Content)]
+		case Added:
+			return added[fmt.Sprintf("%d\x00%s", l.after, l.Content)]
+		}
+		return false
+	}
+}
+
+// MatchContent selects the lines of f whose kind and content appear in sel.
+// It is used when the two diffs do not share a side, so positions differ.
+func MatchContent(sel []Line) func(Line) bool {
+	want := make(map[string]int)
+	for _, l := range sel {
+		if l.Kind == Added || l.Kind == Deleted {
+			want[l.String()]++
+		}
+	}
+	used := make(map[int]bool)
+	return func(l Line) bool {
+		if used[l.index] {
+			return true
+		}
+		if want[l.String()] > 0 {
+			want[l.String()]--
+			used[l.index] = true
+			return true
+		}
+		return false
+	}
+}
+
+// Reverse swaps the sides of a patch so it can be applied forwards by tools
+// without a reverse mode.
+func Reverse(patch string) string {
+	var b strings.Builder
+	for _, f := range Parse(patch) {
+		rev := &File{
+			OldPath:     f.NewPath,
+			NewPath:     f.OldPath,
+			OldMode:     f.NewMode,
+			NewMode:     f.OldMode,
+			NewFile:     f.DeletedFile,
+			DeletedFile: f.NewFile,
+		}
+		for _, h := range f.Hunks {
+			rh := &Hunk{
+				OldStart: h.NewStart,
+				OldLines: h.NewLines,
+				NewStart: h.OldStart,
+				NewLines: h.OldLines,
+			}
+			for _, l := range h.Lines {
+				switch l.Kind {
+				case Added:
+					l.Kind = Deleted
+				case Deleted:
+					l.Kind = Added
+				}
+				rh.Lines = append(rh.Lines, l)
+			}
+			rev.Hunks = append(rev.Hunks, rh)
+		}
+		b.WriteString(rev.patchHeader(rev.NewFile, rev.DeletedFile))
+		for _, h := range rev.Hunks {
+			fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+			for _, l := range h.Lines {
+				b.WriteString(l.String() + "\n")
+				if l.NoNewline {
+					b.WriteString(`\ No newline at end of file` + "\n")
+				}
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,214 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+const patchBase = `diff --git a/f.txt b/f.txt
+--- a/f.txt
++++ b/f.txt
+@@ -1,4 +1,4 @@
+ one
+-two
++TWO
+ three
+-four
++FOUR
+`
+
+func selectContent(contents ...string) func(Line) bool {
+	want := make(map[string]bool)
+	for _, c := range contents {
+		want[c] = true
+	}
+	return func(l Line) bool { return want[l.String()] }
+}
+
+func TestPatchForward(t *testing.T) {
+	f := Parse(patchBase)[0]
+	got := f.Patch(selectContent("-two", "+TWO"), false)
+	want := `diff --git a/f.txt b/f.txt
+--- a/f.txt
++++ b/f.txt
+@@ -1,4 +1,4 @@
+ one
+-two
++TWO
+ three
+ four
+`
+	if got != want {
+		t.Errorf("Patch() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPatchReverse(t *testing.T) {
+	f := Parse(patchBase)[0]
+	got := f.Patch(selectContent("+FOUR"), true)
+	want := `diff --git a/f.txt b/f.txt
+--- a/f.txt
++++ b/f.txt
+@@ -1,3 +1,4 @@
+ one
+ TWO
+ three
++FOUR
+`
+	if got != want {
+		t.Errorf("Patch() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPatchNothingSelected(t *testing.T) {
+	f := Parse(patchBase)[0]
+	if got := f.Patch(func(Line) bool { return false }, false); got != "" {
+		t.Errorf("Patch() = %q, want empty", got)
+	}
+}
+
+func TestPatchPartialDeletion(t *testing.T) {
+	diffText := `diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+--- a/gone.txt
++++ /dev/null
+@@ -1,2 +0,0 @@
+-a
+-b
+`
+	f := Parse(diffText)[0]
+	got := f.Patch(selectContent("-a"), false)
+	want := `diff --git a/gone.txt b/gone.txt
+--- a/gone.txt
++++ b/gone.txt
+@@ -1,2 +1,1 @@
+-a
+ b
+`
+	if got != want {
+		t.Errorf("Patch() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMatchNew(t *testing.T) {
+	// The same working-tree change seen against two different bases.
+	combined := Parse(`--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`)[0]
+	unstaged := Parse(`--- a/f
++++ b/f
+@@ -1,4 +1,3 @@
+ a
+-b
++B
+ c
+-d
+`)[0]
+
+	var sel []Line
+	for _, l := range combined.Hunks[0].Lines {
+		if l.Kind == Added {
+			sel = append(sel, l)
+		}
+	}
+
+	keep := MatchNew(sel)
+	for _, l := range unstaged.Hunks[0].Lines {
+		want := l.String() == "+B"
+		if got := keep(l); got != want {
+			t.Errorf("MatchNew()(%q) = %v, want %v", l.String(), got, want)
+		}
+	}
+}
+
+func TestMatchOld(t *testing.T) {
+	// Both hunks add a closing brace. The working tree diff also has an
+	// unstaged line, so new line numbers differ from the staged diff.
+	staged := Parse(`--- a/f
++++ b/f
+@@ -1,2 +1,3 @@
+ func a() {
++}
+ x
+@@ -9,2 +10,3 @@
+ func b() {
++}
+ y
+`)[0]
+	combined := Parse(`--- a/f
++++ b/f
+@@ -1,2 +1,4 @@
++// unstaged
+ func a() {
++}
+ x
+@@ -9,2 +11,3 @@
+ func b() {
++}
+ y
+`)[0]
+
+	var sel []Line
+	for _, l := range combined.Hunks[1].Lines {
+		if l.Kind == Added {
+			sel = append(sel, l)
+		}
+	}
+
+	want := "@@ -10,2 +10,3 @@\n func b() {\n+}\n y\n"
+	if got := staged.Patch(MatchOld(sel), true); !strings.HasSuffix(got, want) || strings.Count(got, "@@ -") != 1 {
+		t.Errorf("Patch(MatchOld()) =\n%s\nwant only the second hunk:\n%s", got, want)
+	}
+}
+
+func TestReverse(t *testing.T) {
+	got := Reverse(`diff --git a/f b/f
+--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+ a
+-b
++c
+`)
+	want := `diff --git a/f b/f
+--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+ a
++b
+-c
+`
+	if got != want {
+		t.Errorf("Reverse() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPatchPartialRevertOfNewFile(t *testing.T) {
+	diffText := `diff --git a/new.txt b/new.txt
+new file mode 100644
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,3 @@
++a
++b
++c
+`
+	f := Parse(diffText)[0]
+	got := f.Patch(selectContent("+b"), true)
+	want := `diff --git a/new.txt b/new.txt
+--- a/new.txt
++++ b/new.txt
+@@ -1,2 +1,3 @@
+ a
++b
+ c
+`
+	if got != want {
+		t.Errorf("Patch() =\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,270 @@
+// Package export renders a review to a self-contained HTML file that can be
+// read without a terminal.
+package export
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/review"
+	"github.com/oug-t/difi/internal/tree"
+)
+
+// Review is the content of an exported review.
+type Review struct {
+	Title    string
+	Files    []*diff.File
+	Stats    map[string][2]int // added and deleted lines by path
+	Comments []review.Comment  // comments on the combined diff
+	Viewed   map[string]bool   // files marked as viewed
+}
+
+// HTML writes rv as a single HTML page: a file tree linking to every file,
+// then each file's diff with syntax highlighting, collapsible by file and
+// with an anchor for every hunk and line. Viewed files start collapsed.
+func HTML(w io.Writer, rv Review) error {
+	formatter := chromahtml.New(chromahtml.WithClasses(true), chromahtml.PreventSurroundingPre(true))
+	style := styles.Get("nord")
+
+	var css strings.Builder
+	if err := formatter.WriteCSS(&css, style); err != nil {
+		return err
+	}
+
+	paths := diff.Paths(rv.Files)
+	t := tree.New(paths)
+	ids := make(map[string]string)
+	for i, p := range t.Files() {
+		ids[p] = fmt.Sprintf("f%d", i+1)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s%s</style>\n</head>\n<body>\n",
+		html.EscapeString(rv.Title), pageCSS, css.String())
+	fmt.Fprintf(&b, "<header><h1>%s</h1><p class=\"meta\">%s</p></header>\n", html.EscapeString(rv.Title), summary(rv, paths))
+	b.WriteString("<div class=\"layout\">\n")
+	writeTree(&b, rv, t, ids)
+
+	b.WriteString("<main>\n")
+	for _, p := range t.Files() {
+		f := diff.Find(rv.Files, p)
+		if err := writeFile(&b, rv, f, ids[p], formatter, style); err != nil {
+			return err
+		}
+	}
+	b.WriteString("</main>\n</div>\n</body>\n</html>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// stats returns the added and deleted lines of f.
+func (rv Review) stats(f *diff.File) (added, deleted int) {
+	if s, ok := rv.Stats[f.Path()]; ok {
+		return s[0], s[1]
+	}
+	return f.Stats()
+}
+
+func summary(rv Review, paths []string) string {
+	var added, deleted, viewed int
+	for _, f := range rv.Files {
+		a, d := rv.stats(f)
+		added += a
+		deleted += d
+		if rv.Viewed[f.Path()] {
+			viewed++
+		}
+	}
+	parts := []string{
+		fmt.Sprintf("%d files", len(paths)),
+		fmt.Sprintf("<span class=\"add\">+%d</span> <span class=\"del\">-%d</span>", added, deleted),
+	}
+	if viewed > 0 {
+		parts = append(parts, fmt.Sprintf("%d/%d viewed", viewed, len(paths)))
+	}
+	if len(rv.Comments) > 0 {
+		parts = append(parts, fmt.Sprintf("%d comments", len(rv.Comments)))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// writeTree writes the file tree, each file linking to its diff.
+func writeTree(b *strings.Builder, rv Review, t *tree.FileTree, ids map[string]string) {
+	b.WriteString("<nav class=\"tree\"><ul>\n")
+	for _, item := range t.Items() {
+		ti, ok := item.(tree.TreeItem)
+		if !ok {
+			continue
+		}
+		indent := fmt.Sprintf(" style=\"padding-left:%.1fem\"", float64(ti.Depth)*1.2)
+		if ti.IsDir {
+			fmt.Fprintf(b, "<li class=\"dir\"%s>%s/</li>\n", indent, html.EscapeString(ti.Name))
+			continue
+		}
+		f := diff.Find(rv.Files, ti.FullPath)
+		added, deleted := rv.stats(f)
+		fmt.Fprintf(b, "<li%s><a href=\"#%s\">%s</a> <span class=\"add\">+%d</span> <span class=\"del\">-%d</span>%s</li>\n",
+			indent, ids[ti.FullPath], html.EscapeString(ti.Name), added, deleted, marks(rv, ti.FullPath))
+	}
+	b.WriteString("</ul></nav>\n")
+}
+
+// marks flags a file as viewed or commented on.
+func marks(rv Review, path string) string {
+	var s string
+	if commentCount(rv, path) > 0 {
+		s += " <span class=\"mark comment\" title=\"commented\">◆</span>"
+	}
+	if rv.Viewed[path] {
+		s += " <span class=\"mark viewed\" title=\"viewed\">✓</span>"
+	}
+	return s
+}
+
+func commentCount(rv Review, path string) int {
+	n := 0
+	for _, c := range rv.Comments {
+		if c.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+// writeFile writes the diff of f as a collapsible table.
+func writeFile(b *strings.Builder, rv Review, f *diff.File, id string, formatter *chromahtml.Formatter, style *chroma.Style) error {
+	open := " open"
+	if rv.Viewed[f.Path()] {
+		open = ""
+	}
+	added, deleted := rv.stats(f)
+	name := html.EscapeString(f.Path())
+	if f.OldPath != "" && f.NewPath != "" && f.OldPath != f.NewPath {
+		name = html.EscapeString(f.OldPath) + " → " + name
+	}
+	fmt.Fprintf(b, "<details class=\"file\" id=\"%s\"%s>\n<summary><a class=\"path\" href=\"#%s\">%s</a> <span class=\"add\">+%d</span> <span class=\"del\">-%d</span>%s</summary>\n",
+		id, open, id, name, added, deleted, marks(rv, f.Path()))
+
+	switch {
+	case f.Binary:
+		b.WriteString("<p class=\"empty\">Binary file not shown</p>\n</details>\n")
+		return nil
+	case len(f.Hunks) == 0:
+		b.WriteString("<p class=\"empty\">No content changes</p>\n</details>\n")
+		return nil
+	}
+
+	lexer := lexers.Match(f.Path())
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	var comments []review.Comment
+	for _, c := range rv.Comments {
+		if c.Path == f.Path() {
+			comments = append(comments, c)
+		}
+	}
+
+	b.WriteString("<table class=\"diff\">\n")
+	for h, hunk := range f.Hunks {
+		hid := fmt.Sprintf("%s-h%d", id, h+1)
+		fmt.Fprintf(b, "<tr class=\"hunk\" id=\"%s\"><td class=\"num\" colspan=\"2\"><a href=\"#%s\">⋯</a></td><td colspan=\"2\">%s</td></tr>\n",
+			hid, hid, html.EscapeString(hunk.Header))
+		for i, l := range hunk.Lines {
+			if err := writeLine(b, id, l, lexer, formatter, style); err != nil {
+				return err
+			}
+			for _, c := range comments {
+				if c.Covers(l) && !coversNext(c, hunk.Lines, i) {
+					writeComment(b, c)
+				}
+			}
+		}
+	}
+	b.WriteString("</table>\n</details>\n")
+	return nil
+}
+
+// coversNext reports whether c also covers the line after lines[i], so that
+// a comment is shown once, below the last line it covers.
+func coversNext(c review.Comment, lines []diff.Line, i int) bool {
+	return i+1 < len(lines) && c.Covers(lines[i+1])
+}
+
+func writeLine(b *strings.Builder, id string, l diff.Line, lexer chroma.Lexer, formatter *chromahtml.Formatter, style *chroma.Style) error {
+	// Deleted lines are anchored by their old line number, the rest by
+	// their new one.
+	lineID := fmt.Sprintf("%s-R%d", id, l.NewLine)
+	link := func(n int) string { return fmt.Sprintf("<a href=\"#%s\">%d</a>", lineID, n) }
+	class, sign, oldNum, newNum := "ctx", " ", fmt.Sprint(l.OldLine), link(l.NewLine)
+	switch l.Kind {
+	case diff.Added:
+		class, sign, oldNum = "add", "+", ""
+	case diff.Deleted:
+		lineID = fmt.Sprintf("%s-L%d", id, l.OldLine)
+		class, sign, oldNum, newNum = "del", "-", link(l.OldLine), ""
+	}
+
+	var code strings.Builder
+	it, err := lexer.Tokenise(nil, l.Content)
+	if err != nil {
+		code.WriteString(html.EscapeString(l.Content))
+	} else if err := formatter.Format(&code, style, it); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(b, "<tr class=\"%s\" id=\"%s\"><td class=\"num\">%s</td><td class=\"num\">%s</td><td class=\"sign\">%s</td><td class=\"code chroma\">%s</td></tr>\n",
+		class, lineID, oldNum, newNum, sign, strings.TrimSuffix(code.String(), "\n"))
+	return nil
+}
+
+func writeComment(b *strings.Builder, c review.Comment) {
+	fmt.Fprintf(b, "<tr class=\"comment\"><td colspan=\"4\"><div class=\"note\"><div class=\"lines\">%s</div>%s</div></td></tr>\n",
+		html.EscapeString(c.Lines()), html.EscapeString(strings.TrimSpace(c.Body)))
+}
+
+const pageCSS = `body { margin: 0; background: #2e3440; color: #d8dee9; font: 14px/1.5 -apple-system, "Segoe UI", sans-serif; }
+header { padding: 16px 24px; border-bottom: 1px solid #4c566a; }
+h1 { margin: 0; font-size: 20px; }
+.meta { margin: 4px 0 0; color: #8a93a5; }
+.layout { display: flex; align-items: flex-start; }
+.tree { position: sticky; top: 0; width: 260px; max-height: 100vh; overflow: auto; padding: 12px 0; border-right: 1px solid #4c566a; }
+.tree ul { list-style: none; margin: 0; padding: 0 12px; }
+.tree li { white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+.tree .dir { color: #b48ead; }
+a { color: #88c0d0; text-decoration: none; }
+a:hover { text-decoration: underline; }
+main { flex: 1; min-width: 0; padding: 12px 24px; }
+.file { margin-bottom: 16px; border: 1px solid #4c566a; border-radius: 6px; overflow: hidden; }
+.file > summary { padding: 8px 12px; background: #3b4252; cursor: pointer; font-family: ui-monospace, monospace; }
+.add { color: #a3be8c; }
+.del { color: #bf616a; }
+.mark.viewed { color: #a3be8c; }
+.mark.comment { color: #ebcb8b; }
+.empty { margin: 0; padding: 8px 12px; color: #8a93a5; }
+table.diff { width: 100%; border-collapse: collapse; font: 13px/1.45 ui-monospace, SFMono-Regular, Menlo, monospace; }
+.diff td { padding: 0 8px; vertical-align: top; }
+.diff .num { width: 1%; min-width: 3em; text-align: right; color: #616e88; user-select: none; }
+.diff .num a { color: inherit; }
+.diff .sign { width: 1%; user-select: none; }
+.diff .code { white-space: pre-wrap; word-break: break-all; tab-size: 4; }
+.diff tr.add { background: rgba(163, 190, 140, 0.15); }
+.diff tr.del { background: rgba(191, 97, 106, 0.15); }
+.diff tr.hunk td { background: #3b4252; color: #81a1c1; }
+.diff tr:target { outline: 1px solid #ebcb8b; }
+.diff tr.comment td { padding: 6px 12px; }
+.note { padding: 8px 12px; border-left: 3px solid #ebcb8b; background: #3b4252; white-space: pre-wrap; font-family: -apple-system, "Segoe UI", sans-serif; }
+.note .lines { color: #8a93a5; font-size: 12px; }
+.chroma { background: none; }
+`
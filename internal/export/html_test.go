@@ -0,0 +1,91 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/review"
+)
+
+const sample = `diff --git a/src/main.go b/src/main.go
+--- a/src/main.go
++++ b/src/main.go
+@@ -1,3 +1,3 @@
+ package main
+-var x = 1
++var x = 2
+ // <end>
+diff --git a/README.md b/README.md
+--- a/README.md
++++ b/README.md
+@@ -1 +1,2 @@
+ # difi
++More.
+`
+
+func render(t *testing.T, rv Review) string {
+	t.Helper()
+	var b strings.Builder
+	if err := HTML(&b, rv); err != nil {
+		t.Fatalf("HTML() error = %v", err)
+	}
+	return b.String()
+}
+
+func TestHTML(t *testing.T) {
+	files := diff.Parse(sample)
+	out := render(t, Review{
+		Title: "Review of HEAD",
+		Files: files,
+		Stats: map[string][2]int{"README.md": {7, 0}},
+	})
+
+	for _, want := range []string{
+		"<title>Review of HEAD</title>",
+		`<a href="#f2">README.md</a> <span class="add">+7</span>`, // stats override the parsed counts
+		`<li class="dir" style="padding-left:0.0em">src/</li>`,
+		`<details class="file" id="f1" open>`,
+		`id="f1-h1"`,
+		`<tr class="del" id="f1-L2">`,
+		`<tr class="add" id="f1-R2">`,
+		`<a href="#f1-R3">3</a>`,
+		"2 files",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output is missing %q", want)
+		}
+	}
+	if strings.Contains(out, "// <end>") {
+		t.Error("diff content is not escaped")
+	}
+	if strings.Contains(out, "/2 viewed") {
+		t.Error("summary counts viewed files when none are viewed")
+	}
+}
+
+func TestHTMLReviewState(t *testing.T) {
+	files := diff.Parse(sample)
+	c := review.NewComment("src/main.go", files[0].Hunks[0].Lines[1:3])
+	c.Body = "Why <2>?"
+	out := render(t, Review{
+		Title:    "Review",
+		Files:    files,
+		Comments: []review.Comment{c},
+		Viewed:   map[string]bool{"README.md": true},
+	})
+
+	if !strings.Contains(out, `<details class="file" id="f2">`) {
+		t.Error("viewed file is not collapsed")
+	}
+	if !strings.Contains(out, "1/2 viewed") || !strings.Contains(out, "1 comments") {
+		t.Error("summary is missing the review state")
+	}
+	if n := strings.Count(out, "Why &lt;2&gt;?"); n != 1 {
+		t.Errorf("comment rendered %d times, want once", n)
+	}
+	// The comment follows the last line it covers.
+	if strings.Index(out, "Why &lt;2&gt;?") < strings.Index(out, `id="f1-R2"`) {
+		t.Error("comment is rendered before the lines it covers")
+	}
+}
@@ -4,16 +4,14 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"regexp"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oug-t/difi/internal/diff"
 )
 
-var ansiRe = regexp.MustCompile(`[\x1b\x9b][[\\]()#;?]*(?:(?:(?:[a-zA-Z\d]*(?:;[a-zA-Z\d]*)*)?\x07)|(?:(?:\d{1,4}(?:;\d{0,4})*)?[\dA-PRZcf-ntqry=><~]))`)
-var hunkHeaderRe = regexp.MustCompile(`^.*?@@ \-\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
-
 func gitCmd(args ...string) *exec.Cmd {
 	fullArgs := append([]string{"--no-pager"}, args...)
 	cmd := exec.Command("git", fullArgs...)
@@ -29,6 +27,25 @@ func GetCurrentBranch() string {
 	return strings.TrimSpace(string(out))
 }
 
+// GetRepoRoot returns the top-level directory of the working tree.
+func GetRepoRoot() string {
+	out, err := gitCmd("rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// GetStateDir returns the directory difi keeps review state in, inside the
+// repository's git directory.
+func GetStateDir() string {
+	out, err := gitCmd("rev-parse", "--absolute-git-dir").Output()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(strings.TrimSpace(string(out)), "difi")
+}
+
 func GetRepoName() string {
 	out, err := gitCmd("rev-parse", "--show-toplevel").Output()
 	if err != nil {
@@ -42,13 +59,31 @@ func GetRepoName() string {
 	return "Repo"
 }
 
-func ListChangedFiles(targetBranch string) ([]string, error) {
-	out, err := gitCmd("diff", "--name-only", targetBranch).Output()
+// revs returns the revision arguments of git diff for base and head. An
+// empty head compares base with the working tree.
+func revs(base, head string) []string {
+	if head == "" {
+		return []string{base}
+	}
+	return []string{base, head}
+}
+
+// untrackedFiles lists untracked files, which only take part in reviews of
+// the working tree.
+func untrackedFiles(head string) ([]byte, error) {
+	if head != "" {
+		return nil, nil
+	}
+	return gitCmd("ls-files", "--others", "--exclude-standard").Output()
+}
+
+func ListChangedFiles(base, head string) ([]string, error) {
+	out, err := gitCmd(append([]string{"diff", "--name-only", "-M", "-C"}, revs(base, head)...)...).Output()
 	if err != nil {
 		return nil, err
 	}
 
-	untracked, err := gitCmd("ls-files", "--others", "--exclude-standard").Output()
+	untracked, err := untrackedFiles(head)
 	if err != nil {
 		return nil, err
 	}
@@ -68,26 +103,69 @@ func ListChangedFiles(targetBranch string) ([]string, error) {
 	return files, nil
 }
 
-func DiffCmd(targetBranch, path string) tea.Cmd {
+// DiffCmd diffs path between base and head. from is the path it was
+// renamed or copied from, or "": git only detects a rename or copy with
+// its source in the pathspec.
+func DiffCmd(base, head, path, from string, context int) tea.Cmd {
 	return func() tea.Msg {
-		out, err := gitCmd("diff", "--color=always", targetBranch, "--", path).Output()
+		args := append([]string{"diff", "--color=always", "-M", "-C", fmt.Sprintf("-U%d", context)}, revs(base, head)...)
+		paths := []string{path}
+		if from != "" {
+			paths = append(paths, from)
+		}
+		out, err := gitCmd(append(append(args, "--"), paths...)...).Output()
 		if err != nil {
 			return DiffMsg{Content: "Error fetching diff: " + err.Error()}
 		}
 
 		content := string(out)
-		if content == "" {
-			if _, err := os.Stat(path); err == nil {
-				out, _ = exec.Command("git", "diff", "--color=always", "--no-index", "/dev/null", path).Output()
-				content = string(out)
-			}
+		if content == "" && head == "" {
+			content = untrackedDiff(path, context)
 		}
 
 		return DiffMsg{Content: content}
 	}
 }
 
-func OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
+// Renames lists the files renamed or copied between base and head as
+// NUL-separated records of a status with a score, the source and the
+// destination: "R087\x00old\x00new\x00".
+func Renames(base, head string) (string, error) {
+	args := append([]string{"diff", "--name-status", "-z", "-M", "-C", "--diff-filter=RC"}, revs(base, head)...)
+	out, err := gitCmd(args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("git diff error: %w", err)
+	}
+	return string(out), nil
+}
+
+// Diff returns the uncolored diff of every file between base and head.
+func Diff(base, head string) (string, error) {
+	out, err := gitCmd(append([]string{"diff", "--no-color", "-M", "-C"}, revs(base, head)...)...).Output()
+	if err != nil {
+		return "", fmt.Errorf("git diff error: %w", err)
+	}
+	return string(out), nil
+}
+
+// DiffNoIndex diffs two files outside of any repository. git diff
+// --no-index exits with status 1 when the files differ, which is not an
+// error here.
+func DiffNoIndex(a, b string) (string, error) {
+	out, err := gitCmd("diff", "--no-index", "--no-color", "--no-ext-diff", "--", a, b).Output()
+	if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() == 1 {
+		err = nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("git diff error: %w", err)
+	}
+	return string(out), nil
+}
+
+// OpenEditorCmd opens path at lineNumber in editor, telling it the range
+// under review through DIFI_TARGET, the base, and DIFI_HEAD, the head when
+// it is not the working copy. The base of an A...B range is the merge base.
+func OpenEditorCmd(path string, lineNumber int, base, head string, editor string) tea.Cmd {
 	var args []string
 	if lineNumber > 0 {
 		args = append(args, fmt.Sprintf("+%d", lineNumber))
@@ -96,15 +174,18 @@ func OpenEditorCmd(path string, lineNumber int, targetBranch string, editor stri
 
 	c := exec.Command(editor, args...)
 	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
-	c.Env = append(os.Environ(), fmt.Sprintf("DIFI_TARGET=%s", targetBranch))
+	c.Env = append(os.Environ(), fmt.Sprintf("DIFI_TARGET=%s", base))
+	if head != "" {
+		c.Env = append(c.Env, fmt.Sprintf("DIFI_HEAD=%s", head))
+	}
 
 	return tea.ExecProcess(c, func(err error) tea.Msg {
 		return EditorFinishedMsg{Err: err}
 	})
 }
 
-func DiffStats(targetBranch string) (added int, deleted int, err error) {
-	cmd := gitCmd("diff", "--numstat", targetBranch)
+func DiffStats(base, head string) (added int, deleted int, err error) {
+	cmd := gitCmd(append([]string{"diff", "--numstat"}, revs(base, head)...)...)
 	out, err := cmd.Output()
 	if err != nil {
 		return 0, 0, fmt.Errorf("git diff stats error: %w", err)
@@ -134,121 +215,350 @@ func DiffStats(targetBranch string) (added int, deleted int, err error) {
 	return added, deleted, nil
 }
 
-func DiffStatsByFile(targetBranch string) (map[string][2]int, error) {
-	cmd := gitCmd("diff", "--numstat", targetBranch)
+// DiffStatsByFile counts added and deleted lines by path, renamed and
+// copied files by their new path. Binary files count zero lines.
+func DiffStatsByFile(base, head string) (map[string][2]int, error) {
+	cmd := gitCmd(append([]string{"diff", "--numstat", "-z", "-M", "-C"}, revs(base, head)...)...)
 	out, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("git diff numstat error: %w", err)
 	}
+	return parseNumstatZ(string(out)), nil
+}
 
+// parseNumstatZ reads git diff --numstat -z output, where a record is
+// "added\tdeleted\tpath\x00" or, for renames and copies,
+// "added\tdeleted\t\x00old\x00new\x00".
+func parseNumstatZ(out string) map[string][2]int {
 	result := make(map[string][2]int)
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-		parts := strings.Fields(line)
+	fields := strings.Split(out, "\x00")
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], "\t", 3)
 		if len(parts) < 3 {
 			continue
 		}
-		var a, d int
-		if parts[0] != "-" {
-			a, _ = strconv.Atoi(parts[0])
-		}
-		if parts[1] != "-" {
-			d, _ = strconv.Atoi(parts[1])
+		// Binary files are counted "-".
+		a, _ := strconv.Atoi(parts[0])
+		d, _ := strconv.Atoi(parts[1])
+		path := parts[2]
+		if path == "" && i+2 < len(fields) {
+			path = fields[i+2]
+			i += 2
 		}
-		filePath := strings.Join(parts[2:], " ")
-		if idx := strings.LastIndex(filePath, " => "); idx != -1 {
-			filePath = filePath[idx+4:]
+		result[path] = [2]int{a, d}
+	}
+	return result
+}
+
+type DiffMsg struct{ Content string }
+type EditorFinishedMsg struct{ Err error }
+
+// Stage adds the selected lines of path to the index. sel comes from a diff
+// whose new side is the working tree, so it is matched against the unstaged
+// diff by position.
+func Stage(path string, sel []diff.Line) error {
+	if err := gitCmd("ls-files", "--error-unmatch", "--", path).Run(); err != nil {
+		// Untracked: record an empty entry so the file shows up in git diff.
+		if out, err := gitCmd("add", "--intent-to-add", "--", path).CombinedOutput(); err != nil {
+			return fmt.Errorf("git add -N: %s", strings.TrimSpace(string(out)))
 		}
-		result[filePath] = [2]int{a, d}
 	}
-	return result, nil
+
+	out, err := gitCmd("diff", "--no-color", "--no-ext-diff", "--", path).Output()
+	if err != nil {
+		return fmt.Errorf("git diff error: %w", err)
+	}
+	f := diff.Find(diff.Parse(string(out)), path)
+	if f == nil {
+		return fmt.Errorf("nothing to stage in %s", path)
+	}
+	patch := f.Patch(diff.MatchNew(sel), false)
+	if patch == "" {
+		return fmt.Errorf("selection is already staged")
+	}
+	return applyPatch(patch, "--cached")
 }
 
-func CalculateFileLine(diffContent string, visualLineIndex int) int {
-	lines := strings.Split(diffContent, "\n")
-	if visualLineIndex >= len(lines) {
-		return 0
+// Unstage removes the selected lines of path from the index. The staged diff
+// starts at HEAD like the diffs the selection is usually taken from, so
+// lines match by position; a selection made against another base matches
+// by content instead.
+func Unstage(path string, sel []diff.Line) error {
+	out, err := gitCmd("diff", "--cached", "--no-color", "--no-ext-diff", "--", path).Output()
+	if err != nil {
+		return fmt.Errorf("git diff error: %w", err)
 	}
+	f := diff.Find(diff.Parse(string(out)), path)
+	if f == nil {
+		return fmt.Errorf("nothing staged in %s", path)
+	}
+	patch := f.Patch(diff.MatchOld(sel), true)
+	if patch == "" {
+		patch = f.Patch(diff.MatchContent(sel), true)
+	}
+	if patch == "" {
+		return fmt.Errorf("selection is not staged")
+	}
+	return applyPatch(patch, "--cached", "--reverse")
+}
 
-	currentLineNo := 0
-	lastWasHunk := false
-	inHeader := true
+// StageStates reports which paths have staged and which have unstaged
+// changes, untracked files counting as unstaged.
+func StageStates() (staged, unstaged map[string]bool, err error) {
+	staged = make(map[string]bool)
+	unstaged = make(map[string]bool)
 
-	for i := 0; i <= visualLineIndex; i++ {
-		line := lines[i]
-		matches := hunkHeaderRe.FindStringSubmatch(line)
-		if len(matches) > 1 {
-			startLine, _ := strconv.Atoi(matches[1])
-			currentLineNo = startLine
-			lastWasHunk = true
-			inHeader = false
-			continue
+	cached, err := gitCmd("diff", "--cached", "--name-only").Output()
+	if err != nil {
+		return nil, nil, err
+	}
+	worktree, err := gitCmd("diff", "--name-only").Output()
+	if err != nil {
+		return nil, nil, err
+	}
+	untracked, err := gitCmd("ls-files", "--others", "--exclude-standard").Output()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, f := range strings.Split(string(cached), "\n") {
+		if f = strings.TrimSpace(f); f != "" {
+			staged[f] = true
 		}
+	}
+	for _, f := range strings.Split(string(worktree)+"\n"+string(untracked), "\n") {
+		if f = strings.TrimSpace(f); f != "" {
+			unstaged[f] = true
+		}
+	}
+	return staged, unstaged, nil
+}
 
-		lastWasHunk = false
-		cleanLine := stripAnsi(line)
+// SectionStatuses splits the changes of the working tree into those staged
+// for the next commit, those that are not, and untracked files, mapping
+// each path to a status letter as FileStatuses does.
+func SectionStatuses() (staged, unstaged map[string]byte, untracked []string, err error) {
+	cached, err := gitCmd("diff", "--cached", "--name-status", "--no-renames").Output()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	worktree, err := gitCmd("diff", "--name-status", "--no-renames").Output()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	others, err := untrackedFiles("")
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-		if inHeader {
-			continue
+	for _, f := range strings.Split(string(others), "\n") {
+		if f = strings.TrimSpace(f); f != "" {
+			untracked = append(untracked, f)
 		}
+	}
+	return nameStatuses(string(cached)), nameStatuses(string(worktree)), untracked, nil
+}
 
-		if strings.HasPrefix(cleanLine, " ") || strings.HasPrefix(cleanLine, "+") {
-			currentLineNo++
+// nameStatuses reads the output of git diff --name-status. A renamed file
+// counts as modified and a copy as added, both under their new path; the
+// source of a rename is left out, as it is of the file list.
+func nameStatuses(out string) map[string]byte {
+	statuses := make(map[string]byte)
+	for _, line := range strings.Split(out, "\n") {
+		code, path, ok := strings.Cut(line, "\t")
+		if !ok || code == "" {
+			continue
+		}
+		switch code[0] {
+		case 'A', 'D', 'U':
+			statuses[path] = code[0]
+		case 'R':
+			_, path, _ = strings.Cut(path, "\t")
+			statuses[path] = 'M'
+		case 'C':
+			_, path, _ = strings.Cut(path, "\t")
+			statuses[path] = 'A'
+		default:
+			statuses[path] = 'M'
 		}
 	}
+	return statuses
+}
 
-	if currentLineNo == 0 {
-		return 1
-	}
-	if lastWasHunk {
-		return currentLineNo - 1
+// SectionDiffCmd loads the diff of path between HEAD and the index when
+// cached is set, or else between the index and the working tree, where an
+// untracked file is diffed against nothing.
+func SectionDiffCmd(cached bool, path string, context int) tea.Cmd {
+	return func() tea.Msg {
+		args := []string{"diff", "--color=always", fmt.Sprintf("-U%d", context)}
+		if cached {
+			args = append(args, "--cached")
+		}
+		out, err := gitCmd(append(args, "--", path)...).Output()
+		if err != nil {
+			return DiffMsg{Content: "Error fetching diff: " + err.Error()}
+		}
+
+		content := string(out)
+		if content == "" && !cached {
+			content = untrackedDiff(path, context)
+		}
+		return DiffMsg{Content: content}
 	}
-	return currentLineNo - 1
 }
 
-func stripAnsi(str string) string {
-	return ansiRe.ReplaceAllString(str, "")
+// untrackedDiff diffs the file at path, relative to the top of the working
+// tree, against nothing, which is how an untracked file is shown. It
+// returns "" when there is no such file.
+func untrackedDiff(path string, context int) string {
+	root := GetRepoRoot()
+	if _, err := os.Stat(filepath.Join(root, path)); err != nil {
+		return ""
+	}
+	cmd := gitCmd("diff", "--color=always", fmt.Sprintf("-U%d", context), "--no-index", "--", "/dev/null", path)
+	cmd.Dir = root
+	out, _ := cmd.Output()
+	return string(out)
 }
 
-type DiffMsg struct{ Content string }
-type EditorFinishedMsg struct{ Err error }
+// FileStatuses maps each changed path to a status letter: 'A' added,
+// 'M' modified, 'D' deleted, '?' untracked or 'U' unmerged.
+func FileStatuses(base, head string) (map[string]byte, error) {
+	out, err := gitCmd(append([]string{"diff", "--name-status", "-M", "-C"}, revs(base, head)...)...).Output()
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := untrackedFiles(head)
+	if err != nil {
+		return nil, err
+	}
 
-func ParseFilesFromDiff(diffText string) []string {
+	statuses := nameStatuses(string(out))
+	for _, f := range strings.Split(string(untracked), "\n") {
+		if f = strings.TrimSpace(f); f != "" {
+			statuses[f] = '?'
+		}
+	}
+	for _, f := range unmergedFiles(head) {
+		statuses[f] = 'U'
+	}
+	return statuses, nil
+}
+
+// unmergedFiles lists the files left with conflicts by a merge, rebase or
+// cherry-pick in progress. Only the working tree can have them.
+func unmergedFiles(head string) []string {
+	if head != "" {
+		return nil
+	}
+	out, err := gitCmd("ls-files", "--unmerged", "-z").Output()
+	if err != nil {
+		return nil
+	}
 	var files []string
 	seen := make(map[string]bool)
-	lines := strings.Split(diffText, "\n")
-
-	for _, line := range lines {
-		if strings.HasPrefix(line, "diff --git a/") {
-			parts := strings.SplitN(line, " b/", 2)
-			if len(parts) == 2 {
-				file := strings.TrimPrefix(parts[0], "diff --git a/")
-				if !seen[file] {
-					seen[file] = true
-					files = append(files, file)
-				}
-			}
+	for _, rec := range strings.Split(string(out), "\x00") {
+		// <mode> <object> <stage>\t<path>, once per stage.
+		if _, path, ok := strings.Cut(rec, "\t"); ok && !seen[path] {
+			seen[path] = true
+			files = append(files, path)
 		}
 	}
 	return files
 }
 
-func ExtractFileDiff(diffText, targetPath string) string {
-	lines := strings.Split(diffText, "\n")
-	var out []string
-	inTarget := false
-	targetHeader := fmt.Sprintf("diff --git a/%s b/%s", targetPath, targetPath)
+func applyPatch(patch string, args ...string) error {
+	fullArgs := append([]string{"apply", "--recount", "--whitespace=nowarn"}, args...)
+	cmd := gitCmd(append(fullArgs, "-")...)
+	cmd.Stdin = strings.NewReader(patch)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git apply: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
 
-	for _, line := range lines {
-		if strings.HasPrefix(line, "diff --git ") {
-			inTarget = strings.HasPrefix(line, targetHeader)
-		}
-		if inTarget {
-			out = append(out, line)
+// ApplyPatch applies patch to the working tree, or reverts it when reverse
+// is set.
+func ApplyPatch(patch string, reverse bool) error {
+	if reverse {
+		return applyPatch(patch, "--reverse")
+	}
+	return applyPatch(patch)
+}
+
+// MarkResolved marks the conflicts of path as resolved by staging it.
+func MarkResolved(path string) error {
+	if out, err := gitCmd("add", "--", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("git add: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// IgnoredDirs reports which of dirs, relative to the repository root, the
+// ignore rules exclude. git check-ignore exits with status 1 when none of
+// them is ignored, which is not an error here.
+func IgnoredDirs(dirs []string) (map[string]bool, error) {
+	cmd := gitCmd("check-ignore", "--stdin", "-z")
+	cmd.Dir = GetRepoRoot()
+	cmd.Stdin = strings.NewReader(strings.Join(dirs, "\x00") + "\x00")
+	out, err := cmd.Output()
+	if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() == 1 {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("git check-ignore error: %w", err)
+	}
+	ignored := make(map[string]bool)
+	for _, dir := range strings.Split(string(out), "\x00") {
+		if dir != "" {
+			ignored[dir] = true
 		}
 	}
-	return strings.Join(out, "\n")
+	return ignored, nil
+}
+
+// MergeBase returns the best common ancestor of a and b.
+func MergeBase(a, b string) (string, error) {
+	out, err := gitCmd("merge-base", a, b).Output()
+	if err != nil {
+		return "", fmt.Errorf("git merge-base error: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// EmptyTree is the hash of the empty tree, the base of a root commit.
+const EmptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// Log lists the commits reachable from head but not from base, oldest
+// first. Each commit is written as its full hash, short hash, parent
+// hashes, author, date and message, each followed by a NUL byte. An empty
+// head stands for HEAD.
+func Log(base, head string) (string, error) {
+	if head == "" {
+		head = "HEAD"
+	}
+	out, err := gitCmd("log", "--reverse", "--date=short",
+		"--format=%H%x00%h%x00%P%x00%an%x00%ad%x00%B%x00", base+".."+head).Output()
+	if err != nil {
+		return "", fmt.Errorf("git log error: %w", err)
+	}
+	return string(out), nil
+}
+
+// ShowFile returns the content of path at revision.
+func ShowFile(revision, path string) ([]byte, error) {
+	out, err := gitCmd("show", revision+":"+path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git show error: %w", err)
+	}
+	return out, nil
+}
+
+// ShowIndexFile returns the content of path as staged in the index.
+func ShowIndexFile(path string) ([]byte, error) {
+	out, err := gitCmd("show", ":"+path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git show error: %w", err)
+	}
+	return out, nil
 }
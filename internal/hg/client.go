@@ -4,16 +4,16 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oug-t/difi/internal/diff"
 )
 
 var hgRoot string
-var ansiRe = regexp.MustCompile("[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-Z\\d]*)*)?\u0007)|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PRZcf-ntqry=><~]))")
-var hunkHeaderRe = regexp.MustCompile(`^.*?@@ \-\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
 
 func getHgRoot() string {
 	if hgRoot != "" {
@@ -45,6 +45,19 @@ func GetCurrentBranch() string {
 	return strings.TrimSpace(string(out))
 }
 
+// GetRepoRoot returns the root directory of the repository.
+func GetRepoRoot() string { return getHgRoot() }
+
+// GetStateDir returns the directory difi keeps review state in, inside the
+// repository's .hg directory.
+func GetStateDir() string {
+	root := getHgRoot()
+	if root == "" {
+		return ""
+	}
+	return filepath.Join(root, ".hg", "difi")
+}
+
 func GetRepoName() string {
 	out, err := hgCmd("root").Output()
 	if err != nil {
@@ -58,15 +71,35 @@ func GetRepoName() string {
 	return "Repo"
 }
 
-func ListChangedFiles(target string) ([]string, error) {
+// revs returns the --rev arguments for base and head. An empty head
+// compares base with the working directory.
+func revs(base, head string) []string {
+	if head == "" {
+		return []string{"--rev", base}
+	}
+	return []string{"--rev", base, "--rev", head}
+}
+
+// unknownFiles lists untracked files, which only take part in reviews of the
+// working directory.
+func unknownFiles(head string, args ...string) ([]byte, error) {
+	if head != "" {
+		return nil, nil
+	}
+	return hgCmd(append([]string{"status", "--unknown"}, args...)...).Output()
+}
+
+func ListChangedFiles(base, head string) ([]string, error) {
+	base = pendingBase(base, head)
 	// m: modified, a: added, r: removed, d: deleted
-	out, err := hgCmd("status", "--rev", target, "-mard", "--no-status").Output()
+	args := append([]string{"status"}, revs(base, head)...)
+	out, err := hgCmd(append(args, "-mard", "--no-status")...).Output()
 	if err != nil {
 		return nil, err
 	}
 
 	// u: unknown (untracked)
-	untracked, err := hgCmd("status", "--unknown", "--no-status").Output()
+	untracked, err := unknownFiles(head, "--no-status")
 	if err != nil {
 		return nil, err
 	}
@@ -85,15 +118,30 @@ func ListChangedFiles(target string) ([]string, error) {
 	return files, nil
 }
 
-func DiffCmd(target, path string) tea.Cmd {
+// diffArgs returns the hg diff arguments for path between base and head.
+// The diff compares base with head or the working directory, like the
+// hg status the file list comes from, rather than showing what base itself
+// changed as --change would; discarding and staging apply it to the
+// working copy. from, the path a renamed or copied file came from, is
+// diffed along with it so the rename shows.
+func diffArgs(base, head, path, from string, context int) []string {
+	args := append([]string{"diff", "--git", "-U", strconv.Itoa(context)}, revs(base, head)...)
+	args = append(args, path)
+	if from != "" {
+		args = append(args, from)
+	}
+	return args
+}
+
+func DiffCmd(base, head, path, from string, context int) tea.Cmd {
 	return func() tea.Msg {
-		out, err := hgCmd("diff", "--change", target, path).Output()
+		out, err := hgCmd(diffArgs(pendingBase(base, head), head, path, from, context)...).Output()
 		if err != nil {
 			return DiffMsg{Content: "Error: " + err.Error()}
 		}
 
 		content := string(out)
-		if content == "" {
+		if content == "" && head == "" {
 			if _, err := os.Stat(path); err == nil {
 				/* diff untracked file as full addition */
 				out, _ = exec.Command("hg", "diff", "--git", "/dev/null", path).Output()
@@ -104,7 +152,18 @@ func DiffCmd(target, path string) tea.Cmd {
 	}
 }
 
-func OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
+// Diff returns the diff of every file between base and head.
+func Diff(base, head string) (string, error) {
+	out, err := hgCmd(append([]string{"diff", "--git"}, revs(pendingBase(base, head), head)...)...).Output()
+	if err != nil {
+		return "", fmt.Errorf("hg diff error: %w", err)
+	}
+	return string(out), nil
+}
+
+// OpenEditorCmd opens path at lineNumber in editor with DIFI_TARGET set to
+// base and, unless it is the working copy, DIFI_HEAD to head.
+func OpenEditorCmd(path string, lineNumber int, base, head string, editor string) tea.Cmd {
 	var args []string
 	if lineNumber > 0 {
 		args = append(args, fmt.Sprintf("+%d", lineNumber))
@@ -117,20 +176,18 @@ func OpenEditorCmd(path string, lineNumber int, targetBranch string, editor stri
 		c.Dir = root
 	}
 
-	c.Env = append(os.Environ(), fmt.Sprintf("DIFI_TARGET=%s", targetBranch))
+	c.Env = append(os.Environ(), fmt.Sprintf("DIFI_TARGET=%s", base))
+	if head != "" {
+		c.Env = append(c.Env, fmt.Sprintf("DIFI_HEAD=%s", head))
+	}
 
 	return tea.ExecProcess(c, func(err error) tea.Msg {
 		return EditorFinishedMsg{Err: err}
 	})
 }
 
-func DiffStats(targetBranch string) (added int, deleted int, err error) {
-	var cmd *exec.Cmd
-	if targetBranch == "tip" || targetBranch == "." || targetBranch == "" {
-		cmd = hgCmd("diff", "--stat")
-	} else {
-		cmd = hgCmd("diff", "--rev", targetBranch, "--stat")
-	}
+func DiffStats(base, head string) (added int, deleted int, err error) {
+	cmd := statCmd(base, head)
 
 	out, err := cmd.Output()
 	if err != nil {
@@ -159,13 +216,17 @@ func DiffStats(targetBranch string) (added int, deleted int, err error) {
 	return added, deleted, nil
 }
 
-func DiffStatsByFile(targetBranch string) (map[string][2]int, error) {
-	var cmd *exec.Cmd
-	if targetBranch == "tip" || targetBranch == "." || targetBranch == "" {
-		cmd = hgCmd("diff", "--stat")
-	} else {
-		cmd = hgCmd("diff", "--rev", targetBranch, "--stat")
+// statCmd builds the hg diff --stat command for base and head.
+func statCmd(base, head string) *exec.Cmd {
+	base = pendingBase(base, head)
+	if head == "" && (base == "tip" || base == "." || base == "") {
+		return hgCmd("diff", "--stat")
 	}
+	return hgCmd(append(append([]string{"diff"}, revs(base, head)...), "--stat")...)
+}
+
+func DiffStatsByFile(base, head string) (map[string][2]int, error) {
+	cmd := statCmd(base, head)
 
 	out, err := cmd.Output()
 	if err != nil {
@@ -199,88 +260,310 @@ func DiffStatsByFile(targetBranch string) (map[string][2]int, error) {
 	return result, nil
 }
 
-func CalculateFileLine(diffContent string, visualLineIndex int) int {
-	lines := strings.Split(diffContent, "\n")
-	if visualLineIndex >= len(lines) {
-		return 0
+type DiffMsg struct{ Content string }
+type EditorFinishedMsg struct{ Err error }
+
+// pendingMessage marks the secret commit hg staging records into. It plays
+// the role of git's index: staged changes live in it and the working copy
+// holds the rest. It becomes the parent of the working directory until it
+// is committed for real or everything in it is unstaged.
+const pendingMessage = "difi: pending"
+
+func hasPendingCommit() bool {
+	out, err := hgCmd("log", "-r", ".", "-T", "{phase} {desc}").Output()
+	return err == nil && string(out) == "secret "+pendingMessage
+}
+
+// pendingBase returns the revision a review of the working directory
+// starts from. The pending commit holds staged changes rather than history,
+// so a base that resolves to it stands for its parent, and the review keeps
+// showing what is staged.
+func pendingBase(base, head string) string {
+	if head != "" || base == "" {
+		return base
 	}
+	out, err := hgCmd("log", "-r", fmt.Sprintf("(%s) and . and secret()", base), "-T", "{desc}").Output()
+	if err == nil && string(out) == pendingMessage {
+		return "p1(.)"
+	}
+	return base
+}
 
-	currentLineNo := 0
-	lastWasHunk := false
-	inHeader := true
+// emptiesPending reports whether the working copy of path matches the
+// parent of the pending commit while path is the only file in it, so that
+// recording it would leave the pending commit empty.
+func emptiesPending(path string) bool {
+	out, err := hgCmd("status", "--change", ".", "--no-status").Output()
+	if err != nil || strings.TrimSpace(string(out)) != path {
+		return false
+	}
+	out, err = hgCmd("status", "--rev", "p1(.)", path).Output()
+	return err == nil && strings.TrimSpace(string(out)) == ""
+}
 
-	for i := 0; i <= visualLineIndex; i++ {
-		line := lines[i]
-		matches := hunkHeaderRe.FindStringSubmatch(line)
-		if len(matches) > 1 {
-			startLine, _ := strconv.Atoi(matches[1])
-			currentLineNo = startLine
-			lastWasHunk = true
-			inHeader = false
-			continue
+// Stage records the selected lines of path into the pending commit, the way
+// hg commit --interactive does: the file is reset to its parent, the chosen
+// changes are applied and committed, and the working copy is put back.
+func Stage(path string, sel []diff.Line) error {
+	if out, _ := hgCmd("status", "--unknown", "--no-status", path).Output(); strings.TrimSpace(string(out)) != "" {
+		if out, err := hgCmd("add", path).CombinedOutput(); err != nil {
+			return fmt.Errorf("hg add: %s", strings.TrimSpace(string(out)))
 		}
+	}
 
-		lastWasHunk = false
-		cleanLine := stripAnsi(line)
+	out, err := hgCmd("diff", "--git", path).Output()
+	if err != nil {
+		return fmt.Errorf("hg diff error: %w", err)
+	}
+	f := diff.Find(diff.Parse(string(out)), path)
+	if f == nil {
+		return fmt.Errorf("nothing to stage in %s", path)
+	}
+	patch := f.Patch(diff.MatchNew(sel), false)
+	if patch == "" {
+		return fmt.Errorf("selection is already staged")
+	}
+	return recordPending(path, patch, f.NewFile)
+}
 
-		if inHeader {
-			continue
+// Unstage takes the selected lines of path back out of the pending commit.
+// The pending commit starts at the same parent as the diffs the selection
+// is usually taken from, so lines match by position, falling back to
+// content for a selection made against another base.
+func Unstage(path string, sel []diff.Line) error {
+	if !hasPendingCommit() {
+		return fmt.Errorf("nothing staged in %s", path)
+	}
+	out, err := hgCmd("diff", "--git", "--change", ".", path).Output()
+	if err != nil {
+		return fmt.Errorf("hg diff error: %w", err)
+	}
+	f := diff.Find(diff.Parse(string(out)), path)
+	if f == nil {
+		return fmt.Errorf("nothing staged in %s", path)
+	}
+	patch := f.Patch(diff.MatchOld(sel), true)
+	if patch == "" {
+		patch = f.Patch(diff.MatchContent(sel), true)
+	}
+	if patch == "" {
+		return fmt.Errorf("selection is not staged")
+	}
+	return recordPending(path, diff.Reverse(patch), false)
+}
+
+// recordPending applies patch to the committed version of path and folds the
+// result into the pending commit, restoring the working file afterwards.
+func recordPending(path, patch string, isNew bool) (err error) {
+	full := filepath.Join(getHgRoot(), path)
+	backup, readErr := os.ReadFile(full)
+	info, statErr := os.Stat(full)
+	defer func() {
+		if readErr != nil {
+			return
+		}
+		mode := os.FileMode(0644)
+		if statErr == nil {
+			mode = info.Mode()
 		}
+		if werr := os.WriteFile(full, backup, mode); werr != nil && err == nil {
+			err = werr
+		}
+	}()
+
+	if out, err := hgCmd("revert", "--no-backup", "-r", ".", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("hg revert: %s", strings.TrimSpace(string(out)))
+	}
+	if isNew {
+		_ = os.Remove(full)
+	}
 
-		if strings.HasPrefix(cleanLine, " ") || strings.HasPrefix(cleanLine, "+") {
-			currentLineNo++
+	imp := hgCmd("import", "--no-commit", "--force", "-")
+	imp.Stdin = strings.NewReader(patch)
+	if out, err := imp.CombinedOutput(); err != nil {
+		return fmt.Errorf("hg import: %s", strings.TrimSpace(string(out)))
+	}
+
+	pending := hasPendingCommit()
+	if pending && emptiesPending(path) {
+		// Unstaging the last change drops the pending commit instead of
+		// leaving an empty one in the history.
+		strip := hgCmd("--config", "extensions.strip=", "strip", "--keep", "--no-backup", "-r", ".")
+		if out, err := strip.CombinedOutput(); err != nil {
+			return fmt.Errorf("hg strip: %s", strings.TrimSpace(string(out)))
 		}
+		return nil
 	}
 
-	if currentLineNo == 0 {
-		return 1
+	args := []string{"commit", "--config", "phases.new-commit=secret", "-m", pendingMessage}
+	if pending {
+		args = append(args, "--amend")
 	}
-	if lastWasHunk {
-		return currentLineNo - 1
+	if out, err := hgCmd(append(args, path)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("hg commit: %s", strings.TrimSpace(string(out)))
 	}
-	return currentLineNo - 1
+	return nil
 }
 
-func stripAnsi(str string) string {
-	return ansiRe.ReplaceAllString(str, "")
+// StageStates reports which paths are in the pending commit and which have
+// changes left in the working copy.
+func StageStates() (staged, unstaged map[string]bool, err error) {
+	staged = make(map[string]bool)
+	unstaged = make(map[string]bool)
+
+	if hasPendingCommit() {
+		out, err := hgCmd("status", "--change", ".", "--no-status").Output()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, f := range strings.Split(string(out), "\n") {
+			if f = strings.TrimSpace(f); f != "" {
+				staged[f] = true
+			}
+		}
+	}
+
+	out, err := hgCmd("status", "-mardu", "--no-status").Output()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range strings.Split(string(out), "\n") {
+		if f = strings.TrimSpace(f); f != "" {
+			unstaged[f] = true
+		}
+	}
+	return staged, unstaged, nil
 }
 
-type DiffMsg struct{ Content string }
-type EditorFinishedMsg struct{ Err error }
+// FileStatuses maps each changed path to a status letter: 'A' added,
+// 'M' modified, 'D' deleted, '?' untracked or 'U' unresolved in a merge.
+func FileStatuses(base, head string) (map[string]byte, error) {
+	out, err := hgCmd(append(append([]string{"status"}, revs(pendingBase(base, head), head)...), "-mard")...).Output()
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := unknownFiles(head)
+	if err != nil {
+		return nil, err
+	}
 
-func ParseFilesFromDiff(diffText string) []string {
-	var files []string
-	seen := make(map[string]bool)
-	lines := strings.Split(diffText, "\n")
+	statuses := make(map[string]byte)
+	for _, line := range strings.Split(string(out)+"\n"+string(untracked), "\n") {
+		if len(line) < 3 {
+			continue
+		}
+		path := line[2:]
+		switch line[0] {
+		case 'A', '?':
+			statuses[path] = line[0]
+		case 'R', '!':
+			statuses[path] = 'D'
+		default:
+			statuses[path] = 'M'
+		}
+	}
+	for _, path := range unresolvedFiles(head) {
+		statuses[path] = 'U'
+	}
+	return statuses, nil
+}
 
-	for _, line := range lines {
-		if strings.HasPrefix(line, "diff -r ") {
-			parts := strings.Fields(line)
-			if len(parts) >= 3 {
-				file := parts[len(parts)-1]
-				if !seen[file] {
-					seen[file] = true
-					files = append(files, file)
-				}
-			}
+// unresolvedFiles lists the files of an uncommitted merge that still have
+// conflicts. Only the working directory can have them.
+func unresolvedFiles(head string) []string {
+	if head != "" {
+		return nil
+	}
+	out, err := hgCmd("resolve", "--list").Output()
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "U ") {
+			files = append(files, line[2:])
 		}
 	}
 	return files
 }
 
-func ExtractFileDiff(diffText, targetPath string) string {
-	lines := strings.Split(diffText, "\n")
-	var out []string
-	inTarget := false
+// MarkResolved marks the conflicts of path as resolved.
+func MarkResolved(path string) error {
+	if out, err := hgCmd("resolve", "--mark", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("hg resolve: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
 
-	for _, line := range lines {
-		if strings.HasPrefix(line, "diff -r ") {
-			parts := strings.Fields(line)
-			inTarget = len(parts) > 0 && parts[len(parts)-1] == targetPath
+// IgnoredDirs reports which of dirs, relative to the repository root,
+// .hgignore excludes.
+func IgnoredDirs(dirs []string) (map[string]bool, error) {
+	out, err := hgCmd(append([]string{"debugignore", "--"}, dirs...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("hg debugignore error: %w", err)
+	}
+	ignored := make(map[string]bool)
+	for _, line := range strings.Split(string(out), "\n") {
+		// "dir is ignored" or "dir is ignored because of containing
+		// directory parent"; the rule follows on its own line.
+		if dir, _, ok := strings.Cut(line, " is ignored"); ok {
+			ignored[dir] = true
 		}
-		if inTarget {
-			out = append(out, line)
+	}
+	return ignored, nil
+}
+
+// MergeBase returns the common ancestor of a and b.
+func MergeBase(a, b string) (string, error) {
+	out, err := hgCmd("log", "-r", fmt.Sprintf("ancestor(%s, %s)", a, b), "-T", "{node}").Output()
+	if err != nil {
+		return "", fmt.Errorf("hg ancestor error: %w", err)
+	}
+	node := strings.TrimSpace(string(out))
+	if node == "" {
+		return "", fmt.Errorf("%s and %s share no history", a, b)
+	}
+	return node, nil
+}
+
+// Log lists the changesets that are ancestors of head but not of base,
+// oldest first, in the NUL-separated layout of git.Log. An empty head
+// stands for the working directory's parent.
+func Log(base, head string) (string, error) {
+	if head == "" {
+		head = "."
+		if hasPendingCommit() {
+			head = "p1(.)"
 		}
 	}
-	return strings.Join(out, "\n")
+	revset := fmt.Sprintf("sort(only(%s, %s), rev)", head, pendingBase(base, ""))
+	out, err := hgCmd("log", "-r", revset,
+		"-T", `{node}\0{node|short}\0{p1node}\0{author|person}\0{date|shortdate}\0{desc}\0`).Output()
+	if err != nil {
+		return "", fmt.Errorf("hg log error: %w", err)
+	}
+	return string(out), nil
+}
+
+// ApplyPatch applies patch to the working copy, or reverts it when reverse
+// is set. hg import has no reverse mode, so the patch is flipped first.
+func ApplyPatch(patch string, reverse bool) error {
+	if reverse {
+		patch = diff.Reverse(patch)
+	}
+	cmd := hgCmd("import", "--no-commit", "--force", "-")
+	cmd.Stdin = strings.NewReader(patch)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("hg import: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ShowFile returns the content of path at revision.
+func ShowFile(revision, path string) ([]byte, error) {
+	out, err := hgCmd("cat", "-r", revision, path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("hg cat error: %w", err)
+	}
+	return out, nil
 }
@@ -0,0 +1,330 @@
+package jj
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oug-t/difi/internal/diff"
+)
+
+var jjRoot string
+
+func getJjRoot() string {
+	if jjRoot != "" {
+		return jjRoot
+	}
+	out, err := exec.Command("jj", "root", "--ignore-working-copy").Output()
+	if err == nil {
+		jjRoot = strings.TrimSpace(string(out))
+	}
+	return jjRoot
+}
+
+func jjCmd(args ...string) *exec.Cmd {
+	fullArgs := append([]string{"--no-pager"}, args...)
+	cmd := exec.Command("jj", fullArgs...)
+	if root := getJjRoot(); root != "" {
+		cmd.Dir = root
+	}
+	return cmd
+}
+
+// GetCurrentBranch returns the bookmarks on the working-copy change, or its
+// short change id when it has none.
+func GetCurrentBranch() string {
+	out, err := jjCmd("log", "-r", "@", "--no-graph", "--color=never", "--ignore-working-copy",
+		"-T", `if(bookmarks, bookmarks.join(" "), change_id.short())`).Output()
+	if err != nil {
+		return "@"
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// GetRepoRoot returns the root directory of the workspace.
+func GetRepoRoot() string { return getJjRoot() }
+
+// GetStateDir returns the directory difi keeps review state in, inside the
+// repository's .jj directory.
+func GetStateDir() string {
+	root := getJjRoot()
+	if root == "" {
+		return ""
+	}
+	return filepath.Join(root, ".jj", "difi")
+}
+
+func GetRepoName() string {
+	root := getJjRoot()
+	if root == "" {
+		return "Repo"
+	}
+	return filepath.Base(root)
+}
+
+// toRev returns the --to revision for head, the working-copy change when
+// head is empty.
+func toRev(head string) string {
+	if head == "" {
+		return "@"
+	}
+	return head
+}
+
+func ListChangedFiles(base, head string) ([]string, error) {
+	out, err := jjCmd("diff", "--from", base, "--to", toRev(head), "--name-only", "--color=never").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if f := strings.TrimSpace(line); f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// DiffCmd diffs path between base and head, along with from, the path it
+// was renamed or copied from, when there is one.
+func DiffCmd(base, head, path, from string, context int) tea.Cmd {
+	return func() tea.Msg {
+		args := []string{"diff", "--from", base, "--to", toRev(head), "--git", "--color=always",
+			"--context", strconv.Itoa(context), filesetFor(path)}
+		if from != "" {
+			args = append(args, filesetFor(from))
+		}
+		out, err := jjCmd(args...).Output()
+		if err != nil {
+			return DiffMsg{Content: "Error fetching diff: " + err.Error()}
+		}
+		return DiffMsg{Content: string(out)}
+	}
+}
+
+// Diff returns the uncolored diff of every file between base and head.
+func Diff(base, head string) (string, error) {
+	out, err := jjCmd("diff", "--from", base, "--to", toRev(head), "--git", "--color=never").Output()
+	if err != nil {
+		return "", fmt.Errorf("jj diff error: %w", err)
+	}
+	return string(out), nil
+}
+
+// OpenEditorCmd opens path at lineNumber in editor with DIFI_TARGET set to
+// base and, unless it is the working copy, DIFI_HEAD to head.
+func OpenEditorCmd(path string, lineNumber int, base, head string, editor string) tea.Cmd {
+	var args []string
+	if lineNumber > 0 {
+		args = append(args, fmt.Sprintf("+%d", lineNumber))
+	}
+	args = append(args, path)
+
+	c := exec.Command(editor, args...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if root := getJjRoot(); root != "" {
+		c.Dir = root
+	}
+
+	c.Env = append(os.Environ(), fmt.Sprintf("DIFI_TARGET=%s", base))
+	if head != "" {
+		c.Env = append(c.Env, fmt.Sprintf("DIFI_HEAD=%s", head))
+	}
+
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		return EditorFinishedMsg{Err: err}
+	})
+}
+
+func DiffStats(base, head string) (added int, deleted int, err error) {
+	byFile, err := DiffStatsByFile(base, head)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, s := range byFile {
+		added += s[0]
+		deleted += s[1]
+	}
+	return added, deleted, nil
+}
+
+func DiffStatsByFile(base, head string) (map[string][2]int, error) {
+	out, err := jjCmd("diff", "--from", base, "--to", toRev(head), "--git", "--color=never").Output()
+	if err != nil {
+		return nil, fmt.Errorf("jj diff stats error: %w", err)
+	}
+	return statsFromDiff(string(out)), nil
+}
+
+func statsFromDiff(diffText string) map[string][2]int {
+	result := make(map[string][2]int)
+	for _, f := range diff.Parse(diffText) {
+		added, deleted := f.Stats()
+		result[f.Path()] = [2]int{added, deleted}
+	}
+	return result
+}
+
+// FileStatuses maps each changed path to a status letter: 'A' added,
+// 'M' modified, 'D' deleted or 'U' conflicted. jj snapshots new files, so
+// none is untracked.
+func FileStatuses(base, head string) (map[string]byte, error) {
+	out, err := jjCmd("diff", "--from", base, "--to", toRev(head), "--git", "--color=never").Output()
+	if err != nil {
+		return nil, fmt.Errorf("jj diff status error: %w", err)
+	}
+	statuses := make(map[string]byte)
+	for _, f := range diff.Parse(string(out)) {
+		switch {
+		case f.NewFile:
+			statuses[f.Path()] = 'A'
+		case f.DeletedFile:
+			statuses[f.Path()] = 'D'
+		default:
+			statuses[f.Path()] = 'M'
+		}
+	}
+	for _, path := range conflictedFiles(head) {
+		statuses[path] = 'U'
+	}
+	return statuses, nil
+}
+
+// conflictLineRe matches a line of jj resolve --list, such as
+// "src/main.go    2-sided conflict".
+var conflictLineRe = regexp.MustCompile(`^(.+?)\s+\d+-sided conflict`)
+
+// conflictedFiles lists the files with unresolved conflicts in head. jj
+// exits with an error when there are none.
+func conflictedFiles(head string) []string {
+	out, err := jjCmd("resolve", "--list", "-r", toRev(head), "--color=never").Output()
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if m := conflictLineRe.FindStringSubmatch(line); m != nil {
+			files = append(files, m[1])
+		}
+	}
+	return files
+}
+
+// MarkResolved does nothing: jj records a conflict as resolved once the
+// working copy is snapshotted without its markers.
+func MarkResolved(path string) error { return nil }
+
+// IgnoredDirs reports which of dirs, relative to the repository root, are
+// ignored. jj follows the .gitignore files and the excludes of its backing
+// git repository, so git check-ignore is asked against that repository.
+// It exits with status 1 when none of them is ignored. Without git or a
+// git backend this fails, and the caller watches every directory.
+func IgnoredDirs(dirs []string) (map[string]bool, error) {
+	gitDir, err := jjCmd("git", "root").Output()
+	if err != nil {
+		return nil, fmt.Errorf("jj git root error: %w", err)
+	}
+	root := getJjRoot()
+	cmd := exec.Command("git", "--git-dir", strings.TrimSpace(string(gitDir)), "--work-tree", root,
+		"check-ignore", "--stdin", "-z")
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader(strings.Join(dirs, "\x00") + "\x00")
+	out, err := cmd.Output()
+	if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() == 1 {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("git check-ignore error: %w", err)
+	}
+	ignored := make(map[string]bool)
+	for _, dir := range strings.Split(string(out), "\x00") {
+		if dir != "" {
+			ignored[dir] = true
+		}
+	}
+	return ignored, nil
+}
+
+// MergeBase returns the commit id of the closest common ancestor of a and b.
+func MergeBase(a, b string) (string, error) {
+	revset := fmt.Sprintf("heads(::(%s) & ::(%s))", a, b)
+	out, err := jjCmd("log", "-r", revset, "--no-graph", "--color=never", "--ignore-working-copy",
+		"-T", `commit_id ++ "\n"`).Output()
+	if err != nil {
+		return "", fmt.Errorf("jj merge base error: %w", err)
+	}
+	id, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if id == "" {
+		return "", fmt.Errorf("%s and %s share no history", a, b)
+	}
+	return id, nil
+}
+
+// Log lists the commits that are ancestors of head but not of base, oldest
+// first, in the NUL-separated layout of git.Log.
+func Log(base, head string) (string, error) {
+	revset := fmt.Sprintf("(%s)..(%s)", base, toRev(head))
+	out, err := jjCmd("log", "-r", revset, "--reversed", "--no-graph", "--color=never", "--ignore-working-copy",
+		"-T", `commit_id ++ "\0" ++ commit_id.short() ++ "\0" ++ parents.map(|c| c.commit_id()).join(" ") ++ "\0" ++ author.name() ++ "\0" ++ author.timestamp().format("%Y-%m-%d") ++ "\0" ++ description ++ "\0"`).Output()
+	if err != nil {
+		return "", fmt.Errorf("jj log error: %w", err)
+	}
+	return string(out), nil
+}
+
+// filesetFor quotes a repository-relative path as an exact jj fileset so
+// names containing spaces or fileset operators are taken literally.
+func filesetFor(path string) string {
+	return fmt.Sprintf("root-file:%q", path)
+}
+
+type DiffMsg struct{ Content string }
+type EditorFinishedMsg struct{ Err error }
+
+// errNoIndex is returned for staging requests: jj snapshots the working copy
+// into the current change, so there is no index to move lines into.
+var errNoIndex = errors.New("jj has no staging area; use jj split or jj squash -i")
+
+func Stage(path string, sel []diff.Line) error   { return errNoIndex }
+func Unstage(path string, sel []diff.Line) error { return errNoIndex }
+
+// ApplyPatch applies patch to the working copy, or reverts it when reverse
+// is set. jj has no patch command, so this needs git on the PATH. git apply
+// works on any directory, colocated with a git repository or not, and jj
+// snapshots the result on its next run. Git is kept from looking for a
+// repository above the workspace, which would change how paths resolve.
+func ApplyPatch(patch string, reverse bool) error {
+	args := []string{"apply", "--recount", "--whitespace=nowarn"}
+	if reverse {
+		args = append(args, "--reverse")
+	}
+	root := getJjRoot()
+	cmd := exec.Command("git", append(args, "-")...)
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "GIT_CEILING_DIRECTORIES="+filepath.Dir(root))
+	cmd.Stdin = strings.NewReader(patch)
+	out, err := cmd.CombinedOutput()
+	switch {
+	case err != nil && len(out) == 0:
+		return fmt.Errorf("git apply: %w", err)
+	case err != nil:
+		return fmt.Errorf("git apply: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ShowFile returns the content of path at revision.
+func ShowFile(revision, path string) ([]byte, error) {
+	out, err := jjCmd("file", "show", "-r", revision, filesetFor(path)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("jj file show error: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,75 @@
+package jj
+
+import "testing"
+
+func TestStatsFromDiff(t *testing.T) {
+	diffText := `diff --git a/src/lib.rs b/src/lib.rs
+index 1111111..2222222 100644
+--- a/src/lib.rs
++++ b/src/lib.rs
+@@ -1,2 +1,3 @@
+-fn a() {}
++fn b() {}
++fn c() {}
+ fn d() {}
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+index 3333333..0000000
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`
+
+	got := statsFromDiff(diffText)
+	want := map[string][2]int{
+		"src/lib.rs": {2, 1},
+		"gone.txt":   {0, 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("statsFromDiff() returned %d files, want %d", len(got), len(want))
+	}
+	for path, w := range want {
+		if got[path] != w {
+			t.Errorf("statsFromDiff()[%q] = %v, want %v", path, got[path], w)
+		}
+	}
+}
+
+func TestFilesetFor(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"main.go", `root-file:"main.go"`},
+		{"dir/with space.txt", `root-file:"dir/with space.txt"`},
+		{`we"ird`, `root-file:"we\"ird"`},
+	}
+
+	for _, tt := range tests {
+		if got := filesetFor(tt.path); got != tt.expected {
+			t.Errorf("filesetFor(%q) = %q, want %q", tt.path, got, tt.expected)
+		}
+	}
+}
+
+func TestConflictLineRe(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"src/main.go    2-sided conflict", "src/main.go"},
+		{"dir/with space.txt    3-sided conflict including 1 deletion", "dir/with space.txt"},
+		{"Error: No conflicts found at this revision", ""},
+	}
+
+	for _, tt := range tests {
+		got := ""
+		if m := conflictLineRe.FindStringSubmatch(tt.line); m != nil {
+			got = m[1]
+		}
+		if got != tt.expected {
+			t.Errorf("conflictLineRe on %q = %q, want %q", tt.line, got, tt.expected)
+		}
+	}
+}
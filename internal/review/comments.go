@@ -0,0 +1,249 @@
+package review
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// commentsFile is the name of the file recording review comments.
+const commentsFile = "comments.json"
+
+// Comment is a note left on a range of diff lines. Line numbers refer to
+// the old and new side of the diff; a side the lines do not touch is zero.
+type Comment struct {
+	ID       string    `json:"id"`
+	Path     string    `json:"path"`
+	Commit   string    `json:"commit,omitempty"` // commit reviewed in commit mode
+	OldStart int       `json:"old_start,omitempty"`
+	OldEnd   int       `json:"old_end,omitempty"`
+	NewStart int       `json:"new_start,omitempty"`
+	NewEnd   int       `json:"new_end,omitempty"`
+	Snippet  string    `json:"snippet"` // the commented diff lines
+	Body     string    `json:"body"`
+	Created  time.Time `json:"created"`
+}
+
+// NewComment returns an empty comment on lines of path, hunk headers
+// excluded.
+func NewComment(path string, lines []diff.Line) Comment {
+	c := Comment{Path: path}
+	var snippet []string
+	for _, l := range lines {
+		if l.Kind == diff.HunkHeader {
+			continue
+		}
+		if l.Kind != diff.Added {
+			c.OldStart, c.OldEnd = extend(c.OldStart, c.OldEnd, l.OldLine)
+		}
+		if l.Kind != diff.Deleted {
+			c.NewStart, c.NewEnd = extend(c.NewStart, c.NewEnd, l.NewLine)
+		}
+		snippet = append(snippet, ansi.Strip(l.String()))
+	}
+	c.Snippet = strings.Join(snippet, "\n")
+	return c
+}
+
+func extend(start, end, n int) (int, int) {
+	if n <= 0 {
+		return start, end
+	}
+	if start == 0 || n < start {
+		start = n
+	}
+	return start, max(end, n)
+}
+
+// Covers reports whether l is one of the commented lines.
+func (c Comment) Covers(l diff.Line) bool {
+	switch l.Kind {
+	case diff.HunkHeader:
+		return false
+	case diff.Added:
+		return within(l.NewLine, c.NewStart, c.NewEnd)
+	case diff.Deleted:
+		return within(l.OldLine, c.OldStart, c.OldEnd)
+	}
+	return within(l.NewLine, c.NewStart, c.NewEnd) || within(l.OldLine, c.OldStart, c.OldEnd)
+}
+
+func within(n, start, end int) bool {
+	return start > 0 && n >= start && n <= end
+}
+
+// Lines describes the commented lines, such as "L10-L12", preferring the
+// new side of the diff and falling back to "old L4" for deleted lines.
+func (c Comment) Lines() string {
+	start, end, prefix := c.NewStart, c.NewEnd, ""
+	if start == 0 {
+		start, end, prefix = c.OldStart, c.OldEnd, "old "
+	}
+	if start == end {
+		return fmt.Sprintf("%sL%d", prefix, start)
+	}
+	return fmt.Sprintf("%sL%d-L%d", prefix, start, end)
+}
+
+// Target returns the key comments on the review of r are saved under. A
+// patch read from standard input is keyed by its content.
+func Target(r vcs.Range, patch string) string {
+	if patch != "" {
+		return "patch " + Hash([]byte(patch))[:12]
+	}
+	return r.String()
+}
+
+// Comments holds the comments of every review target, one of which is
+// being worked on.
+type Comments struct {
+	path    string // file the comments are saved to, empty to keep them in memory
+	target  string
+	targets map[string][]Comment
+}
+
+// LoadComments reads the comments saved in dir and selects those on target.
+// An empty dir keeps the comments in memory only.
+func LoadComments(dir, target string) *Comments {
+	c := &Comments{target: target}
+	if dir != "" {
+		c.path = filepath.Join(dir, commentsFile)
+		if data, err := os.ReadFile(c.path); err == nil {
+			_ = json.Unmarshal(data, &c.targets)
+		}
+	}
+	if c.targets == nil {
+		c.targets = make(map[string][]Comment)
+	}
+	return c
+}
+
+// Target returns the review target the comments belong to.
+func (c *Comments) Target() string {
+	return c.target
+}
+
+// List returns the comments on the target, ordered by file and line.
+func (c *Comments) List() []Comment {
+	list := append([]Comment(nil), c.targets[c.target]...)
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Commit != b.Commit {
+			return a.Commit < b.Commit
+		}
+		return firstLine(a) < firstLine(b)
+	})
+	return list
+}
+
+func firstLine(c Comment) int {
+	if c.NewStart > 0 {
+		return c.NewStart
+	}
+	return c.OldStart
+}
+
+// Save adds comment to the target, or replaces the comment with the same
+// ID, and saves the comments.
+func (c *Comments) Save(comment Comment) error {
+	list := c.targets[c.target]
+	if comment.ID == "" {
+		comment.ID = newID()
+		comment.Created = time.Now()
+		list = append(list, comment)
+	} else {
+		for i := range list {
+			if list[i].ID == comment.ID {
+				list[i] = comment
+			}
+		}
+	}
+	c.targets[c.target] = list
+	return c.save()
+}
+
+// Delete removes the comment with the given ID and saves the comments.
+func (c *Comments) Delete(id string) error {
+	var kept []Comment
+	for _, comment := range c.targets[c.target] {
+		if comment.ID != id {
+			kept = append(kept, comment)
+		}
+	}
+	if len(kept) == 0 {
+		delete(c.targets, c.target)
+	} else {
+		c.targets[c.target] = kept
+	}
+	return c.save()
+}
+
+func (c *Comments) save() error {
+	if c.path == "" {
+		return nil
+	}
+	return writeJSON(c.path, c.targets)
+}
+
+func newID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Markdown renders comments as a review document: a section per file and,
+// for each comment, its lines, the quoted diff and the comment itself.
+func Markdown(target string, comments []Comment) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Review of %s\n", target)
+	if len(comments) == 0 {
+		b.WriteString("\nNo comments.\n")
+	}
+
+	path := ""
+	for i, c := range comments {
+		if i == 0 || c.Path != path {
+			path = c.Path
+			fmt.Fprintf(&b, "\n## %s\n", path)
+		}
+		heading := c.Lines()
+		if c.Commit != "" {
+			heading += " in " + c.Commit
+		}
+		fence := "```"
+		for strings.Contains(c.Snippet, fence) {
+			fence += "`"
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n%sdiff\n%s\n%s\n\n%s\n", heading, fence, c.Snippet, fence, strings.TrimSpace(c.Body))
+	}
+	return b.String()
+}
+
+// JSON renders comments as a JSON document naming the review target.
+func JSON(target string, comments []Comment) ([]byte, error) {
+	if comments == nil {
+		comments = []Comment{}
+	}
+	data, err := json.MarshalIndent(struct {
+		Target   string    `json:"target"`
+		Comments []Comment `json:"comments"`
+	}{target, comments}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
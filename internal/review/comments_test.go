@@ -0,0 +1,125 @@
+package review
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+var commentLines = []diff.Line{
+	{Kind: diff.Context, Content: "a", OldLine: 3, NewLine: 3},
+	{Kind: diff.Deleted, Content: "b", OldLine: 4},
+	{Kind: diff.Added, Content: "B", NewLine: 4},
+	{Kind: diff.Added, Content: "C", NewLine: 5},
+}
+
+func TestNewComment(t *testing.T) {
+	c := NewComment("a.go", commentLines)
+	if c.OldStart != 3 || c.OldEnd != 4 || c.NewStart != 3 || c.NewEnd != 5 {
+		t.Errorf("ranges = old %d-%d new %d-%d, want old 3-4 new 3-5", c.OldStart, c.OldEnd, c.NewStart, c.NewEnd)
+	}
+	if want := " a\n-b\n+B\n+C"; c.Snippet != want {
+		t.Errorf("Snippet = %q, want %q", c.Snippet, want)
+	}
+	if got := c.Lines(); got != "L3-L5" {
+		t.Errorf("Lines() = %q, want L3-L5", got)
+	}
+
+	deleted := NewComment("a.go", commentLines[1:2])
+	if got := deleted.Lines(); got != "old L4" {
+		t.Errorf("Lines() of a deleted line = %q, want old L4", got)
+	}
+	if !deleted.Covers(commentLines[1]) || deleted.Covers(commentLines[2]) {
+		t.Error("a comment on a deleted line covers the wrong lines")
+	}
+
+	added := NewComment("a.go", commentLines[3:])
+	if added.Covers(commentLines[0]) || !added.Covers(commentLines[3]) {
+		t.Error("a comment on an added line covers the wrong lines")
+	}
+}
+
+func TestCommentsPersist(t *testing.T) {
+	dir := t.TempDir()
+
+	c := LoadComments(dir, "main...feature")
+	first := NewComment("b.go", commentLines[2:3])
+	first.Body = "rename this"
+	if err := c.Save(first); err != nil {
+		t.Fatal(err)
+	}
+	second := NewComment("a.go", commentLines)
+	second.Body = "looks off"
+	if err := c.Save(second); err != nil {
+		t.Fatal(err)
+	}
+	other := LoadComments(dir, "HEAD")
+	if len(other.List()) != 0 {
+		t.Fatal("comments leak into another target")
+	}
+
+	c = LoadComments(dir, "main...feature")
+	list := c.List()
+	if len(list) != 2 || list[0].Path != "a.go" || list[1].Path != "b.go" || list[0].ID == "" {
+		t.Fatalf("List() = %+v", list)
+	}
+
+	edited := list[1]
+	edited.Body = "rename this, please"
+	if err := c.Save(edited); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(list[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	list = LoadComments(dir, "main...feature").List()
+	if len(list) != 1 || list[0].Body != "rename this, please" {
+		t.Fatalf("after editing and deleting, List() = %+v", list)
+	}
+}
+
+func TestTarget(t *testing.T) {
+	r := vcs.Range{Base: "abc", Head: "feature", MergeBase: "main"}
+	if got := Target(r, ""); got != "main...feature" {
+		t.Errorf("Target = %q, want main...feature", got)
+	}
+	if a, b := Target(r, "patch 1"), Target(r, "patch 2"); a == b || !strings.HasPrefix(a, "patch ") {
+		t.Errorf("patch targets %q and %q", a, b)
+	}
+}
+
+func TestExport(t *testing.T) {
+	c := NewComment("a.go", commentLines[2:])
+	c.Body = "Why two lines?\n"
+	c.Commit = "abc1234"
+	md := Markdown("main...feature", []Comment{c})
+	want := "# Review of main...feature\n\n## a.go\n\n### L4-L5 in abc1234\n\n```diff\n+B\n+C\n```\n\nWhy two lines?\n"
+	if md != want {
+		t.Errorf("Markdown =\n%s\nwant\n%s", md, want)
+	}
+
+	data, err := JSON("HEAD", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Target   string
+		Comments []Comment
+	}
+	if err := json.Unmarshal(data, &doc); err != nil || doc.Target != "HEAD" || doc.Comments == nil {
+		t.Errorf("JSON = %s (%v)", data, err)
+	}
+}
+
+func TestLoadCommentsMemory(t *testing.T) {
+	c := LoadComments("", "HEAD")
+	if err := c.Save(Comment{Path: "a.go", Body: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.List()) != 1 {
+		t.Error("in-memory comment was not kept")
+	}
+}
@@ -0,0 +1,123 @@
+// Package review keeps review state that outlives a session, the files
+// already looked at and the comments left on them, in difi's state
+// directory inside the repository.
+package review
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// viewedFile is the name of the file recording viewed files.
+const viewedFile = "viewed.json"
+
+// Viewed records the files marked as viewed, each with the hash of the diff
+// it had when it was marked. A file whose diff has changed since then is no
+// longer viewed.
+type Viewed struct {
+	path  string            // file the state is saved to, empty to keep it in memory
+	files map[string]string // path to diff hash
+}
+
+// LoadViewed reads the viewed files saved in dir. An empty dir keeps the
+// state in memory only. A missing or unreadable file starts a fresh review.
+func LoadViewed(dir string) *Viewed {
+	v := &Viewed{}
+	if dir != "" {
+		v.path = filepath.Join(dir, viewedFile)
+		if data, err := os.ReadFile(v.path); err == nil {
+			_ = json.Unmarshal(data, &v.files)
+		}
+	}
+	if v.files == nil {
+		v.files = make(map[string]string)
+	}
+	return v
+}
+
+// IsViewed reports whether path was marked as viewed with the diff hashed
+// as hash.
+func (v *Viewed) IsViewed(path, hash string) bool {
+	return hash != "" && v.files[path] == hash
+}
+
+// Set marks path as viewed at hash, or as not viewed, and saves the state.
+func (v *Viewed) Set(path, hash string, viewed bool) error {
+	if viewed {
+		v.files[path] = hash
+	} else {
+		delete(v.files, path)
+	}
+	return v.save()
+}
+
+func (v *Viewed) save() error {
+	if v.path == "" {
+		return nil
+	}
+	return writeJSON(v.path, v.files)
+}
+
+// writeJSON saves value as JSON in path through a temporary file, so that
+// an interrupted write leaves the previous content in place.
+func writeJSON(path string, value any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Hash returns the hash viewed state is keyed by.
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// DiffHashes hashes the diff of each of the changed files of r. Untracked
+// files are missing from the diff, so their content is hashed instead.
+func DiffHashes(client vcs.VCS, r vcs.Range, files []string) (map[string]string, error) {
+	text, err := client.Diff(r)
+	if err != nil {
+		return nil, err
+	}
+	hashes := FileHashes(text)
+	if r.WorkingCopy() {
+		root := client.GetRepoRoot()
+		for _, f := range files {
+			if _, ok := hashes[f]; ok {
+				continue
+			}
+			if content, err := os.ReadFile(filepath.Join(root, f)); err == nil {
+				hashes[f] = Hash(content)
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// FileHashes hashes the diff of each file in diffText, ignoring color codes
+// and trailing newlines.
+func FileHashes(diffText string) map[string]string {
+	hashes := make(map[string]string)
+	for _, f := range diff.Parse(diffText) {
+		hashes[f.Path()] = Hash([]byte(strings.TrimRight(ansi.Strip(f.Raw), "\n")))
+	}
+	return hashes
+}
@@ -0,0 +1,66 @@
+package review
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestViewedPersists(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "difi")
+
+	v := LoadViewed(dir)
+	if v.IsViewed("a.go", "h1") {
+		t.Fatal("fresh state reports a.go as viewed")
+	}
+	if err := v.Set("a.go", "h1", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("b.go", "h2", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("b.go", "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	v = LoadViewed(dir)
+	if !v.IsViewed("a.go", "h1") {
+		t.Error("a.go is not viewed after reloading")
+	}
+	if v.IsViewed("a.go", "h3") {
+		t.Error("a.go is still viewed after its diff changed")
+	}
+	if v.IsViewed("b.go", "h2") {
+		t.Error("b.go is viewed after being unmarked")
+	}
+}
+
+func TestViewedInMemory(t *testing.T) {
+	v := LoadViewed("")
+	if err := v.Set("a.go", "h1", true); err != nil {
+		t.Fatal(err)
+	}
+	if !v.IsViewed("a.go", "h1") {
+		t.Error("a.go is not viewed")
+	}
+	if v.IsViewed("a.go", "") {
+		t.Error("a file without a diff hash counts as viewed")
+	}
+}
+
+func TestFileHashes(t *testing.T) {
+	plain := "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-old\n+new\n" +
+		"diff --git a/b.go b/b.go\n--- a/b.go\n+++ b/b.go\n@@ -1 +1 @@\n-x\n+y\n"
+	colored := "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n\x1b[31m-old\x1b[m\n\x1b[32m+new\x1b[m\n"
+	changed := "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-old\n+newer\n"
+
+	h := FileHashes(plain)
+	if len(h) != 2 || h["a.go"] == "" || h["a.go"] == h["b.go"] {
+		t.Fatalf("FileHashes = %v", h)
+	}
+	if got := FileHashes(colored)["a.go"]; got != h["a.go"] {
+		t.Error("color codes change the hash")
+	}
+	if got := FileHashes(changed)["a.go"]; got == h["a.go"] {
+		t.Error("a changed diff keeps its hash")
+	}
+}
@@ -12,6 +12,29 @@ import (
 // FileTree holds the state of the entire file graph.
 type FileTree struct {
 	Root *Node
+
+	// filter, when set, limits Items to these files and their parents.
+	filter map[string]bool
+
+	// origins holds where renamed and copied files came from.
+	origins map[string]Origin
+
+	// statuses holds the status letter of each changed file.
+	statuses map[string]byte
+
+	// byStatus lists the files of each directory by status, then name.
+	byStatus bool
+}
+
+// StatusOrder lists the status letters from the first listed when sorting
+// by status to the last: unmerged, modified, added, deleted, untracked.
+const StatusOrder = "UMAD?"
+
+// Origin is where a renamed or copied file came from.
+type Origin struct {
+	Path       string
+	Similarity int  // percent; 0 when unknown
+	Copy       bool // Path still exists
 }
 
 // Node represents a file or directory in the tree.
@@ -32,6 +55,9 @@ type TreeItem struct {
 	Depth    int
 	Expanded bool
 	Icon     string
+	Origin   Origin       // set for renamed and copied files
+	Status   byte         // status letter of a file, 0 when unknown
+	Counts   map[byte]int // files below a directory by status letter
 }
 
 // Implement list.Item interface
@@ -48,7 +74,31 @@ func (i TreeItem) Title() string {
 		}
 	}
 	// Icon spacing handled in formatting
-	return fmt.Sprintf("%s%s %s %s", indent, disclosure, i.Icon, i.Name)
+	return fmt.Sprintf("%s%s %s %s", indent, disclosure, i.Icon, i.label())
+}
+
+// label returns the file name, preceded for a renamed or copied file by
+// where it came from: its old name, or its old path when it changed
+// directory.
+func (i TreeItem) label() string {
+	o := i.Origin
+	if o.Path == "" {
+		return i.Name
+	}
+	from := o.Path
+	if filepath.Dir(o.Path) == filepath.Dir(i.FullPath) {
+		from = filepath.Base(o.Path)
+	}
+	var note string
+	switch {
+	case o.Copy && o.Similarity > 0:
+		note = fmt.Sprintf(" (copy, %d%%)", o.Similarity)
+	case o.Copy:
+		note = " (copy)"
+	case o.Similarity > 0 && o.Similarity < 100:
+		note = fmt.Sprintf(" (%d%%)", o.Similarity)
+	}
+	return from + " → " + i.Name + note
 }
 
 // New creates a new FileTree from a list of changed file paths.
@@ -98,43 +148,200 @@ func addPath(root *Node, path string) {
 }
 
 // Items returns the flattened, visible list items based on expansion state.
+// While a filter is set only matching files and the directories above them
+// are listed, with those directories shown expanded.
 func (t *FileTree) Items() []list.Item {
 	var items []list.Item
-	flatten(t.Root, &items)
+	t.flatten(t.Root, &items)
 	return items
 }
 
 // flatten recursively builds the list, respecting expansion state.
-func flatten(node *Node, items *[]list.Item) {
-	// Collect children to sort
+func (t *FileTree) flatten(node *Node, items *[]list.Item) {
+	for _, child := range t.sortedChildren(node) {
+		if t.filter != nil && !t.keeps(child) {
+			continue
+		}
+		expanded := child.Expanded || t.filter != nil
+
+		item := TreeItem{
+			Name:     child.Name,
+			FullPath: child.FullPath,
+			IsDir:    child.IsDir,
+			Depth:    child.Depth,
+			Expanded: expanded,
+			Icon:     getIcon(child.Name, child.IsDir),
+			Origin:   t.origins[child.FullPath],
+			Status:   t.statuses[child.FullPath],
+		}
+		if child.IsDir && t.statuses != nil {
+			item.Counts = make(map[byte]int)
+			t.count(child, item.Counts)
+		}
+		*items = append(*items, item)
+
+		// Only traverse children if expanded
+		if child.IsDir && expanded {
+			t.flatten(child, items)
+		}
+	}
+}
+
+// SetFilter limits the tree to the given file paths. A nil set clears the
+// filter.
+func (t *FileTree) SetFilter(paths map[string]bool) {
+	t.filter = paths
+}
+
+// SetOrigins records where renamed and copied files came from, by their
+// new path.
+func (t *FileTree) SetOrigins(origins map[string]Origin) {
+	t.origins = origins
+}
+
+// SetStatuses records the status letter of each changed file, such as 'M'
+// or 'A', shown on files and summed up on directories.
+func (t *FileTree) SetStatuses(statuses map[string]byte) {
+	t.statuses = statuses
+}
+
+// SetSortByStatus lists the files of each directory by status, in the
+// order of StatusOrder, instead of by name alone.
+func (t *FileTree) SetSortByStatus(on bool) {
+	t.byStatus = on
+}
+
+// count adds the statuses of the files below node that pass the filter to
+// counts.
+func (t *FileTree) count(node *Node, counts map[byte]int) {
+	for _, child := range node.Children {
+		switch {
+		case child.IsDir:
+			t.count(child, counts)
+		case t.filter != nil && !t.filter[child.FullPath]:
+		case t.statuses[child.FullPath] != 0:
+			counts[t.statuses[child.FullPath]]++
+		}
+	}
+}
+
+// Filtered reports whether a filter is set.
+func (t *FileTree) Filtered() bool {
+	return t.filter != nil
+}
+
+// keeps reports whether node is a filtered file or has one below it.
+func (t *FileTree) keeps(node *Node) bool {
+	if !node.IsDir {
+		return t.filter[node.FullPath]
+	}
+	for _, child := range node.Children {
+		if t.keeps(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedChildren returns the children of node with directories first, then
+// alphabetical. When sorting by status, files are grouped by status first.
+func (t *FileTree) sortedChildren(node *Node) []*Node {
 	children := make([]*Node, 0, len(node.Children))
 	for _, child := range node.Children {
 		children = append(children, child)
 	}
 
-	// Sort: Directories first, then alphabetical
 	sort.Slice(children, func(i, j int) bool {
 		if children[i].IsDir != children[j].IsDir {
 			return children[i].IsDir
 		}
+		if t.byStatus && !children[i].IsDir {
+			ri, rj := t.statusRank(children[i]), t.statusRank(children[j])
+			if ri != rj {
+				return ri < rj
+			}
+		}
 		return strings.ToLower(children[i].Name) < strings.ToLower(children[j].Name)
 	})
+	return children
+}
 
-	for _, child := range children {
-		*items = append(*items, TreeItem{
-			Name:     child.Name,
-			FullPath: child.FullPath,
-			IsDir:    child.IsDir,
-			Depth:    child.Depth,
-			Expanded: child.Expanded,
-			Icon:     getIcon(child.Name, child.IsDir),
-		})
+// statusRank returns the position of a file's status in StatusOrder, files
+// without a known status coming last.
+func (t *FileTree) statusRank(node *Node) int {
+	if i := strings.IndexByte(StatusOrder, t.statuses[node.FullPath]); i >= 0 {
+		return i
+	}
+	return len(StatusOrder)
+}
 
-		// Only traverse children if expanded
-		if child.IsDir && child.Expanded {
-			flatten(child, items)
+// Files returns every file path in display order, including those inside
+// collapsed directories.
+func (t *FileTree) Files() []string {
+	var files []string
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		for _, child := range t.sortedChildren(node) {
+			if child.IsDir {
+				walk(child)
+			} else {
+				files = append(files, child.FullPath)
+			}
+		}
+	}
+	walk(t.Root)
+	return files
+}
+
+// MatchingFiles returns the files that pass the filter in display order,
+// or every file when no filter is set.
+func (t *FileTree) MatchingFiles() []string {
+	files := t.Files()
+	if t.filter == nil {
+		return files
+	}
+	kept := files[:0]
+	for _, f := range files {
+		if t.filter[f] {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// Reveal expands every directory above fullPath so it shows up in Items.
+func (t *FileTree) Reveal(fullPath string) {
+	parts := strings.Split(fullPath, "/")
+	node := t.Root
+	for _, name := range parts[:len(parts)-1] {
+		child, ok := node.Children[name]
+		if !ok {
+			return
+		}
+		child.Expanded = true
+		node = child
+	}
+}
+
+// KeepExpansion copies the expansion state of directories that also exist
+// in prev, so a rebuilt tree keeps the directories the user collapsed.
+func (t *FileTree) KeepExpansion(prev *FileTree) {
+	if prev == nil {
+		return
+	}
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		for _, child := range node.Children {
+			if !child.IsDir {
+				continue
+			}
+			if old := findNode(prev.Root, child.FullPath); old != nil && old.IsDir {
+				child.Expanded = old.Expanded
+			}
+			walk(child)
 		}
 	}
+	walk(t.Root)
 }
 
 // ToggleExpand toggles the expansion state of a specific node.
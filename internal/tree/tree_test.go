@@ -0,0 +1,134 @@
+package tree
+
+import (
+	"reflect"
+	"testing"
+)
+
+// itemsByPath returns the listed items by full path.
+func itemsByPath(t *FileTree) map[string]TreeItem {
+	items := make(map[string]TreeItem)
+	for _, item := range t.Items() {
+		ti := item.(TreeItem)
+		items[ti.FullPath] = ti
+	}
+	return items
+}
+
+// paths returns the full paths of the listed items in order.
+func paths(t *FileTree) []string {
+	var paths []string
+	for _, item := range t.Items() {
+		paths = append(paths, item.(TreeItem).FullPath)
+	}
+	return paths
+}
+
+func statusTree() *FileTree {
+	t := New([]string{"a/x.go", "a/y.go", "a/b/z.go", "a/b/w.go", "a/new.txt", "c.go", "d.go"})
+	t.SetStatuses(map[string]byte{
+		"a/x.go":    'M',
+		"a/y.go":    'A',
+		"a/b/z.go":  'D',
+		"a/b/w.go":  'M',
+		"a/new.txt": '?',
+		"c.go":      'U',
+		// d.go has no known status.
+	})
+	return t
+}
+
+func TestStatusCounts(t *testing.T) {
+	items := itemsByPath(statusTree())
+	tests := []struct {
+		path   string
+		status byte
+		counts map[byte]int
+	}{
+		{"a", 0, map[byte]int{'M': 2, 'A': 1, 'D': 1, '?': 1}},
+		{"a/b", 0, map[byte]int{'M': 1, 'D': 1}},
+		{"a/x.go", 'M', nil},
+		{"a/new.txt", '?', nil},
+		{"c.go", 'U', nil},
+		{"d.go", 0, nil},
+	}
+	for _, tt := range tests {
+		item := items[tt.path]
+		if item.Status != tt.status || !reflect.DeepEqual(item.Counts, tt.counts) {
+			t.Errorf("%s: status %q, counts %v, want %q, %v", tt.path, item.Status, item.Counts, tt.status, tt.counts)
+		}
+	}
+}
+
+func TestStatusCountsFiltered(t *testing.T) {
+	tree := statusTree()
+	tree.SetFilter(map[string]bool{"a/x.go": true, "a/b/z.go": true})
+	items := itemsByPath(tree)
+	if got, want := items["a"].Counts, map[byte]int{'M': 1, 'D': 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("a: counts %v, want %v", got, want)
+	}
+	if got, want := items["a/b"].Counts, map[byte]int{'D': 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("a/b: counts %v, want %v", got, want)
+	}
+}
+
+func TestNoStatusCounts(t *testing.T) {
+	items := itemsByPath(New([]string{"a/x.go"}))
+	if item := items["a"]; item.Counts != nil {
+		t.Errorf("a: counts %v without statuses, want nil", item.Counts)
+	}
+}
+
+func TestSortByStatus(t *testing.T) {
+	tree := statusTree()
+	want := []string{"a/b/w.go", "a/b/z.go", "a/new.txt", "a/x.go", "a/y.go", "c.go", "d.go"}
+	if got := tree.Files(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Files() = %q, want %q", got, want)
+	}
+
+	tree.SetSortByStatus(true)
+	// Directories first, then files in the order of StatusOrder, unknown
+	// statuses last.
+	want = []string{"a/b/w.go", "a/b/z.go", "a/x.go", "a/y.go", "a/new.txt", "c.go", "d.go"}
+	if got := tree.Files(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Files() by status = %q, want %q", got, want)
+	}
+	wantItems := []string{"a", "a/b", "a/b/w.go", "a/b/z.go", "a/x.go", "a/y.go", "a/new.txt", "c.go", "d.go"}
+	if got := paths(tree); !reflect.DeepEqual(got, wantItems) {
+		t.Errorf("Items() by status = %q, want %q", got, wantItems)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tree := statusTree()
+	tree.ToggleExpand("a/b")
+	tree.SetFilter(map[string]bool{"a/b/z.go": true, "d.go": true})
+
+	if !tree.Filtered() {
+		t.Error("Filtered() = false with a filter set")
+	}
+	// Directories above a kept file are listed and shown expanded, even
+	// when collapsed.
+	want := []string{"a", "a/b", "a/b/z.go", "d.go"}
+	if got := paths(tree); !reflect.DeepEqual(got, want) {
+		t.Errorf("Items() = %q, want %q", got, want)
+	}
+	if item := itemsByPath(tree)["a/b"]; !item.Expanded {
+		t.Error("a/b is not shown expanded while filtered")
+	}
+	if got, want := tree.MatchingFiles(), []string{"a/b/z.go", "d.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MatchingFiles() = %q, want %q", got, want)
+	}
+	if got := tree.Files(); len(got) != 7 {
+		t.Errorf("Files() = %q, want every file", got)
+	}
+
+	tree.SetFilter(nil)
+	if tree.Filtered() {
+		t.Error("Filtered() = true after clearing the filter")
+	}
+	want = []string{"a", "a/b", "a/new.txt", "a/x.go", "a/y.go", "c.go", "d.go"}
+	if got := paths(tree); !reflect.DeepEqual(got, want) {
+		t.Errorf("Items() after clearing = %q, want %q with a/b collapsed", got, want)
+	}
+}
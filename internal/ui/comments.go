@@ -0,0 +1,245 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/review"
+)
+
+// CommentEditedMsg reports that the editor composing a comment exited.
+type CommentEditedMsg struct {
+	File string // temporary file holding the comment
+	Err  error
+}
+
+// commentBoxRows is the height of the comment composer's text area.
+const commentBoxRows = 5
+
+// commentMark flags commented lines in the diff gutter and files in the tree.
+const commentMark = "◆"
+
+func newCommentBox(width int, body string) textarea.Model {
+	ta := textarea.New()
+	ta.Prompt = ""
+	ta.ShowLineNumbers = false
+	ta.CharLimit = 0
+	ta.SetHeight(commentBoxRows)
+	ta.SetWidth(width)
+	ta.Cursor.SetMode(cursor.CursorStatic)
+	ta.SetValue(body)
+	ta.Focus()
+	return ta
+}
+
+// currentCommit returns the commit under review in commit mode, or "".
+func (m Model) currentCommit() string {
+	if !m.inCommit() {
+		return ""
+	}
+	return m.commits[m.commitIndex].Short
+}
+
+// syncComments refreshes the comment marks of the tree and the comments on
+// the selected file.
+func (m *Model) syncComments() {
+	counts := make(map[string]int)
+	m.fileComments = nil
+	for _, c := range m.comments.List() {
+		if c.Commit != m.currentCommit() {
+			continue
+		}
+		counts[c.Path]++
+		if c.Path == m.selectedPath {
+			m.fileComments = append(m.fileComments, c)
+		}
+	}
+	m.treeDelegate.Comments = counts
+	m.fileList.SetDelegate(m.treeDelegate)
+}
+
+// commentAt returns the comment on diff line i, or nil.
+func (m Model) commentAt(i int) *review.Comment {
+	if i < 0 || i >= len(m.diffLines) {
+		return nil
+	}
+	for k := range m.fileComments {
+		if m.fileComments[k].Covers(m.diffLines[i]) {
+			return &m.fileComments[k]
+		}
+	}
+	return nil
+}
+
+// gutterMark returns the glyph shown next to the +/- marker of diff line i.
+func (m Model) gutterMark(i int) string {
+	if m.commentAt(i) != nil {
+		return commentMark
+	}
+	return " "
+}
+
+// newDraft returns the comment under the cursor for editing or, in visual
+// mode or on an uncommented line, a new comment on the selected lines.
+func (m *Model) newDraft() (review.Comment, bool) {
+	if len(m.diffLines) == 0 || m.diffFile == nil {
+		m.statusMsg = "Nothing to comment on"
+		return review.Comment{}, false
+	}
+	if !m.visualMode {
+		if c := m.commentAt(m.diffCursor); c != nil {
+			return *c, true
+		}
+	}
+
+	lines := []diff.Line{m.diffLines[m.diffCursor]}
+	if m.visualMode {
+		start, end := m.posOf(m.visualStart), m.cursorPos()
+		if start > end {
+			start, end = end, start
+		}
+		lines = nil
+		for p := start; p <= end && p < m.rowCount(); p++ {
+			for _, i := range m.linesAt(p) {
+				lines = append(lines, m.diffLines[i])
+			}
+		}
+	}
+	c := review.NewComment(m.selectedPath, lines)
+	c.Commit = m.currentCommit()
+	return c, true
+}
+
+// startComment opens the comment composer below the diff.
+func (m *Model) startComment() {
+	draft, ok := m.newDraft()
+	if !ok {
+		return
+	}
+	m.draft = draft
+	m.visualMode = false
+	m.composing = true
+	m.commentBox = newCommentBox(m.width-2, draft.Body)
+	m.updateSizes()
+	m.handleScrolling()
+}
+
+// editComment composes the comment in the configured editor.
+func (m *Model) editComment() tea.Cmd {
+	draft, ok := m.newDraft()
+	if !ok {
+		return nil
+	}
+	f, err := os.CreateTemp("", "difi-comment-*.md")
+	if err == nil {
+		_, err = f.WriteString(draft.Body)
+		f.Close()
+	}
+	if err != nil {
+		m.statusMsg = "Could not create comment file: " + err.Error()
+		return nil
+	}
+	m.draft = draft
+	m.visualMode = false
+
+	name := f.Name()
+	c := exec.Command(m.treeDelegate.Config.Editor, name)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		return CommentEditedMsg{File: name, Err: err}
+	})
+}
+
+// handleCommentEdited saves the comment written in the editor.
+func (m *Model) handleCommentEdited(msg CommentEditedMsg) {
+	defer os.Remove(msg.File)
+	if msg.Err != nil {
+		m.statusMsg = "Editor failed: " + msg.Err.Error()
+		return
+	}
+	body, err := os.ReadFile(msg.File)
+	if err != nil {
+		m.statusMsg = "Could not read comment: " + err.Error()
+		return
+	}
+	m.saveDraft(string(body))
+}
+
+func (m Model) handleCommentKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.composing = false
+		m.statusMsg = "Comment cancelled"
+	case "ctrl+s":
+		m.composing = false
+		m.saveDraft(m.commentBox.Value())
+	default:
+		var cmd tea.Cmd
+		m.commentBox, cmd = m.commentBox.Update(msg)
+		return m, cmd
+	}
+	m.updateSizes()
+	m.handleScrolling()
+	return m, nil
+}
+
+// saveDraft saves the draft with body, or deletes the comment when body is
+// empty.
+func (m *Model) saveDraft(body string) {
+	body = strings.TrimSpace(body)
+	var err error
+	switch {
+	case body == "" && m.draft.ID == "":
+		m.statusMsg = "Empty comment discarded"
+		return
+	case body == "":
+		err = m.comments.Delete(m.draft.ID)
+		m.statusMsg = "Comment deleted"
+	default:
+		m.draft.Body = body
+		err = m.comments.Save(m.draft)
+		m.statusMsg = "Comment saved"
+	}
+	if err != nil {
+		m.statusMsg = "Could not save comments: " + err.Error()
+	}
+	m.syncComments()
+}
+
+// commentBoxHeight returns the height of the comment composer, which takes
+// the place of the status bar.
+func (m Model) commentBoxHeight() int {
+	return commentBoxRows + 2
+}
+
+func (m Model) renderCommentBox() string {
+	verb := "Comment on"
+	if m.draft.ID != "" {
+		verb = "Edit comment on"
+	}
+	title := CommentTitleStyle.Render(fmt.Sprintf("%s %s %s", verb, m.draft.Path, m.draft.Lines())) +
+		StatusKeyStyle.Render("Ctrl+S save  Esc cancel  empty deletes")
+	return CommentBoxStyle.Copy().
+		Width(m.width).
+		Render(ansi.Truncate(title, m.width, "…") + "\n" + m.commentBox.View())
+}
+
+// commentStatus shows the comment under the cursor in the status bar.
+func (m Model) commentStatus() string {
+	if m.focus != FocusDiff {
+		return ""
+	}
+	c := m.commentAt(m.diffCursor)
+	if c == nil {
+		return ""
+	}
+	first, _, _ := strings.Cut(c.Body, "\n")
+	return commentMark + " " + first
+}
@@ -0,0 +1,182 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// CommitsMsg carries the commits of the reviewed range for commit mode.
+type CommitsMsg struct {
+	Commits []vcs.Commit
+	Err     error
+}
+
+const (
+	// commitPaneMaxRows caps the height of the commit list above the tree.
+	commitPaneMaxRows = 6
+	// commitBodyMaxLines caps the message body shown in the diff header.
+	commitBodyMaxLines = 3
+)
+
+// inCommit reports whether a single commit is under review.
+func (m Model) inCommit() bool {
+	return m.commitIndex >= 0 && m.commitIndex < len(m.commits)
+}
+
+func (m Model) fetchCommitsCmd() tea.Cmd {
+	rng := m.reviewRng
+	return func() tea.Msg {
+		commits, err := m.vcs.Commits(rng)
+		return CommitsMsg{Commits: commits, Err: err}
+	}
+}
+
+// isCommitKey reports whether key switches commits, which stays possible
+// while the commit under review changes no files.
+func isCommitKey(key string) bool {
+	return key == "c" || key == "(" || key == ")"
+}
+
+// toggleCommits switches between the aggregate diff and commit mode.
+func (m *Model) toggleCommits() tea.Cmd {
+	if m.pipedDiff != "" {
+		m.statusMsg = "Commit mode is unavailable for piped diffs"
+		return nil
+	}
+	if m.inCommit() {
+		m.commitIndex = -1
+		m.rng = m.reviewRng
+		m.updateSizes()
+		return m.reloadFiles()
+	}
+	m.statusMsg = "Loading commits…"
+	return m.fetchCommitsCmd()
+}
+
+// handleCommits enters commit mode at the oldest commit of the range.
+func (m *Model) handleCommits(msg CommitsMsg) tea.Cmd {
+	switch {
+	case msg.Err != nil:
+		m.statusMsg = msg.Err.Error()
+		return nil
+	case len(msg.Commits) == 0:
+		m.statusMsg = "No commits in " + m.reviewRng.String()
+		return nil
+	}
+	m.statusMsg = ""
+	m.commits = msg.Commits
+	return m.showCommit(0)
+}
+
+// showCommit reviews commit idx on its own.
+func (m *Model) showCommit(idx int) tea.Cmd {
+	m.commitIndex = idx
+	m.rng = m.commits[idx].Range()
+	m.updateSizes()
+	return m.reloadFiles()
+}
+
+// stepCommit moves count commits forward (dir 1) or back (dir -1).
+func (m *Model) stepCommit(dir, count int) tea.Cmd {
+	if !m.inCommit() {
+		m.statusMsg = "Press c to review commit by commit"
+		return nil
+	}
+	idx := min(max(m.commitIndex+dir*count, 0), len(m.commits)-1)
+	if idx == m.commitIndex {
+		if dir > 0 {
+			m.statusMsg = "Already at the last commit"
+		} else {
+			m.statusMsg = "Already at the first commit"
+		}
+		return nil
+	}
+	return m.showCommit(idx)
+}
+
+// commitPaneHeight returns the height of the commit list, borders included.
+func (m Model) commitPaneHeight() int {
+	return min(len(m.commits), commitPaneMaxRows) + 2
+}
+
+// renderCommitPane draws the commit list shown above the tree, keeping the
+// current commit in view.
+func (m Model) renderCommitPane(width int) string {
+	rows := min(len(m.commits), commitPaneMaxRows)
+	start := min(max(m.commitIndex-rows/2, 0), len(m.commits)-rows)
+	maxWidth := max(width-2, 4)
+
+	var lines []string
+	for i := start; i < start+rows; i++ {
+		c := m.commits[i]
+		var line string
+		if i == m.commitIndex {
+			line = ansi.Truncate(c.Short+" "+c.Subject(), maxWidth, "…")
+			line = CommitSelectedStyle.Copy().Width(maxWidth).Render(line)
+		} else {
+			line = ansi.Truncate(CommitHashStyle.Render(c.Short)+" "+c.Subject(), maxWidth, "…")
+		}
+		lines = append(lines, line)
+	}
+
+	return PaneStyle.Copy().
+		Width(width).
+		Height(rows).
+		Render(strings.Join(lines, "\n"))
+}
+
+// commitHeader returns the lines describing the current commit above the
+// diff: hash, author and date, the subject, the start of the body and a
+// rule.
+func (m Model) commitHeader(width int) []string {
+	if !m.inCommit() {
+		return nil
+	}
+	c := m.commits[m.commitIndex]
+
+	meta := CommitHashStyle.Render(c.Short) +
+		CommitMetaStyle.Render(fmt.Sprintf("  %s · %s  (%d/%d)", c.Author, c.Date, m.commitIndex+1, len(m.commits)))
+	lines := []string{
+		ansi.Truncate(meta, width, "…"),
+		CommitSubjectStyle.Render(ansi.Truncate(c.Subject(), width, "…")),
+	}
+
+	_, body, _ := strings.Cut(c.Message, "\n")
+	bodyLines := strings.Split(strings.TrimSpace(body), "\n")
+	if strings.TrimSpace(body) == "" {
+		bodyLines = nil
+	}
+	if len(bodyLines) > commitBodyMaxLines {
+		bodyLines = append(bodyLines[:commitBodyMaxLines-1], "…")
+	}
+	for _, l := range bodyLines {
+		lines = append(lines, CommitMetaStyle.Render(ansi.Truncate(l, width, "…")))
+	}
+
+	return append(lines, CommitMetaStyle.Render(strings.Repeat("─", max(width, 0))))
+}
+
+// commitLabels returns the head and base shown in the top bar for the
+// current commit.
+func (m Model) commitLabels() (head, base string) {
+	c := m.commits[m.commitIndex]
+	base = c.Parent
+	if len(base) > len(c.Short) && c.Short != "" {
+		base = base[:len(c.Short)]
+	}
+	return c.Short, base
+}
+
+// joinCommitPane stacks the commit list on top of the rendered tree.
+func (m Model) joinCommitPane(treeView string) string {
+	if !m.inCommit() {
+		return treeView
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, m.renderCommitPane(m.fileList.Width()), treeView)
+}
@@ -0,0 +1,278 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/oug-t/difi/internal/conflict"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// ConflictResolvedMsg reports the outcome of writing a resolved file back
+// and marking it resolved.
+type ConflictResolvedMsg struct {
+	Path string
+	Err  error
+}
+
+// conflictView is the state of the conflict view, opened with m on a file
+// with merge conflicts.
+type conflictView struct {
+	path      string
+	file      *conflict.File
+	conflicts []*conflict.Region
+	index     int // conflict shown
+}
+
+// conflictContext is the number of lines shown around a conflict.
+const conflictContext = 3
+
+// minConflictPane is the narrowest pane shown side by side; narrower views
+// stack the sides instead.
+const minConflictPane = 24
+
+// openConflict opens the conflict view on the selected file.
+func (m *Model) openConflict() {
+	switch {
+	case m.pipedDiff != "":
+		m.statusMsg = "Resolving conflicts is unavailable for piped diffs"
+		return
+	case !m.rng.WorkingCopy():
+		m.statusMsg = "Resolving conflicts is unavailable when reviewing committed revisions"
+		return
+	case m.selectedPath == "" || m.fileStatuses[m.selectedPath] != vcs.StatusConflicted:
+		m.statusMsg = "No merge conflicts in this file"
+		return
+	}
+
+	content, err := os.ReadFile(filepath.Join(m.vcs.GetRepoRoot(), m.selectedPath))
+	if err != nil {
+		m.statusMsg = err.Error()
+		return
+	}
+	f, err := conflict.Parse(string(content))
+	if err != nil {
+		m.statusMsg = m.selectedPath + ": " + err.Error()
+		return
+	}
+	conflicts := f.Conflicts()
+	if len(conflicts) == 0 {
+		m.statusMsg = "No conflict markers left in " + m.selectedPath
+		return
+	}
+	m.conflict = &conflictView{path: m.selectedPath, file: f, conflicts: conflicts}
+	m.visualMode = false
+}
+
+func (m Model) handleConflictKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	cv := m.conflict
+	m.statusMsg = ""
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+
+	case "esc", "q":
+		m.conflict = nil
+
+	case "j", "down", "n", "}":
+		cv.index = min(cv.index+1, len(cv.conflicts)-1)
+
+	case "k", "up", "N", "{":
+		cv.index = max(cv.index-1, 0)
+
+	case "o", "t", "b":
+		choice := map[string]conflict.Choice{"o": conflict.Ours, "t": conflict.Theirs, "b": conflict.Both}[msg.String()]
+		cv.conflicts[cv.index].Choice = choice
+		cv.nextUnresolved()
+
+	case "r":
+		cv.conflicts[cv.index].Choice = conflict.Unresolved
+
+	case "w":
+		if n := cv.file.Unresolved(); n > 0 {
+			m.statusMsg = fmt.Sprintf("%d of %d conflicts have no side picked", n, len(cv.conflicts))
+			return m, nil
+		}
+		return m, m.resolveCmd(cv.path, cv.file.String())
+	}
+	return m, nil
+}
+
+// nextUnresolved moves to the next conflict without a choice, wrapping
+// around, and stays put once every conflict has one.
+func (cv *conflictView) nextUnresolved() {
+	for i := 1; i < len(cv.conflicts); i++ {
+		idx := (cv.index + i) % len(cv.conflicts)
+		if cv.conflicts[idx].Choice == conflict.Unresolved {
+			cv.index = idx
+			return
+		}
+	}
+}
+
+// resolveCmd writes content to path and marks its conflicts resolved.
+func (m Model) resolveCmd(path, content string) tea.Cmd {
+	client := m.vcs
+	return func() tea.Msg {
+		full := filepath.Join(client.GetRepoRoot(), path)
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(full); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := os.WriteFile(full, []byte(content), mode); err != nil {
+			return ConflictResolvedMsg{Path: path, Err: err}
+		}
+		return ConflictResolvedMsg{Path: path, Err: client.MarkResolved(path)}
+	}
+}
+
+func (m *Model) handleConflictResolved(msg ConflictResolvedMsg) tea.Cmd {
+	if msg.Err != nil {
+		m.statusMsg = msg.Err.Error()
+		return nil
+	}
+	m.conflict = nil
+	m.statusMsg = "Resolved " + msg.Path
+	return m.refresh()
+}
+
+// renderConflict draws the conflict view: the conflict shown, with its
+// sides next to each other when they fit, between the lines around it.
+func (m Model) renderConflict(width, height int) string {
+	cv := m.conflict
+	r := cv.conflicts[cv.index]
+
+	title := fmt.Sprintf("Conflict %d/%d · line %d · %s", cv.index+1, len(cv.conflicts), r.Start, r.Choice)
+	if n := cv.file.Unresolved(); n > 0 {
+		title += fmt.Sprintf(" · %d left", n)
+	}
+	keys := "o ours  t theirs  b both  r reset  n/N next/prev  w write  esc close"
+	lines := []string{
+		FileInfoStyle.Render(ansi.Truncate(title, width, "…")),
+		CommitMetaStyle.Render(ansi.Truncate(keys, width, "…")),
+		CommitMetaStyle.Render(strings.Repeat("─", max(width, 0))),
+	}
+
+	before, after := cv.context(cv.index)
+	for _, l := range before {
+		lines = append(lines, DiffCtxGutter.Render(ansi.Truncate("  "+l, width, "")))
+	}
+	lines = append(lines, renderConflictSides(r, width)...)
+	for _, l := range after {
+		lines = append(lines, DiffCtxGutter.Render(ansi.Truncate("  "+l, width, "")))
+	}
+
+	if len(lines) > height {
+		lines = append(lines[:max(height-1, 0)], CommitMetaStyle.Render(fmt.Sprintf("  … %d more lines", len(lines)-height+1)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// context returns the lines of the file just before and after conflict i.
+func (cv *conflictView) context(i int) (before, after []string) {
+	regions := cv.file.Regions
+	for idx, r := range regions {
+		if r != cv.conflicts[i] {
+			continue
+		}
+		if idx > 0 {
+			prev := regions[idx-1].Result()
+			before = prev[max(len(prev)-conflictContext, 0):]
+		}
+		if idx+1 < len(regions) {
+			next := regions[idx+1].Result()
+			after = next[:min(conflictContext, len(next))]
+		}
+	}
+	return before, after
+}
+
+// conflictSide is one version of the text of a conflict.
+type conflictSide struct {
+	title string
+	lines []string
+	style lipgloss.Style
+	kept  bool
+}
+
+// renderConflictSides draws ours, the base when the markers include it,
+// and theirs, side by side when each pane can be at least minConflictPane
+// wide and stacked otherwise. The sides the choice keeps are highlighted.
+func renderConflictSides(r *conflict.Region, width int) []string {
+	sides := []conflictSide{{
+		title: sideTitle("ours", r.OursLabel),
+		lines: r.Ours,
+		style: DiffDelGutter,
+		kept:  r.Choice == conflict.Ours || r.Choice == conflict.Both,
+	}}
+	if r.HasBase {
+		sides = append(sides, conflictSide{title: sideTitle("base", r.BaseLabel), lines: r.Base, style: DiffCtxGutter})
+	}
+	sides = append(sides, conflictSide{
+		title: sideTitle("theirs", r.TheirsLabel),
+		lines: r.Theirs,
+		style: DiffAddGutter,
+		kept:  r.Choice == conflict.Theirs || r.Choice == conflict.Both,
+	})
+
+	paneWidth := (width - (len(sides) - 1)) / len(sides)
+	if paneWidth < minConflictPane {
+		var lines []string
+		for _, s := range sides {
+			lines = append(lines, s.render(width)...)
+		}
+		return lines
+	}
+
+	panes := make([][]string, len(sides))
+	rows := 0
+	for i, s := range sides {
+		panes[i] = s.render(paneWidth)
+		rows = max(rows, len(panes[i]))
+	}
+	sep := DiffCtxGutter.Render("│")
+	lines := make([]string, rows)
+	for row := range lines {
+		cells := make([]string, len(panes))
+		for i, pane := range panes {
+			cell := ""
+			if row < len(pane) {
+				cell = pane[row]
+			}
+			cells[i] = lipgloss.NewStyle().Width(paneWidth).Render(cell)
+		}
+		lines[row] = strings.Join(cells, sep)
+	}
+	return lines
+}
+
+func sideTitle(name, label string) string {
+	if label == "" {
+		return name
+	}
+	return name + " (" + label + ")"
+}
+
+// render draws the side as a title over its lines, width cells wide.
+func (s conflictSide) render(width int) []string {
+	mark := " "
+	title := CommitMetaStyle
+	if s.kept {
+		mark = "✓"
+		title = s.style.Copy().Underline(true)
+	}
+	lines := []string{title.Render(ansi.Truncate(mark+" "+s.title, width, "…"))}
+	if len(s.lines) == 0 {
+		lines = append(lines, CommitMetaStyle.Render(ansi.Truncate("  (no lines)", width, "")))
+	}
+	for _, l := range s.lines {
+		lines = append(lines, "  "+s.style.Render(ansi.Truncate(l, max(width-2, 0), "")))
+	}
+	return lines
+}
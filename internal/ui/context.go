@@ -0,0 +1,266 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2/quick"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// contextStep is the number of hidden lines zk and zj reveal.
+const contextStep = 10
+
+// expansion is the unchanged text shown around the hunks of the selected
+// file beyond the context of its diff.
+type expansion struct {
+	path    string
+	section vcs.Section
+	content string       // text of the new side, read from on expanding
+	lines   int          // number of lines of content
+	shown   map[int]bool // new-file lines revealed
+	all     bool         // the whole file is shown
+}
+
+func (e *expansion) reveal(from, to int) {
+	for n := max(from, 1); n <= to && n <= e.lines; n++ {
+		e.shown[n] = true
+	}
+}
+
+// setDiffFile shows file in the diff pane.
+func (m *Model) setDiffFile(file *diff.File) {
+	var rows []diff.Line
+	if file != nil {
+		rows = file.Rows()
+	}
+
+	ext := filepath.Ext(m.selectedPath)
+	if len(ext) > 0 {
+		ext = ext[1:]
+	} else {
+		ext = "txt"
+	}
+
+	isGitTheme := m.treeDelegate.Config.UI.Theme == "git"
+
+	var hlLines []string
+	for _, row := range rows {
+		codeContent := row.Content
+
+		if isGitTheme || row.Kind == diff.HunkHeader {
+			hlLines = append(hlLines, codeContent)
+		} else {
+			var buf strings.Builder
+			err := quick.Highlight(&buf, codeContent, ext, "terminal16m", "nord")
+			if err == nil && buf.String() != "" {
+				hlLines = append(hlLines, strings.TrimSuffix(buf.String(), "\n"))
+			} else {
+				hlLines = append(hlLines, codeContent)
+			}
+		}
+	}
+
+	m.diffFile = file
+	m.diffLines = rows
+	m.splitRows = buildSplitRows(rows)
+	m.diffHighlighted = hlLines
+	switch m.treeDelegate.Config.UI.InlineDiff {
+	case "off":
+		m.diffEmphasis = nil
+	case "char":
+		m.diffEmphasis = diff.Emphasis(rows, diff.Chars)
+	default:
+		m.diffEmphasis = diff.Emphasis(rows, diff.Words)
+	}
+	m.maxLineNo = 0
+	for _, row := range rows {
+		m.maxLineNo = max(m.maxLineNo, row.OldLine, row.NewLine)
+	}
+	m.hiddenLines = make(map[int]int)
+	hunk := 0
+	for i, row := range rows {
+		if row.Kind == diff.HunkHeader {
+			if n := file.Hidden(hunk); n > 0 {
+				m.hiddenLines[i] = n
+			}
+			hunk++
+		}
+	}
+}
+
+// keepExpansion keeps the context revealed around the hunks when the diff
+// of the same file is reloaded, reading the new side again.
+func (m *Model) keepExpansion() {
+	e := m.expansion
+	if e == nil {
+		return
+	}
+	if e.path != m.selectedPath || e.section != m.section || m.diffBase == nil {
+		m.expansion = nil
+		return
+	}
+	content, err := m.newContent()
+	if err != nil {
+		m.expansion = nil
+		return
+	}
+	e.content, e.lines = content, countLines(content)
+}
+
+// expandedFile returns the loaded diff with the revealed context.
+func (m Model) expandedFile() *diff.File {
+	e := m.expansion
+	if e == nil || m.diffBase == nil {
+		return m.diffBase
+	}
+	return m.diffBase.Expand(e.content, func(n int) bool { return e.all || e.shown[n] })
+}
+
+// newContent reads the new side of the selected file, which hidden context
+// is taken from: the side of its section while split, the working tree, or
+// the head of the range.
+func (m Model) newContent() (string, error) {
+	var content []byte
+	var err error
+	switch {
+	case m.section != "":
+		content, err = m.vcs.SectionFile(m.section, m.selectedPath)
+	case m.rng.WorkingCopy():
+		content, err = os.ReadFile(filepath.Join(m.vcs.GetRepoRoot(), m.selectedPath))
+	default:
+		content, err = m.vcs.ShowFile(m.rng.Head, m.selectedPath)
+	}
+	return string(content), err
+}
+
+func countLines(content string) int {
+	if content == "" {
+		return 0
+	}
+	return strings.Count(strings.TrimSuffix(content, "\n"), "\n") + 1
+}
+
+// expandContext handles the z commands that show and hide unchanged lines:
+// k and j reveal more above and below the hunk under the cursor, o opens
+// the hidden lines above it, R shows the whole file and M goes back to the
+// context of the diff.
+func (m *Model) expandContext(key string) {
+	f := m.diffFile
+	if f == nil || len(f.Hunks) == 0 {
+		m.statusMsg = "No hunks to expand"
+		return
+	}
+	if key == "M" {
+		if m.expansion == nil {
+			return
+		}
+		m.expansion = nil
+		m.reexpand()
+		m.statusMsg = "Showing the context of the diff"
+		return
+	}
+	if m.pipedDiff != "" {
+		m.statusMsg = "Expanding context is unavailable for piped diffs"
+		return
+	}
+	if f.NewFile || f.DeletedFile {
+		m.statusMsg = "The whole file is shown"
+		return
+	}
+
+	e := m.expansion
+	if e == nil {
+		content, err := m.newContent()
+		if err != nil {
+			m.statusMsg = err.Error()
+			return
+		}
+		e = &expansion{
+			path:    m.selectedPath,
+			section: m.section,
+			content: content,
+			lines:   countLines(content),
+			shown:   make(map[int]bool),
+		}
+	}
+
+	hunk := m.hunkAt(m.diffCursor)
+	first, last := f.NewRange(hunk)
+	above := f.Hidden(hunk)
+	below := e.lines - last
+	if hunk+1 < len(f.Hunks) {
+		below = f.Hidden(hunk + 1)
+	}
+
+	switch key {
+	case "k", "o":
+		if above == 0 {
+			m.statusMsg = "Nothing hidden above this hunk"
+			return
+		}
+		n := min(above, contextStep)
+		if key == "o" {
+			n = above
+		}
+		e.reveal(first-n, first-1)
+	case "j":
+		if below <= 0 {
+			m.statusMsg = "Nothing hidden below this hunk"
+			return
+		}
+		e.reveal(last+1, last+min(below, contextStep))
+	case "R":
+		e.all = true
+	}
+	m.expansion = e
+	m.reexpand()
+}
+
+// reexpand shows the loaded diff with the context revealed now, keeping
+// the line under the cursor in place.
+func (m *Model) reexpand() {
+	var anchor *cursorAnchor
+	if m.cursorValid() {
+		anchor = &cursorAnchor{
+			path:   m.selectedPath,
+			line:   m.diffLines[m.diffCursor],
+			offset: m.cursorPos() - m.diffViewport.YOffset,
+		}
+	}
+	m.setDiffFile(m.expandedFile())
+	m.diffCursor = m.snapCursor(0, 1)
+	if anchor != nil {
+		m.restoreCursor(*anchor)
+	}
+	if m.searchRe != nil {
+		m.setSearch(m.searchPattern)
+	}
+	m.syncComments()
+	m.visualMode = false
+}
+
+// hunkAt returns the index of the hunk that row idx belongs to.
+func (m Model) hunkAt(idx int) int {
+	hunk := -1
+	for i := 0; i <= idx && i < len(m.diffLines); i++ {
+		if m.diffLines[i].Kind == diff.HunkHeader {
+			hunk++
+		}
+	}
+	return max(hunk, 0)
+}
+
+// gapLine draws the separator standing for the lines hidden above a hunk.
+func gapLine(hidden, width int) string {
+	label := fmt.Sprintf(" ⋯ %d lines hidden ", hidden)
+	if hidden == 1 {
+		label = " ⋯ 1 line hidden "
+	}
+	rule := max(width-len([]rune(label))-2, 0)
+	return DiffCtxGutter.Render("──" + label + strings.Repeat("─", rule))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"strings"
 
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
@@ -11,11 +12,16 @@ import (
 	"github.com/charmbracelet/x/ansi"
 	"github.com/oug-t/difi/internal/config"
 	"github.com/oug-t/difi/internal/tree"
+	"github.com/oug-t/difi/internal/vcs"
 )
 
 type TreeDelegate struct {
-	Config  config.Config
-	Focused bool
+	Config   config.Config
+	Focused  bool
+	Stage    map[string]vcs.StageState
+	Viewed   map[string]bool
+	Comments map[string]int // number of comments on each file
+	Sections bool           // tree is split into sections, see toggleSections
 }
 
 func (d TreeDelegate) Height() int  { return 1 }
@@ -51,24 +57,115 @@ func (d TreeDelegate) Render(w io.Writer, m list.Model, index int, item list.Ite
 	if maxWidth < 4 {
 		maxWidth = 4
 	}
-	title = ansi.Truncate(title, maxWidth, "…")
+
+	marks := d.marks(i)
+	titleWidth := maxWidth
+	for _, mk := range marks {
+		titleWidth -= 1 + ansi.StringWidth(mk.glyph)
+	}
+	// A directory's name matters more than its summary: drop counts that
+	// do not fit.
+	for i.IsDir && len(marks) > 0 && titleWidth < ansi.StringWidth(title) {
+		titleWidth += 1 + ansi.StringWidth(marks[len(marks)-1].glyph)
+		marks = marks[:len(marks)-1]
+	}
+	titleWidth = max(titleWidth, 1)
+	title = ansi.Truncate(title, titleWidth, "…")
 
 	if index == m.Index() {
 		style := lipgloss.NewStyle().
 			Background(lipgloss.Color("237")).
 			Foreground(lipgloss.Color("255")).
 			Bold(true).
-			Width(maxWidth)
+			Width(titleWidth)
 
 		if !d.Focused {
 			style = style.Foreground(lipgloss.Color("245"))
 		}
 
 		fmt.Fprint(w, style.Render(title))
+		for _, mk := range marks {
+			fmt.Fprint(w, mk.style.Background(lipgloss.Color("237")).Render(" "+mk.glyph))
+		}
 	} else {
 		style := lipgloss.NewStyle().
 			Foreground(lipgloss.Color("252")).
-			Width(maxWidth)
+			Width(titleWidth)
+		if !i.IsDir && d.Viewed[d.path(i)] {
+			style = ViewedFileStyle.Copy().Width(titleWidth)
+		}
 		fmt.Fprint(w, style.Render(title))
+		for _, mk := range marks {
+			fmt.Fprint(w, mk.style.Render(" "+mk.glyph))
+		}
+	}
+}
+
+// path returns the repository path of a file, without its section.
+func (d TreeDelegate) path(i tree.TreeItem) string {
+	if !d.Sections {
+		return i.FullPath
+	}
+	_, path, _ := strings.Cut(i.FullPath, "/")
+	return path
+}
+
+// treeMark is a glyph shown after a file name.
+type treeMark struct {
+	glyph string
+	style lipgloss.Style
+}
+
+// marks returns the glyphs flagging comments on a file, whether it has been
+// viewed, how much of it is staged and how it changed. Directories get the
+// number of files below them of each status.
+func (d TreeDelegate) marks(i tree.TreeItem) []treeMark {
+	if i.IsDir {
+		return statusCounts(i.Counts)
+	}
+	var marks []treeMark
+	if d.Comments[d.path(i)] > 0 {
+		marks = append(marks, treeMark{commentMark, CommentMarkStyle})
+	}
+	if d.Viewed[d.path(i)] {
+		marks = append(marks, treeMark{"✓", ViewedMarkStyle})
+	}
+	if glyph, style := d.stageMark(i); glyph != "" {
+		marks = append(marks, treeMark{glyph, style})
+	}
+	if i.Status != 0 {
+		marks = append(marks, treeMark{string(i.Status), FileStatusStyles[i.Status]})
+	}
+	return marks
+}
+
+// statusCounts returns a mark such as "2M" for each status of the files
+// below a directory.
+func statusCounts(counts map[byte]int) []treeMark {
+	var marks []treeMark
+	for _, st := range []byte(tree.StatusOrder) {
+		if n := counts[st]; n > 0 {
+			marks = append(marks, treeMark{fmt.Sprintf("%d%c", n, st), FileStatusStyles[st]})
+		}
+	}
+	return marks
+}
+
+// stageMark returns the glyph showing how much of a file is staged.
+func (d TreeDelegate) stageMark(i tree.TreeItem) (string, lipgloss.Style) {
+	if i.IsDir || d.Stage == nil {
+		return "", lipgloss.Style{}
+	}
+	state, ok := d.Stage[d.path(i)]
+	if !ok {
+		return "", lipgloss.Style{}
+	}
+	switch state {
+	case vcs.Staged:
+		return "●", StagedMarkStyle
+	case vcs.PartiallyStaged:
+		return "◐", PartialMarkStyle
+	default:
+		return "○", UnstagedMarkStyle
 	}
 }
@@ -0,0 +1,94 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+const bgReset = "\x1b[49m"
+
+// emphasize wraps the given spans of the visible text of s in the on and off
+// escape sequences. Syntax highlighting resets attributes between tokens, so
+// on is re-applied after every escape sequence inside a span.
+func emphasize(s string, spans []diff.Span, on, off string) string {
+	if len(spans) == 0 {
+		return s
+	}
+
+	var b strings.Builder
+	pos, k := 0, 0
+	in := false
+
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' {
+			j := escapeEnd(s, i)
+			b.WriteString(s[i:j])
+			if in {
+				b.WriteString(on)
+			}
+			i = j
+			continue
+		}
+
+		for k < len(spans) && pos >= spans[k].End {
+			k++
+		}
+		want := k < len(spans) && pos >= spans[k].Start
+		if want != in {
+			if want {
+				b.WriteString(on)
+			} else {
+				b.WriteString(off)
+			}
+			in = want
+		}
+
+		b.WriteByte(s[i])
+		pos++
+		i++
+	}
+
+	if in {
+		b.WriteString(off)
+	}
+	return b.String()
+}
+
+// escapeEnd returns the index just past the escape sequence starting at i.
+func escapeEnd(s string, i int) int {
+	if i+1 >= len(s) {
+		return len(s)
+	}
+	switch s[i+1] {
+	case '[':
+		for j := i + 2; j < len(s); j++ {
+			if s[j] >= 0x40 && s[j] <= 0x7e {
+				return j + 1
+			}
+		}
+	case ']':
+		for j := i + 2; j < len(s); j++ {
+			if s[j] == '\a' {
+				return j + 1
+			}
+			if s[j] == '\x1b' && j+1 < len(s) && s[j+1] == '\\' {
+				return j + 2
+			}
+		}
+	default:
+		return i + 2
+	}
+	return len(s)
+}
+
+// lineEmphasis returns the intraline emphasis escape and spans for diff line idx.
+func (m Model) lineEmphasis(idx int) (string, []diff.Span) {
+	if idx >= len(m.diffEmphasis) || len(m.diffEmphasis[idx]) == 0 {
+		return "", nil
+	}
+	if m.diffLines[idx].Kind == diff.Added {
+		return DiffAddEmphasisBg, m.diffEmphasis[idx]
+	}
+	return DiffDelEmphasisBg, m.diffEmphasis[idx]
+}
@@ -0,0 +1,236 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/tree"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// RenamesMsg carries the renamed and copied files of Range.
+type RenamesMsg struct {
+	Range   vcs.Range
+	Renames map[string]vcs.Rename
+}
+
+// FileSizesMsg carries the size of both sides of a binary file, -1 for a
+// side it does not exist on.
+type FileSizesMsg struct {
+	Path     string
+	Old, New int64
+}
+
+func (m Model) fetchRenamesCmd() tea.Cmd {
+	rng := m.rng
+	if m.pipedDiff != "" {
+		text := m.pipedDiff
+		return func() tea.Msg {
+			return RenamesMsg{Range: rng, Renames: vcs.RenamesFromDiff(text)}
+		}
+	}
+	client := m.vcs
+	return func() tea.Msg {
+		renames, err := client.Renames(rng)
+		if err != nil {
+			return nil
+		}
+		return RenamesMsg{Range: rng, Renames: renames}
+	}
+}
+
+// setRenames shows where renamed and copied files came from in the tree.
+func (m *Model) setRenames(msg RenamesMsg) tea.Cmd {
+	origins := make(map[string]tree.Origin, len(msg.Renames))
+	for path, r := range msg.Renames {
+		origins[path] = tree.Origin{Path: r.From, Similarity: r.Similarity, Copy: r.Copy}
+	}
+	m.origins, m.originsRng = origins, msg.Range
+	if m.sections != nil {
+		return nil
+	}
+	m.treeState.SetOrigins(origins)
+	m.fileList.SetItems(m.treeState.Items())
+
+	// A diff loaded before the renames were known shows the file as added;
+	// load it again with its origin.
+	if _, ok := origins[m.selectedPath]; ok && m.diffBase != nil && !m.diffBase.Renamed() && !m.diffBase.Copied {
+		return m.fetchDiffCmd()
+	}
+	return nil
+}
+
+// origin returns the path the file at path was renamed or copied from in
+// the range under review, or "".
+func (m Model) origin(path string) string {
+	if m.originsRng != m.rng {
+		return ""
+	}
+	return m.origins[path].Path
+}
+
+// fetchFileSizesCmd loads the size of both sides of a binary file, which
+// its diff does not show.
+func (m Model) fetchFileSizesCmd(f *diff.File) tea.Cmd {
+	if m.pipedDiff != "" || f == nil || !f.Binary {
+		return nil
+	}
+	client, rng, path := m.vcs, m.rng, m.selectedPath
+	oldPath, newPath := f.OldPath, f.NewPath
+	return func() tea.Msg {
+		msg := FileSizesMsg{Path: path, Old: -1, New: -1}
+		if oldPath != "" {
+			if content, err := client.ShowFile(rng.Base, oldPath); err == nil {
+				msg.Old = int64(len(content))
+			}
+		}
+		switch {
+		case newPath == "":
+		case rng.WorkingCopy():
+			if info, err := os.Stat(filepath.Join(client.GetRepoRoot(), newPath)); err == nil {
+				msg.New = info.Size()
+			}
+		default:
+			if content, err := client.ShowFile(rng.Head, newPath); err == nil {
+				msg.New = int64(len(content))
+			}
+		}
+		return msg
+	}
+}
+
+// fileInfo returns the lines above the diff describing what its lines do
+// not show: renames and copies, mode and symlink changes, binary content.
+func (m Model) fileInfo(width int) []string {
+	f := m.diffFile
+	if f == nil {
+		return nil
+	}
+
+	var info []string
+	switch {
+	case f.Copied:
+		info = append(info, "Copied from "+f.OldPath+similarity(f))
+	case f.Renamed():
+		info = append(info, "Renamed from "+f.OldPath+similarity(f))
+	}
+	switch {
+	case f.Symlink():
+		info = append(info, symlinkInfo(f))
+	case f.ModeChanged():
+		info = append(info, modeInfo(f))
+	}
+	if f.Binary {
+		info = append(info, m.binaryInfo(f))
+	} else if len(info) > 0 && len(f.Hunks) == 0 {
+		info = append(info, "Content unchanged")
+	}
+	if len(info) == 0 {
+		return nil
+	}
+
+	lines := make([]string, 0, len(info)+1)
+	for _, l := range info {
+		lines = append(lines, FileInfoStyle.Render(ansi.Truncate(l, width, "…")))
+	}
+	return append(lines, CommitMetaStyle.Render(strings.Repeat("─", max(width, 0))))
+}
+
+func similarity(f *diff.File) string {
+	if f.Similarity == 0 || f.Similarity == 100 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d%% similar)", f.Similarity)
+}
+
+// symlinkInfo describes a symlink by its targets, which are the content of
+// its diff lines.
+func symlinkInfo(f *diff.File) string {
+	var oldTarget, newTarget string
+	for _, h := range f.Hunks {
+		for _, l := range h.Lines {
+			switch l.Kind {
+			case diff.Deleted:
+				oldTarget = l.Content
+			case diff.Added:
+				newTarget = l.Content
+			}
+		}
+	}
+	switch {
+	case f.NewFile:
+		return "Symlink to " + newTarget
+	case f.DeletedFile:
+		return "Removed symlink to " + oldTarget
+	case f.ModeChanged():
+		return modeInfo(f)
+	case oldTarget == newTarget:
+		return "Symlink to " + newTarget
+	}
+	return "Symlink target " + oldTarget + " → " + newTarget
+}
+
+func modeInfo(f *diff.File) string {
+	s := "Mode " + f.OldMode + " → " + f.NewMode
+	switch {
+	case f.NewMode == "120000":
+		s += " (now a symlink)"
+	case f.OldMode == "120000":
+		s += " (no longer a symlink)"
+	case f.NewMode == "100755":
+		s += " (now executable)"
+	case f.OldMode == "100755":
+		s += " (no longer executable)"
+	}
+	return s
+}
+
+// binaryInfo describes a binary file by its sizes once they are loaded.
+func (m Model) binaryInfo(f *diff.File) string {
+	sizes := m.fileSizes
+	if sizes == nil || sizes.Path != m.selectedPath {
+		switch {
+		case f.NewFile:
+			return "Binary file added"
+		case f.DeletedFile:
+			return "Binary file deleted"
+		}
+		return "Binary file changed"
+	}
+	switch {
+	case sizes.Old < 0 && sizes.New >= 0:
+		return "Binary file added · " + formatSize(sizes.New)
+	case sizes.New < 0 && sizes.Old >= 0:
+		return "Binary file deleted · " + formatSize(sizes.Old)
+	case sizes.Old < 0:
+		return "Binary file changed"
+	}
+	delta := sizes.New - sizes.Old
+	sign := "+"
+	if delta < 0 {
+		sign, delta = "-", -delta
+	}
+	return fmt.Sprintf("Binary file · %s → %s (%s%s)", formatSize(sizes.Old), formatSize(sizes.New), sign, formatSize(delta))
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+}
+
+// diffHeader returns the lines shown above the diff: the commit under
+// review and what the diff of the file does not show.
+func (m Model) diffHeader(width int) []string {
+	return append(m.commitHeader(width), m.fileInfo(width)...)
+}
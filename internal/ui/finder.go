@@ -0,0 +1,353 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/sahilm/fuzzy"
+
+	"github.com/oug-t/difi/internal/tree"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// FileStatusesMsg carries how each changed file changed, for status filters.
+type FileStatusesMsg struct {
+	Statuses map[string]vcs.FileStatus
+}
+
+// finderMaxRows caps the number of results listed in the finder popup.
+const finderMaxRows = 15
+
+// openFinder shows the fuzzy file finder popup.
+func (m *Model) openFinder() {
+	m.finderOpen = true
+	m.finderInput = ""
+	m.finderCursor = 0
+	m.updateFinder()
+	m.inputBuffer = ""
+}
+
+// updateFinder recomputes the finder results for the current input.
+func (m *Model) updateFinder() {
+	files := m.treeState.Files()
+	if m.finderInput == "" {
+		m.finderMatches = make(fuzzy.Matches, len(files))
+		for i, f := range files {
+			m.finderMatches[i] = fuzzy.Match{Str: f, Index: i}
+		}
+	} else {
+		m.finderMatches = fuzzy.Find(m.finderInput, files)
+	}
+	if m.finderCursor >= len(m.finderMatches) {
+		m.finderCursor = len(m.finderMatches) - 1
+	}
+	if m.finderCursor < 0 {
+		m.finderCursor = 0
+	}
+}
+
+// handleFinderKey edits the finder input and moves through its results.
+func (m Model) handleFinderKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "ctrl+c":
+		m.finderOpen = false
+		return m, nil
+
+	case "enter":
+		m.finderOpen = false
+		if len(m.finderMatches) == 0 {
+			return m, nil
+		}
+		path := m.finderMatches[m.finderCursor].Str
+		if m.treeState.Filtered() && !m.filterKeeps(path) {
+			m.setFilter("")
+		}
+		return m, m.selectFile(path)
+
+	case "up", "ctrl+p", "ctrl+k":
+		if m.finderCursor > 0 {
+			m.finderCursor--
+		}
+		return m, nil
+
+	case "down", "ctrl+n", "ctrl+j":
+		if m.finderCursor < len(m.finderMatches)-1 {
+			m.finderCursor++
+		}
+		return m, nil
+	}
+
+	switch msg.Type {
+	case tea.KeyBackspace:
+		if r := []rune(m.finderInput); len(r) > 0 {
+			m.finderInput = string(r[:len(r)-1])
+		}
+	case tea.KeySpace:
+		m.finderInput += " "
+	case tea.KeyRunes:
+		m.finderInput += string(msg.Runes)
+	default:
+		return m, nil
+	}
+	m.finderCursor = 0
+	m.updateFinder()
+	return m, nil
+}
+
+// renderFinder draws the finder popup centered in a w×h area.
+func (m Model) renderFinder(w, h int) string {
+	boxWidth := w * 2 / 3
+	if boxWidth < 40 {
+		boxWidth = w - 4
+	}
+	innerWidth := boxWidth - 4
+	if innerWidth < 10 {
+		innerWidth = 10
+	}
+
+	rows := h - 6
+	if rows > finderMaxRows {
+		rows = finderMaxRows
+	}
+	if rows < 1 {
+		rows = 1
+	}
+
+	var b strings.Builder
+	b.WriteString(FinderPromptStyle.Render("> ") + m.finderInput + "█\n")
+
+	start := 0
+	if m.finderCursor >= rows {
+		start = m.finderCursor - rows + 1
+	}
+	for i := start; i < len(m.finderMatches) && i < start+rows; i++ {
+		match := m.finderMatches[i]
+		line := highlightMatch(match.Str, match.MatchedIndexes)
+		line = ansi.Truncate(line, innerWidth-2, "…")
+		if i == m.finderCursor {
+			b.WriteString(FinderSelectedStyle.Copy().Width(innerWidth).Render("▌ " + line))
+		} else {
+			b.WriteString("  " + line)
+		}
+		b.WriteString("\n")
+	}
+
+	count := fmt.Sprintf("%d/%d", len(m.finderMatches), len(m.treeState.Files()))
+	b.WriteString(HelpTextStyle.Render(count))
+
+	box := FinderBoxStyle.Copy().Width(boxWidth).Render(b.String())
+	return lipgloss.Place(w, h, lipgloss.Center, lipgloss.Center, box)
+}
+
+// highlightMatch emphasizes the fuzzy-matched characters of s.
+func highlightMatch(s string, matched []int) string {
+	if len(matched) == 0 {
+		return s
+	}
+	hit := make(map[int]bool, len(matched))
+	for _, i := range matched {
+		hit[i] = true
+	}
+	var b strings.Builder
+	for i, r := range s {
+		if hit[i] {
+			b.WriteString(FinderMatchStyle.Render(string(r)))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// treeFilter narrows the tree to files matching a query such as
+// "handler ext:go status:modified". Plain words are fuzzy-matched against
+// the path; ext: (or *.go) and status: terms may be repeated to allow
+// several values.
+type treeFilter struct {
+	text     string
+	exts     map[string]bool
+	statuses map[vcs.FileStatus]bool
+}
+
+// statusAliases maps the values accepted by status: to file statuses.
+var statusAliases = map[string][]vcs.FileStatus{
+	"a":          {vcs.StatusAdded, vcs.StatusUntracked},
+	"added":      {vcs.StatusAdded, vcs.StatusUntracked},
+	"m":          {vcs.StatusModified},
+	"modified":   {vcs.StatusModified},
+	"d":          {vcs.StatusDeleted},
+	"deleted":    {vcs.StatusDeleted},
+	"?":          {vcs.StatusUntracked},
+	"untracked":  {vcs.StatusUntracked},
+	"u":          {vcs.StatusConflicted},
+	"conflicted": {vcs.StatusConflicted},
+}
+
+func parseFilter(query string) treeFilter {
+	var f treeFilter
+	var words []string
+	for _, term := range strings.Fields(query) {
+		key, val, ok := strings.Cut(term, ":")
+		if strings.HasPrefix(term, "*.") {
+			key, val, ok = "ext", term[2:], true
+		}
+		switch {
+		case ok && (key == "ext" || key == "e") && val != "":
+			if f.exts == nil {
+				f.exts = make(map[string]bool)
+			}
+			f.exts["."+strings.TrimPrefix(strings.ToLower(val), ".")] = true
+		case ok && (key == "status" || key == "s") && statusAliases[strings.ToLower(val)] != nil:
+			if f.statuses == nil {
+				f.statuses = make(map[vcs.FileStatus]bool)
+			}
+			for _, st := range statusAliases[strings.ToLower(val)] {
+				f.statuses[st] = true
+			}
+		default:
+			words = append(words, term)
+		}
+	}
+	f.text = strings.Join(words, " ")
+	return f
+}
+
+// match returns the subset of files the filter keeps.
+func (f treeFilter) match(files []string, statuses map[string]vcs.FileStatus) map[string]bool {
+	candidates := files[:0:0]
+	for _, path := range files {
+		if f.exts != nil && !f.exts[strings.ToLower(filepath.Ext(path))] {
+			continue
+		}
+		if f.statuses != nil {
+			st, ok := statuses[path]
+			if !ok {
+				st = vcs.StatusModified
+			}
+			if !f.statuses[st] {
+				continue
+			}
+		}
+		candidates = append(candidates, path)
+	}
+
+	keep := make(map[string]bool)
+	if f.text == "" {
+		for _, path := range candidates {
+			keep[path] = true
+		}
+		return keep
+	}
+	for _, match := range fuzzy.Find(f.text, candidates) {
+		keep[match.Str] = true
+	}
+	return keep
+}
+
+// startFilter opens the tree filter prompt.
+func (m *Model) startFilter() {
+	m.filtering = true
+	m.filterPrev = m.filterQuery
+	m.inputBuffer = ""
+}
+
+// handleFilterKey edits the filter prompt, narrowing the tree as it goes.
+func (m Model) handleFilterKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	query := m.filterQuery
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.filtering = false
+		return m, nil
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.filtering = false
+		return m, m.setFilter(m.filterPrev)
+	case tea.KeyBackspace:
+		if r := []rune(query); len(r) > 0 {
+			query = string(r[:len(r)-1])
+		}
+	case tea.KeySpace:
+		query += " "
+	case tea.KeyRunes:
+		query += string(msg.Runes)
+	default:
+		return m, nil
+	}
+	return m, m.setFilter(query)
+}
+
+// setFilter applies query to the tree and keeps the selection on a visible
+// file, loading its diff if the selection had to move.
+func (m *Model) setFilter(query string) tea.Cmd {
+	m.filterQuery = query
+	if strings.TrimSpace(query) == "" {
+		m.treeState.SetFilter(nil)
+	} else {
+		f := parseFilter(query)
+		m.treeState.SetFilter(f.match(m.treeState.Files(), m.treeStatuses()))
+	}
+
+	items := m.treeState.Items()
+	m.fileList.SetItems(items)
+	m.fileList.ResetSelected()
+
+	first := -1
+	for idx, item := range items {
+		ti, ok := item.(tree.TreeItem)
+		if !ok || ti.IsDir {
+			continue
+		}
+		if ti.FullPath == m.treeKey(m.selectedPath) {
+			m.fileList.Select(idx)
+			return nil
+		}
+		if first < 0 {
+			first = idx
+		}
+	}
+	if first < 0 {
+		return nil
+	}
+	m.fileList.Select(first)
+	return m.selectFile(items[first].(tree.TreeItem).FullPath)
+}
+
+// filterKeeps reports whether path passes the active tree filter.
+func (m *Model) filterKeeps(path string) bool {
+	for _, item := range m.treeState.Items() {
+		if ti, ok := item.(tree.TreeItem); ok && ti.FullPath == path {
+			return true
+		}
+	}
+	return false
+}
+
+// filteredCount returns how many files the tree filter keeps.
+func (m Model) filteredCount() int {
+	n := 0
+	for _, item := range m.fileList.Items() {
+		if ti, ok := item.(tree.TreeItem); ok && !ti.IsDir {
+			n++
+		}
+	}
+	return n
+}
+
+// fetchFileStatusesCmd loads how each changed file changed.
+func (m Model) fetchFileStatusesCmd() tea.Cmd {
+	if m.pipedDiff != "" {
+		return func() tea.Msg {
+			return FileStatusesMsg{Statuses: vcs.FileStatusesFromDiff(m.pipedDiff)}
+		}
+	}
+	return func() tea.Msg {
+		statuses, err := m.vcs.FileStatuses(m.rng)
+		if err != nil {
+			return nil
+		}
+		return FileStatusesMsg{Statuses: statuses}
+	}
+}
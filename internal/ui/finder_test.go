@@ -0,0 +1,118 @@
+package ui
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/oug-t/difi/internal/tree"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		query    string
+		text     string
+		exts     []string
+		statuses string
+	}{
+		{"handler", "handler", nil, ""},
+		{"handler ext:go status:modified", "handler", []string{".go"}, "M"},
+		{"*.go *.TS", "", []string{".go", ".ts"}, ""},
+		{"e:.md ext:go", "", []string{".go", ".md"}, ""},
+		{"s:a", "", nil, "?A"},
+		{"status:D s:u", "", nil, "DU"},
+		{"status:bogus", "status:bogus", nil, ""},
+		{"ext: main", "ext: main", nil, ""},
+		{"foo  bar", "foo bar", nil, ""},
+	}
+	for _, tt := range tests {
+		f := parseFilter(tt.query)
+		var exts []string
+		for ext := range f.exts {
+			exts = append(exts, ext)
+		}
+		sort.Strings(exts)
+		var statuses []byte
+		for st := range f.statuses {
+			statuses = append(statuses, byte(st))
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i] < statuses[j] })
+		if f.text != tt.text || !reflect.DeepEqual(exts, tt.exts) || string(statuses) != tt.statuses {
+			t.Errorf("parseFilter(%q) = %q %v %q, want %q %v %q",
+				tt.query, f.text, exts, statuses, tt.text, tt.exts, tt.statuses)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	files := []string{"cmd/main.go", "internal/handler.go", "README.md", "new.go", "notes.txt", "old.go"}
+	statuses := map[string]vcs.FileStatus{
+		"internal/handler.go": vcs.StatusModified,
+		"README.md":           vcs.StatusModified,
+		"new.go":              vcs.StatusAdded,
+		"notes.txt":           vcs.StatusUntracked,
+		"old.go":              vcs.StatusDeleted,
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"ext:go", []string{"cmd/main.go", "internal/handler.go", "new.go", "old.go"}},
+		{"*.MD", []string{"README.md"}},
+		{"status:added", []string{"new.go", "notes.txt"}},
+		{"s:m", []string{"README.md", "cmd/main.go", "internal/handler.go"}}, // no status counts as modified
+		{"s:d s:?", []string{"notes.txt", "old.go"}},
+		{"ext:go s:m", []string{"cmd/main.go", "internal/handler.go"}},
+		{"hdl", []string{"internal/handler.go"}},
+		{"hdl ext:md", nil},
+		{"status:conflicted", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for path := range parseFilter(tt.query).match(files, statuses) {
+			got = append(got, path)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("match(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFinderRanking(t *testing.T) {
+	files := []string{"docs/model-guide.txt", "internal/mode/del.go", "internal/ui/model.go", "cmd/main.go"}
+	m := Model{treeState: tree.New(files)}
+
+	m.updateFinder()
+	if got, want := len(m.finderMatches), len(files); got != want {
+		t.Fatalf("empty input: %d results, want %d", got, want)
+	}
+	for i, match := range m.finderMatches {
+		if match.Str != m.treeState.Files()[i] {
+			t.Errorf("empty input: result %d = %q, want tree order", i, match.Str)
+		}
+	}
+
+	m.finderInput = "model.go"
+	m.updateFinder()
+	if len(m.finderMatches) < 2 || m.finderMatches[0].Str != "internal/ui/model.go" {
+		t.Errorf("model.go: results %v, want internal/ui/model.go first", m.finderMatches)
+	}
+
+	m.finderCursor = 3
+	m.finderInput = "main"
+	m.updateFinder()
+	if len(m.finderMatches) == 0 || m.finderMatches[0].Str != "cmd/main.go" {
+		t.Errorf("main: results %v, want cmd/main.go first", m.finderMatches)
+	}
+	if m.finderCursor != len(m.finderMatches)-1 {
+		t.Errorf("cursor = %d, want clamped to %d", m.finderCursor, len(m.finderMatches)-1)
+	}
+
+	m.finderInput = "zzz"
+	m.updateFinder()
+	if len(m.finderMatches) != 0 || m.finderCursor != 0 {
+		t.Errorf("zzz: results %v, cursor %d, want none at 0", m.finderMatches, m.finderCursor)
+	}
+}
@@ -0,0 +1,149 @@
+package ui
+
+import (
+	"strconv"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// Modes for ui.line_numbers.
+const (
+	lineNumbersHybrid   = "hybrid"
+	lineNumbersRelative = "relative"
+	lineNumbersAbsolute = "absolute"
+	lineNumbersHidden   = "hidden"
+)
+
+var lineNumberModes = []string{lineNumbersHybrid, lineNumbersRelative, lineNumbersAbsolute, lineNumbersHidden}
+
+// normalizeLineNumbers returns mode if it is known, and hybrid otherwise.
+func normalizeLineNumbers(mode string) string {
+	for _, known := range lineNumberModes {
+		if mode == known {
+			return mode
+		}
+	}
+	return lineNumbersHybrid
+}
+
+// cycleLineNumbers switches to the next line number mode.
+func (m *Model) cycleLineNumbers() {
+	for i, mode := range lineNumberModes {
+		if mode == m.lineNumbers {
+			m.lineNumbers = lineNumberModes[(i+1)%len(lineNumberModes)]
+			break
+		}
+	}
+	m.statusMsg = "Line numbers: " + m.lineNumbers
+}
+
+// lineNumberWidth returns the width of one line number column, wide enough
+// for the largest line number in the diff.
+func (m Model) lineNumberWidth() int {
+	w := len(strconv.Itoa(m.maxLineNo))
+	if w < 4 {
+		w = 4
+	}
+	return w
+}
+
+// unifiedGutterWidth returns the width taken by line numbers in the unified
+// layout, including their margins.
+func (m Model) unifiedGutterWidth() int {
+	switch m.lineNumbers {
+	case lineNumbersHidden:
+		return 0
+	case lineNumbersAbsolute:
+		return 2 * (m.lineNumberWidth() + 1)
+	}
+	return m.lineNumberWidth() + 1
+}
+
+// unifiedLineNumber renders the line number gutter of diff line i. Absolute
+// mode shows separate old and new columns.
+func (m Model) unifiedLineNumber(i int) string {
+	l := m.diffLines[i]
+	style := LineNumberStyle.Copy().Width(m.lineNumberWidth())
+
+	switch m.lineNumbers {
+	case lineNumbersHidden:
+		return ""
+	case lineNumbersAbsolute:
+		oldNum, newNum := "", ""
+		if l.Kind != diff.Added {
+			oldNum = strconv.Itoa(l.OldLine)
+		}
+		if l.Kind != diff.Deleted {
+			newNum = strconv.Itoa(l.NewLine)
+		}
+		return style.Render(oldNum) + style.Render(newNum)
+	case lineNumbersHybrid:
+		if i == m.diffCursor {
+			return style.Render(strconv.Itoa(realLine(l)))
+		}
+	}
+	return style.Render(strconv.Itoa(m.relativeLine(i)))
+}
+
+// splitLineNumber renders the line number of diff line idx shown on side of
+// split row pos.
+func (m Model) splitLineNumber(idx, pos int, side splitSide) string {
+	l := m.diffLines[idx]
+	style := LineNumberStyle.Copy().Width(m.lineNumberWidth())
+
+	num := l.NewLine
+	if side == sideLeft {
+		num = l.OldLine
+	}
+
+	switch m.lineNumbers {
+	case lineNumbersHidden:
+		return ""
+	case lineNumbersAbsolute:
+		return style.Render(strconv.Itoa(num))
+	case lineNumbersHybrid:
+		if pos == m.cursorPos() {
+			return style.Render(strconv.Itoa(num))
+		}
+	}
+	return style.Render(strconv.Itoa(m.relativePos(pos)))
+}
+
+// realLine returns the number of l in the file it belongs to.
+func realLine(l diff.Line) int {
+	if l.Kind == diff.Deleted {
+		return l.OldLine
+	}
+	return l.NewLine
+}
+
+// relativeLine returns how many j or k presses separate diff line i from
+// the cursor in the unified layout.
+func (m Model) relativeLine(i int) int {
+	lo, hi := i, m.diffCursor
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	n := 0
+	for p := lo + 1; p <= hi; p++ {
+		if m.diffLines[p].Kind != diff.HunkHeader {
+			n++
+		}
+	}
+	return n
+}
+
+// relativePos is relativeLine for a position of the split layout.
+func (m Model) relativePos(pos int) int {
+	lo, hi := pos, m.cursorPos()
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	n := 0
+	for p := lo + 1; p <= hi; p++ {
+		if r := m.splitRows[p]; r.left < 0 || m.diffLines[r.left].Kind != diff.HunkHeader {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,124 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+func TestNormalizeLineNumbers(t *testing.T) {
+	for _, mode := range lineNumberModes {
+		if got := normalizeLineNumbers(mode); got != mode {
+			t.Errorf("normalizeLineNumbers(%q) = %q", mode, got)
+		}
+	}
+	for _, mode := range []string{"", "bogus", "Absolute"} {
+		if got := normalizeLineNumbers(mode); got != lineNumbersHybrid {
+			t.Errorf("normalizeLineNumbers(%q) = %q, want %q", mode, got, lineNumbersHybrid)
+		}
+	}
+}
+
+func TestCycleLineNumbers(t *testing.T) {
+	m := Model{lineNumbers: lineNumbersHybrid}
+	for _, want := range []string{lineNumbersRelative, lineNumbersAbsolute, lineNumbersHidden, lineNumbersHybrid} {
+		m.cycleLineNumbers()
+		if m.lineNumbers != want || m.statusMsg != "Line numbers: "+want {
+			t.Errorf("cycleLineNumbers() = %q, status %q, want %q", m.lineNumbers, m.statusMsg, want)
+		}
+	}
+}
+
+func TestLineNumberWidth(t *testing.T) {
+	tests := []struct {
+		maxLineNo int
+		mode      string
+		width     int
+		gutter    int
+	}{
+		{0, lineNumbersHybrid, 4, 5},
+		{9999, lineNumbersHybrid, 4, 5},
+		{10000, lineNumbersHybrid, 5, 6},
+		{123456, lineNumbersRelative, 6, 7},
+		{42, lineNumbersAbsolute, 4, 10},
+		{10000, lineNumbersAbsolute, 5, 12},
+		{42, lineNumbersHidden, 4, 0},
+	}
+	for _, tt := range tests {
+		m := Model{maxLineNo: tt.maxLineNo, lineNumbers: tt.mode}
+		if got := m.lineNumberWidth(); got != tt.width {
+			t.Errorf("lineNumberWidth() for %d = %d, want %d", tt.maxLineNo, got, tt.width)
+		}
+		if got := m.unifiedGutterWidth(); got != tt.gutter {
+			t.Errorf("unifiedGutterWidth() for %d %s = %d, want %d", tt.maxLineNo, tt.mode, got, tt.gutter)
+		}
+	}
+}
+
+// numberedLines returns a hunk of context line 10, deleted line 11, added
+// line 11 and context line 12, followed by a second hunk at line 40.
+func numberedLines() []diff.Line {
+	return []diff.Line{
+		{Kind: diff.HunkHeader, Content: "@@ -10,3 +10,3 @@"},
+		{Kind: diff.Context, OldLine: 10, NewLine: 10},
+		{Kind: diff.Deleted, OldLine: 11},
+		{Kind: diff.Added, NewLine: 11},
+		{Kind: diff.Context, OldLine: 12, NewLine: 12},
+		{Kind: diff.HunkHeader, Content: "@@ -40 +40 @@"},
+		{Kind: diff.Added, NewLine: 40},
+	}
+}
+
+func TestUnifiedLineNumber(t *testing.T) {
+	tests := []struct {
+		mode   string
+		cursor int
+		want   []string // gutter of lines 1 to 6, hunk headers left out
+	}{
+		{lineNumbersHybrid, 2, []string{"1", "11", "1", "2", "", "3"}},
+		{lineNumbersHybrid, 3, []string{"2", "1", "11", "1", "", "2"}},
+		{lineNumbersRelative, 2, []string{"1", "0", "1", "2", "", "3"}},
+		{lineNumbersAbsolute, 2, []string{"10 10", "11", "11", "12 12", "", "40"}},
+		{lineNumbersHidden, 2, []string{"", "", "", "", "", ""}},
+	}
+	for _, tt := range tests {
+		m := Model{diffLines: numberedLines(), diffCursor: tt.cursor, lineNumbers: tt.mode, maxLineNo: 40}
+		for i, want := range tt.want {
+			if m.diffLines[i+1].Kind == diff.HunkHeader {
+				continue
+			}
+			got := strings.Join(strings.Fields(ansi.Strip(m.unifiedLineNumber(i+1))), " ")
+			if got != want {
+				t.Errorf("%s, cursor %d: line %d = %q, want %q", tt.mode, tt.cursor, i+1, got, want)
+			}
+		}
+	}
+}
+
+func TestUnifiedLineNumberAbsoluteColumns(t *testing.T) {
+	m := Model{diffLines: numberedLines(), lineNumbers: lineNumbersAbsolute, maxLineNo: 40}
+	w := m.lineNumberWidth()
+	del := ansi.Strip(m.unifiedLineNumber(2))
+	add := ansi.Strip(m.unifiedLineNumber(3))
+	if strings.TrimSpace(del[:w]) != "11" || strings.TrimSpace(del[w:]) != "" {
+		t.Errorf("deleted line gutter = %q, want the old column only", del)
+	}
+	if strings.TrimSpace(add[:w]) != "" || strings.TrimSpace(add[w:]) != "11" {
+		t.Errorf("added line gutter = %q, want the new column only", add)
+	}
+}
+
+func TestRelativePos(t *testing.T) {
+	m := Model{diffLines: numberedLines(), splitView: true, diffCursor: 3}
+	m.diffViewport.Width = splitMinWidth
+	m.splitRows = buildSplitRows(m.diffLines)
+	// Rows: header, 10|10, 11|11 with the cursor, 12|12, header, |40.
+	for pos, want := range map[int]int{1: 1, 2: 0, 3: 1, 5: 2} {
+		if got := m.relativePos(pos); got != want {
+			t.Errorf("relativePos(%d) = %d, want %d", pos, got, want)
+		}
+	}
+}
@@ -1,17 +1,24 @@
 package ui
 
 import (
+	"errors"
 	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sahilm/fuzzy"
 
 	"github.com/oug-t/difi/internal/config"
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/review"
 	"github.com/oug-t/difi/internal/tree"
 	"github.com/oug-t/difi/internal/vcs"
+	"github.com/oug-t/difi/internal/watch"
 )
 
 type Focus int
@@ -21,7 +28,6 @@ const (
 	FocusDiff
 )
 
-var ansiRe = regexp.MustCompile("[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-Z\\d]*)*)?\u0007)|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PRZcf-ntqry=><~]))")
 var bgAnsiRe = regexp.MustCompile(`\x1b\[48;2;\d+;\d+;\d+m|\x1b\[4[0-9]m`)
 
 type StatsMsg struct {
@@ -30,6 +36,31 @@ type StatsMsg struct {
 	ByFile  map[string][2]int
 }
 
+// StageMsg reports the outcome of a stage or unstage request.
+type StageMsg struct {
+	Unstage bool
+	Err     error
+}
+
+// StageStatesMsg carries the per-file staging state for the tree.
+type StageStatesMsg struct {
+	States map[string]vcs.StageState
+}
+
+// DiscardMsg reports the outcome of discarding a selection or undoing it.
+type DiscardMsg struct {
+	Path  string
+	Patch string
+	Undo  bool
+	Err   error
+}
+
+// discardEntry is one step of the session's discard undo stack.
+type discardEntry struct {
+	path  string
+	patch string
+}
+
 type Model struct {
 	fileList     list.Model
 	treeState    *tree.FileTree
@@ -38,7 +69,8 @@ type Model struct {
 
 	selectedPath  string
 	currentBranch string
-	targetBranch  string
+	rng           vcs.Range
+	reviewRng     vcs.Range // range given on the command line
 	repoName      string
 
 	statsAdded   int
@@ -48,16 +80,80 @@ type Model struct {
 	currentFileDeleted int
 
 	fileStats map[string][2]int
+	fileSizes *FileSizesMsg // sizes of the selected binary file
+
+	origins    map[string]tree.Origin // renamed and copied files, see fetchRenamesCmd
+	originsRng vcs.Range              // range origins were found for
 
 	diffContent     string
-	diffLines       []string
+	diffBase        *diff.File // diff as loaded, before any context is revealed
+	diffFile        *diff.File
+	diffLines       []diff.Line
 	diffHighlighted []string
+	diffEmphasis    [][]diff.Span
+	maxLineNo       int
+	hiddenLines     map[int]int // lines hidden above the hunk header at each row
+	expansion       *expansion  // context revealed around the hunks, see expandContext
+	lineNumbers     string      // ui.line_numbers mode
 	diffCursor      int
-	visualMode      bool // Visual selection mode
-	visualStart     int  // Anchor for visual selection
-
-	inputBuffer string
-	pendingZ    bool
+	splitView       bool
+	splitRows       []splitRow
+	splitSide       splitSide
+	readOnlyFile    string // temp copy of a revision opened in the editor
+	visualMode      bool   // Visual selection mode
+	visualStart     int    // Anchor for visual selection
+
+	inputBuffer    string
+	pendingZ       bool
+	pendingBracket string // "[" or "]" awaiting a motion key
+	statusMsg      string
+
+	pendingDiscard string // patch awaiting confirmation
+	undoStack      []discardEntry
+
+	searching      bool   // search prompt is open
+	searchInput    string // pattern being typed
+	searchPattern  string // last submitted pattern, reused by n and N
+	searchBackward bool   // search started with ?
+	searchAll      bool   // n and N continue into other files
+	searchOrigin   int    // cursor when the prompt opened
+	searchRe       *regexp.Regexp
+	searchMatches  []searchMatch
+	searchIndex    int
+	searchJump     int // direction to jump in once the next diff loads
+
+	finderOpen    bool
+	finderInput   string
+	finderMatches fuzzy.Matches
+	finderCursor  int
+
+	filtering    bool   // tree filter prompt is open
+	filterQuery  string // active tree filter
+	filterPrev   string // filter to restore if the prompt is cancelled
+	fileStatuses map[string]vcs.FileStatus
+	sortByStatus bool // tree lists files by status, see toggleStatusSort
+
+	splitSections bool                                      // split view of the tree is on, see toggleSections
+	sections      map[vcs.Section]map[string]vcs.FileStatus // files of each section while split
+	section       vcs.Section                               // section of the selected file while split
+
+	conflict *conflictView // conflict view, see openConflict
+
+	commits     []vcs.Commit
+	commitIndex int // commit under review in commit mode, or -1
+
+	viewed     *review.Viewed
+	diffHashes map[string]string // diff hash of each file, see fetchHashesCmd
+	hashesRng  vcs.Range         // range diffHashes were computed for
+
+	comments     *review.Comments
+	fileComments []review.Comment // comments on the selected file
+	composing    bool             // comment composer is open
+	commentBox   textarea.Model
+	draft        review.Comment // comment being composed
+
+	watcher *watch.Watcher
+	anchor  *cursorAnchor // cursor to restore once the reloaded diff arrives
 
 	focus    Focus
 	showHelp bool
@@ -68,14 +164,14 @@ type Model struct {
 	vcs       vcs.VCS
 }
 
-func NewModel(cfg config.Config, targetBranch string, pipedDiff string, vcsClient vcs.VCS) Model {
+func NewModel(cfg config.Config, rng vcs.Range, pipedDiff string, vcsClient vcs.VCS) Model {
 	InitStyles(cfg)
 
 	var files []string
 	if pipedDiff != "" {
-		files = vcsClient.ParseFilesFromDiff(pipedDiff)
+		files = diff.Paths(diff.Parse(pipedDiff))
 	} else {
-		files, _ = vcsClient.ListChangedFiles(targetBranch)
+		files, _ = vcsClient.ListChangedFiles(rng)
 	}
 	t := tree.New(files)
 	items := t.Items()
@@ -100,7 +196,8 @@ func NewModel(cfg config.Config, targetBranch string, pipedDiff string, vcsClien
 		diffViewport:  viewport.New(0, 0),
 		focus:         FocusTree,
 		currentBranch: vcsClient.GetCurrentBranch(),
-		targetBranch:  targetBranch,
+		rng:           rng,
+		reviewRng:     rng,
 		repoName:      vcsClient.GetRepoName(),
 		showHelp:      false,
 		inputBuffer:   "",
@@ -109,6 +206,12 @@ func NewModel(cfg config.Config, targetBranch string, pipedDiff string, vcsClien
 		vcs:           vcsClient,
 		visualMode:    false,
 		visualStart:   0,
+		splitView:     cfg.UI.SideBySide,
+		searchIndex:   -1,
+		commitIndex:   -1,
+		lineNumbers:   normalizeLineNumbers(cfg.UI.LineNumbers),
+		viewed:        review.LoadViewed(vcsClient.GetStateDir()),
+		comments:      review.LoadComments(vcsClient.GetStateDir(), review.Target(rng, pipedDiff)),
 	}
 
 	for idx, item := range items {
@@ -118,6 +221,10 @@ func NewModel(cfg config.Config, targetBranch string, pipedDiff string, vcsClien
 			break
 		}
 	}
+
+	if pipedDiff == "" && rng.WorkingCopy() {
+		m.watcher = newWatcher(vcsClient)
+	}
 	return m
 }
 
@@ -125,66 +232,94 @@ func (m Model) Init() tea.Cmd {
 	var cmds []tea.Cmd
 
 	if m.selectedPath != "" {
-		if m.pipedDiff != "" {
-			cmds = append(cmds, func() tea.Msg {
-				return vcs.DiffMsg{Content: m.vcs.ExtractFileDiff(m.pipedDiff, m.selectedPath)}
-			})
-		} else {
-			cmds = append(cmds, m.vcs.DiffCmd(m.targetBranch, m.selectedPath))
-		}
+		cmds = append(cmds, m.fetchDiffCmd())
 	}
 
 	if m.pipedDiff == "" {
-		cmds = append(cmds, m.fetchStatsCmd(m.targetBranch))
+		cmds = append(cmds, m.fetchStatsCmd(), m.fetchStageStatesCmd())
 	} else {
 		cmds = append(cmds, m.computePipedStatsCmd())
 	}
+	cmds = append(cmds, m.fetchFileStatusesCmd(), m.fetchHashesCmd(), m.fetchRenamesCmd(), m.watchCmd())
 
 	return tea.Batch(cmds...)
 }
 
-func (m Model) fetchStatsCmd(target string) tea.Cmd {
+// fetchDiffCmd loads the diff of the selected file.
+func (m Model) fetchDiffCmd() tea.Cmd {
+	if m.pipedDiff != "" {
+		return func() tea.Msg {
+			return vcs.DiffMsg{Content: diff.Extract(m.pipedDiff, m.selectedPath)}
+		}
+	}
+	return m.fileDiffCmd(m.section, m.selectedPath)
+}
+
+func (m Model) fetchStatsCmd() tea.Cmd {
 	return func() tea.Msg {
-		added, deleted, err := m.vcs.DiffStats(target)
+		added, deleted, err := m.vcs.DiffStats(m.rng)
 		if err != nil {
 			return nil
 		}
-		byFile, _ := m.vcs.DiffStatsByFile(target)
+		byFile, _ := m.vcs.DiffStatsByFile(m.rng)
 		return StatsMsg{Added: added, Deleted: deleted, ByFile: byFile}
 	}
 }
 
+func (m Model) fetchStageStatesCmd() tea.Cmd {
+	if !m.rng.WorkingCopy() {
+		return nil
+	}
+	return func() tea.Msg {
+		states, err := m.vcs.StageStates()
+		if err != nil {
+			return nil
+		}
+		return StageStatesMsg{States: states}
+	}
+}
+
+// stageCmd stages or unstages the current selection of the selected file.
+func (m Model) stageCmd(unstage bool) tea.Cmd {
+	path := m.selectedPath
+	sel := m.selectedChanges()
+	return func() tea.Msg {
+		if len(sel) == 0 {
+			return StageMsg{Unstage: unstage, Err: errors.New("no changes under cursor")}
+		}
+		var err error
+		if unstage {
+			err = m.vcs.Unstage(path, sel)
+		} else {
+			err = m.vcs.Stage(path, sel)
+		}
+		return StageMsg{Unstage: unstage, Err: err}
+	}
+}
+
+// discardCmd reverts patch in the working copy, or reapplies it for undo.
+func (m Model) discardCmd(path, patch string, undo bool) tea.Cmd {
+	return func() tea.Msg {
+		err := m.vcs.ApplyPatch(patch, !undo)
+		return DiscardMsg{Path: path, Patch: patch, Undo: undo, Err: err}
+	}
+}
+
 func (m Model) computePipedStatsCmd() tea.Cmd {
 	return func() tea.Msg {
 		byFile := make(map[string][2]int)
 		var totalAdded, totalDeleted int
-		var currentFile string
-
-		for _, line := range strings.Split(m.pipedDiff, "\n") {
-			clean := stripAnsi(line)
-			if strings.HasPrefix(clean, "diff --git ") {
-				parts := strings.Fields(clean)
-				if len(parts) >= 4 {
-					currentFile = strings.TrimPrefix(parts[3], "b/")
-				}
-			} else if strings.HasPrefix(clean, "diff -r ") {
-				parts := strings.Fields(clean)
-				if len(parts) >= 3 {
-					currentFile = parts[len(parts)-1]
-				}
-			} else if currentFile != "" {
-				if strings.HasPrefix(clean, "+") && !strings.HasPrefix(clean, "+++") {
-					s := byFile[currentFile]
-					s[0]++
-					byFile[currentFile] = s
-					totalAdded++
-				} else if strings.HasPrefix(clean, "-") && !strings.HasPrefix(clean, "---") {
-					s := byFile[currentFile]
-					s[1]++
-					byFile[currentFile] = s
-					totalDeleted++
-				}
+
+		// Only the first diff of a file is shown, so later ones are not
+		// counted either.
+		for _, f := range diff.Parse(m.pipedDiff) {
+			if _, seen := byFile[f.Path()]; seen {
+				continue
 			}
+			added, deleted := f.Stats()
+			byFile[f.Path()] = [2]int{added, deleted}
+			totalAdded += added
+			totalDeleted += deleted
 		}
 		return StatsMsg{Added: totalAdded, Deleted: totalDeleted, ByFile: byFile}
 	}
@@ -202,25 +337,134 @@ func (m *Model) getRepeatCount() int {
 	return count
 }
 
-func stripAnsi(str string) string {
-	return ansiRe.ReplaceAllString(str, "")
+// cursorFileLine maps the diff cursor to the line an editor should open at.
+// old is set when the cursor is on the left column of the split layout, in
+// which case line refers to the old revision.
+func (m *Model) cursorFileLine() (line int, old bool) {
+	if len(m.diffLines) == 0 {
+		return 0, false
+	}
+	if m.focus != FocusDiff {
+		return m.diffLines[m.snapCursor(0, 1)].FileLine(), false
+	}
+
+	l := m.diffLines[m.diffCursor]
+	if m.isSplit() && m.splitSide == sideLeft && l.Kind != diff.Added {
+		return l.OldLine, true
+	}
+	return l.FileLine(), false
+}
+
+// selectedChanges returns the changed rows under the visual selection, or
+// those of the hunk under the cursor when not in visual mode.
+func (m *Model) selectedChanges() []diff.Line {
+	if len(m.diffLines) == 0 {
+		return nil
+	}
+
+	var lines []int
+	if m.visualMode {
+		start, end := m.posOf(m.visualStart), m.cursorPos()
+		if start > end {
+			start, end = end, start
+		}
+		for p := start; p <= end && p < m.rowCount(); p++ {
+			lines = append(lines, m.linesAt(p)...)
+		}
+	} else {
+		start, end := m.hunkBounds(m.diffCursor)
+		for i := start; i <= end; i++ {
+			lines = append(lines, i)
+		}
+	}
+
+	var sel []diff.Line
+	for _, i := range lines {
+		if k := m.diffLines[i].Kind; k == diff.Added || k == diff.Deleted {
+			sel = append(sel, m.diffLines[i])
+		}
+	}
+	return sel
+}
+
+// hunkBounds returns the first and last row of the hunk containing idx.
+func (m *Model) hunkBounds(idx int) (int, int) {
+	start := idx
+	for start > 0 && m.diffLines[start].Kind != diff.HunkHeader {
+		start--
+	}
+	end := idx + 1
+	for end < len(m.diffLines) && m.diffLines[end].Kind != diff.HunkHeader {
+		end++
+	}
+	return start, end - 1
+}
+
+// The diff pane is navigated in layout positions. In the unified layout a
+// position is an index into m.diffLines; in the split layout it is an index
+// into m.splitRows. m.diffCursor always holds a diffLines index.
+
+func (m *Model) isSplit() bool {
+	return m.splitView && m.diffViewport.Width >= splitMinWidth
 }
 
-func isDiffMetadata(cleanLine string) bool {
-	return strings.HasPrefix(cleanLine, "diff --git") ||
-		strings.HasPrefix(cleanLine, "diff -r ") ||
-		strings.HasPrefix(cleanLine, "index ") ||
-		strings.HasPrefix(cleanLine, "new file mode") ||
-		strings.HasPrefix(cleanLine, "old mode") ||
-		strings.HasPrefix(cleanLine, "--- a/") ||
-		strings.HasPrefix(cleanLine, "--- /dev/") ||
-		strings.HasPrefix(cleanLine, "+++ b/") ||
-		strings.HasPrefix(cleanLine, "+++ /dev/") ||
-		strings.HasPrefix(cleanLine, "@@")
+// rowCount returns the number of positions in the current layout.
+func (m *Model) rowCount() int {
+	if m.isSplit() {
+		return len(m.splitRows)
+	}
+	return len(m.diffLines)
+}
+
+// lineAt returns the diffLines index the cursor lands on at position pos,
+// preferring the active column of the split layout.
+func (m *Model) lineAt(pos int) int {
+	if !m.isSplit() {
+		return pos
+	}
+	r := m.splitRows[pos]
+	if (m.splitSide == sideLeft && r.left >= 0) || r.right < 0 {
+		return r.left
+	}
+	return r.right
+}
+
+// linesAt returns every diffLines index shown at position pos.
+func (m *Model) linesAt(pos int) []int {
+	if !m.isSplit() {
+		return []int{pos}
+	}
+	r := m.splitRows[pos]
+	switch {
+	case r.left == r.right:
+		return []int{r.left}
+	case r.left < 0:
+		return []int{r.right}
+	case r.right < 0:
+		return []int{r.left}
+	}
+	return []int{r.left, r.right}
+}
+
+// posOf returns the position at which diffLines index idx is shown.
+func (m *Model) posOf(idx int) int {
+	if !m.isSplit() {
+		return idx
+	}
+	for p, r := range m.splitRows {
+		if r.left == idx || r.right == idx {
+			return p
+		}
+	}
+	return 0
+}
+
+func (m *Model) cursorPos() int {
+	return m.posOf(m.diffCursor)
 }
 
 func (m *Model) setYOffset(offset int) {
-	maxOffset := len(m.diffLines) - m.diffViewport.Height
+	maxOffset := m.rowCount() - m.diffViewport.Height
 	if maxOffset < 0 {
 		maxOffset = 0
 	}
@@ -235,32 +479,33 @@ func (m *Model) setYOffset(offset int) {
 	m.diffViewport.YOffset = offset
 }
 
-func (m *Model) snapCursor(idx int, dir int) int {
-	if len(m.diffLines) == 0 {
+// snapCursor returns the diffLines index for position pos, moving in
+// direction dir past hunk headers.
+func (m *Model) snapCursor(pos int, dir int) int {
+	rows := m.rowCount()
+	if rows == 0 {
 		return 0
 	}
 
-	if idx < 0 {
-		idx = 0
+	if pos < 0 {
+		pos = 0
 	}
-	if idx >= len(m.diffLines) {
-		idx = len(m.diffLines) - 1
+	if pos >= rows {
+		pos = rows - 1
 	}
 
-	curr := idx
-	for curr >= 0 && curr < len(m.diffLines) {
-		cleanLine := stripAnsi(m.diffLines[curr])
-		if !isDiffMetadata(cleanLine) {
-			return curr
+	curr := pos
+	for curr >= 0 && curr < rows {
+		if idx := m.lineAt(curr); m.diffLines[idx].Kind != diff.HunkHeader {
+			return idx
 		}
 		curr += dir
 	}
 
-	curr = idx
-	for curr >= 0 && curr < len(m.diffLines) {
-		cleanLine := stripAnsi(m.diffLines[curr])
-		if !isDiffMetadata(cleanLine) {
-			return curr
+	curr = pos
+	for curr >= 0 && curr < rows {
+		if idx := m.lineAt(curr); m.diffLines[idx].Kind != diff.HunkHeader {
+			return idx
 		}
 		curr -= dir
 	}
@@ -269,22 +514,138 @@ func (m *Model) snapCursor(idx int, dir int) int {
 }
 
 func (m *Model) handleScrolling() {
-	if m.diffCursor < m.diffViewport.YOffset {
-		m.setYOffset(m.diffCursor)
-	} else if m.diffCursor >= m.diffViewport.YOffset+m.diffViewport.Height {
-		m.setYOffset(m.diffCursor - m.diffViewport.Height + 1)
+	pos := m.cursorPos()
+	if pos < m.diffViewport.YOffset {
+		m.setYOffset(pos)
+	} else if pos >= m.diffViewport.YOffset+m.diffViewport.Height {
+		m.setYOffset(pos - m.diffViewport.Height + 1)
 	}
 }
 
 func (m *Model) centerDiffCursor() {
-	targetOffset := m.diffCursor - (m.diffViewport.Height / 2)
+	targetOffset := m.cursorPos() - (m.diffViewport.Height / 2)
 	m.setYOffset(targetOffset)
 }
 
+// toggleSplit switches between the unified and side-by-side layouts,
+// keeping the cursor on the same line.
+func (m *Model) toggleSplit() {
+	m.splitView = !m.splitView
+	m.splitSide = sideRight
+	if len(m.diffLines) > 0 && m.diffLines[m.diffCursor].Kind == diff.Deleted {
+		m.splitSide = sideLeft
+	}
+	m.centerDiffCursor()
+}
+
+// selectFile reveals the file with the given tree key, selects it and
+// loads its diff.
+func (m *Model) selectFile(key string) tea.Cmd {
+	m.treeState.Reveal(key)
+	items := m.treeState.Items()
+	m.fileList.SetItems(items)
+	for idx, item := range items {
+		if ti, ok := item.(tree.TreeItem); ok && !ti.IsDir && ti.FullPath == key {
+			m.fileList.Select(idx)
+			break
+		}
+	}
+
+	m.section, m.selectedPath = m.splitKey(key)
+	m.diffCursor = 0
+	m.visualMode = false
+	m.diffViewport.GotoTop()
+	return m.fetchDiffCmd()
+}
+
+// reloadFiles lists the changed files of m.rng again and rebuilds the tree,
+// keeping directory expansion and the selection when the selected file is
+// still changed.
+func (m *Model) reloadFiles() tea.Cmd {
+	files, err := m.listFiles()
+	if err != nil {
+		m.statusMsg = err.Error()
+	}
+	if m.sections != nil {
+		// Follow the selected file into another section, such as from
+		// Unstaged to Staged once it is staged.
+		if _, ok := m.sections[m.section][m.selectedPath]; !ok {
+			m.section = m.sectionOf(m.selectedPath)
+		}
+	}
+	prevItem, _ := m.fileList.SelectedItem().(tree.TreeItem)
+	prevTree := m.treeState
+	m.treeState = tree.New(files)
+	m.treeState.KeepExpansion(prevTree)
+	if m.originsRng == m.rng && m.sections == nil {
+		m.treeState.SetOrigins(m.origins)
+	}
+	m.treeState.SetStatuses(statusLetters(m.treeStatuses()))
+	m.treeState.SetSortByStatus(m.sortByStatus)
+	if strings.TrimSpace(m.filterQuery) != "" {
+		m.treeState.SetFilter(parseFilter(m.filterQuery).match(files, m.treeStatuses()))
+	}
+	m.fileStats = nil
+	m.statsAdded, m.statsDeleted = 0, 0
+	if !m.rng.WorkingCopy() {
+		m.treeDelegate.Stage = nil
+	}
+	m.treeDelegate.Sections = m.sections != nil
+	m.fileList.SetDelegate(m.treeDelegate)
+	cmds := []tea.Cmd{m.fetchStatsCmd(), m.fetchStageStatesCmd(), m.fetchFileStatusesCmd(), m.fetchHashesCmd(), m.fetchRenamesCmd()}
+
+	path, selected := "", m.treeKey(m.selectedPath)
+	for _, f := range m.treeState.MatchingFiles() {
+		if path == "" || f == selected {
+			path = f
+		}
+	}
+	if path == "" {
+		m.fileList.SetItems(m.treeState.Items())
+		m.selectedPath = ""
+		m.section = ""
+		m.diffFile = nil
+		m.diffLines = nil
+		m.splitRows = nil
+		m.diffHighlighted = nil
+		m.diffEmphasis = nil
+		m.diffCursor = 0
+		return tea.Batch(cmds...)
+	}
+	if path != selected {
+		return tea.Batch(append(cmds, m.selectFile(path))...)
+	}
+
+	// Same file: leave the tree cursor where it was, on a directory if
+	// need be, and reload the diff.
+	items := m.treeState.Items()
+	m.fileList.SetItems(items)
+	sel := -1
+	for idx, item := range items {
+		if ti, ok := item.(tree.TreeItem); ok && ti.FullPath == prevItem.FullPath {
+			sel = idx
+		}
+	}
+	if sel >= 0 {
+		m.fileList.Select(sel)
+	} else {
+		return tea.Batch(append(cmds, m.selectFile(path))...)
+	}
+	m.diffCursor = 0
+	m.visualMode = false
+	m.diffViewport.GotoTop()
+	return tea.Batch(append(cmds, m.fetchDiffCmd())...)
+}
+
 func (m *Model) updateSizes() {
 	reservedHeight := 2
 	if m.showHelp {
-		reservedHeight += 6
+		// The drawer takes the place of the status bar.
+		reservedHeight += lipgloss.Height(m.renderHelpDrawer()) - 1
+	}
+	if m.composing {
+		reservedHeight += m.commentBoxHeight() - 1
+		m.commentBox.SetWidth(m.width - 2)
 	}
 
 	contentHeight := m.height - reservedHeight
@@ -307,10 +668,14 @@ func (m *Model) updateSizes() {
 	if listHeight < 1 {
 		listHeight = 1
 	}
+	diffHeight := max(listHeight-len(m.diffHeader(m.width-treeWidth)), 1)
+	if m.inCommit() {
+		listHeight = max(listHeight-m.commitPaneHeight(), 1)
+	}
 	m.fileList.SetSize(treeInnerWidth, listHeight)
 
 	m.diffViewport.Width = m.width - treeWidth
-	m.diffViewport.Height = listHeight
+	m.diffViewport.Height = diffHeight
 }
 
 func (m *Model) updateTreeFocus() {
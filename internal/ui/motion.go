@@ -0,0 +1,120 @@
+package ui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// jumpTo moves the cursor to diff line idx, switching the split column to
+// the side the line is on and centering it if it was off screen.
+func (m *Model) jumpTo(idx int) {
+	m.diffCursor = idx
+	switch m.diffLines[idx].Kind {
+	case diff.Deleted:
+		m.splitSide = sideLeft
+	case diff.Added:
+		m.splitSide = sideRight
+	}
+
+	pos := m.cursorPos()
+	if pos < m.diffViewport.YOffset || pos >= m.diffViewport.YOffset+m.diffViewport.Height {
+		m.centerDiffCursor()
+	}
+}
+
+// firstChange returns the first added or deleted line of the hunk whose
+// header is at idx, or the first line after the header if it has none.
+func (m *Model) firstChange(header int) int {
+	_, end := m.hunkBounds(header)
+	for i := header + 1; i <= end; i++ {
+		if k := m.diffLines[i].Kind; k == diff.Added || k == diff.Deleted {
+			return i
+		}
+	}
+	if header+1 < len(m.diffLines) {
+		return header + 1
+	}
+	return header
+}
+
+// hunkHeaders returns the index of every hunk header in m.diffLines.
+func (m *Model) hunkHeaders() []int {
+	var headers []int
+	for i, l := range m.diffLines {
+		if l.Kind == diff.HunkHeader {
+			headers = append(headers, i)
+		}
+	}
+	return headers
+}
+
+// moveHunk moves the cursor to the first change of the count-th next hunk,
+// or of the previous one when dir is negative.
+func (m *Model) moveHunk(dir, count int) {
+	headers := m.hunkHeaders()
+	if len(headers) == 0 {
+		return
+	}
+
+	cur := -1
+	for k, h := range headers {
+		if h <= m.diffCursor {
+			cur = k
+		}
+	}
+
+	// The first step lands on the current hunk's changes when the cursor
+	// sits before them (moving down) or past their start (moving up).
+	target := cur + dir*count
+	if cur >= 0 {
+		first := m.firstChange(headers[cur])
+		if dir > 0 && m.diffCursor < first {
+			target--
+		}
+		if dir < 0 && m.diffCursor > first {
+			target++
+		}
+	}
+
+	if target < 0 || target >= len(headers) {
+		if dir > 0 {
+			m.statusMsg = "No next hunk"
+		} else {
+			m.statusMsg = "No previous hunk"
+		}
+		return
+	}
+	m.jumpTo(m.firstChange(headers[target]))
+}
+
+// moveFile selects the count-th next file in tree order, or the previous one
+// when dir is negative, wrapping around the ends of the tree.
+func (m *Model) moveFile(dir, count int) tea.Cmd {
+	files := m.treeState.MatchingFiles()
+	if len(files) == 0 {
+		return nil
+	}
+
+	cur, selected := -1, m.treeKey(m.selectedPath)
+	for i, f := range files {
+		if f == selected {
+			cur = i
+			break
+		}
+	}
+
+	n := len(files)
+	next := cur + dir*count
+	if cur < 0 && dir < 0 {
+		next = n - count
+	}
+	if next >= n || next < 0 {
+		m.statusMsg = "Wrapped around the file list"
+	}
+	next = (next%n + n) % n
+	if files[next] == selected {
+		return nil
+	}
+	return m.selectFile(files[next])
+}
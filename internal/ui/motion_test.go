@@ -0,0 +1,128 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/bubbles/list"
+
+	"github.com/oug-t/difi/internal/review"
+	"github.com/oug-t/difi/internal/tree"
+)
+
+// treeModel returns a model of a piped diff of files with the first file
+// in tree order selected.
+func treeModel(files ...string) Model {
+	t := tree.New(files)
+	m := Model{
+		fileList:  list.New(t.Items(), TreeDelegate{}, 0, 0),
+		treeState: t,
+		pipedDiff: "piped",
+		viewed:    review.LoadViewed(""),
+	}
+	if files := t.Files(); len(files) > 0 {
+		m.selectedPath = files[0]
+	}
+	return m
+}
+
+func TestMoveHunk(t *testing.T) {
+	// ]c, [c, } and { all move by hunk. Hunks start at 0, 4 and 7; the one
+	// at 7 has no changes.
+	const kinds = "@ -+@ +@  "
+	tests := []struct {
+		name   string
+		kinds  string
+		cursor int
+		dir    int
+		count  int
+		want   int
+		status string
+	}{
+		{"first hunk from its header", kinds, 0, 1, 1, 2, ""},
+		{"next hunk", kinds, 2, 1, 1, 6, ""},
+		{"next hunk from context", kinds, 1, 1, 1, 2, ""},
+		{"two hunks down", kinds, 2, 1, 2, 8, ""},
+		{"hunk without changes", kinds, 6, 1, 1, 8, ""},
+		{"past the last hunk", kinds, 8, 1, 1, 8, "No next hunk"},
+		{"previous hunk", kinds, 6, -1, 1, 2, ""},
+		{"back to the current hunk", kinds, 3, -1, 1, 2, ""},
+		{"before the first hunk", kinds, 2, -1, 1, 2, "No previous hunk"},
+		{"too many hunks up", kinds, 8, -1, 5, 8, "No previous hunk"},
+		{"empty diff", "", 0, 1, 1, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Model{diffLines: linesOf(tt.kinds), diffCursor: tt.cursor}
+			m.moveHunk(tt.dir, tt.count)
+			if m.diffCursor != tt.want || m.statusMsg != tt.status {
+				t.Errorf("moveHunk(%d, %d) from %d: cursor %d, status %q, want %d, %q",
+					tt.dir, tt.count, tt.cursor, m.diffCursor, m.statusMsg, tt.want, tt.status)
+			}
+		})
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  []string
+		from   string
+		dir    int
+		count  int
+		want   string
+		status string
+	}{
+		{"next", []string{"a", "b", "c"}, "a", 1, 1, "b", ""},
+		{"two down", []string{"a", "b", "c"}, "a", 1, 2, "c", ""},
+		{"previous", []string{"a", "b", "c"}, "c", -1, 1, "b", ""},
+		{"wraps at the end", []string{"a", "b", "c"}, "c", 1, 1, "a", "Wrapped around the file list"},
+		{"wraps at the start", []string{"a", "b", "c"}, "a", -1, 1, "c", "Wrapped around the file list"},
+		{"single file", []string{"a"}, "a", 1, 1, "a", "Wrapped around the file list"},
+		{"no files", nil, "", 1, 1, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := treeModel(tt.files...)
+			m.selectedPath = tt.from
+			m.moveFile(tt.dir, tt.count)
+			if m.selectedPath != tt.want || m.statusMsg != tt.status {
+				t.Errorf("moveFile(%d, %d) from %q: selected %q, status %q, want %q, %q",
+					tt.dir, tt.count, tt.from, m.selectedPath, m.statusMsg, tt.want, tt.status)
+			}
+		})
+	}
+}
+
+func TestMoveUnviewed(t *testing.T) {
+	tests := []struct {
+		name   string
+		viewed []string
+		from   string
+		dir    int
+		want   string
+		status string
+	}{
+		{"skips viewed files", []string{"b"}, "a", 1, "c", ""},
+		{"backwards", []string{"b"}, "c", -1, "a", ""},
+		{"wraps", []string{"a"}, "c", 1, "b", "Wrapped around the file list"},
+		{"only the selected file", []string{"b", "c"}, "a", 1, "a", "No other unviewed file"},
+		{"all viewed", []string{"a", "b", "c"}, "a", 1, "a", "All files viewed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := treeModel("a", "b", "c")
+			m.diffHashes = map[string]string{"a": "1", "b": "2", "c": "3"}
+			for _, f := range tt.viewed {
+				if err := m.viewed.Set(f, m.diffHashes[f], true); err != nil {
+					t.Fatal(err)
+				}
+			}
+			m.selectedPath = tt.from
+			m.moveUnviewed(tt.dir, 1)
+			if m.selectedPath != tt.want || m.statusMsg != tt.status {
+				t.Errorf("moveUnviewed(%d) from %q: selected %q, status %q, want %q, %q",
+					tt.dir, tt.from, m.selectedPath, m.statusMsg, tt.want, tt.status)
+			}
+		})
+	}
+}
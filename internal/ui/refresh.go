@@ -0,0 +1,131 @@
+package ui
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/vcs"
+	"github.com/oug-t/difi/internal/watch"
+)
+
+// RefreshMsg reports that the working copy changed on disk.
+type RefreshMsg struct{}
+
+// refreshDebounce is how long the working copy must stay quiet before a
+// change triggers a refresh, so a save or checkout refreshes only once.
+const refreshDebounce = 250 * time.Millisecond
+
+// cursorAnchor remembers the line under the diff cursor across a reload.
+type cursorAnchor struct {
+	path   string
+	line   diff.Line
+	offset int // cursor position minus the viewport offset
+}
+
+// newWatcher watches the repository for changes to the working copy,
+// leaving out the directories the VCS ignores.
+func newWatcher(client vcs.VCS) *watch.Watcher {
+	root := client.GetRepoRoot()
+	if root == "" {
+		return nil
+	}
+	ignored := func(dirs []string) map[string]bool {
+		ignored, err := client.IgnoredDirs(dirs)
+		if err != nil {
+			return nil
+		}
+		return ignored
+	}
+	w, err := watch.New(root, refreshDebounce, ignored)
+	if err != nil {
+		return nil
+	}
+	return w
+}
+
+// Close stops watching the working copy.
+func (m Model) Close() {
+	if m.watcher != nil {
+		m.watcher.Close()
+	}
+}
+
+// watchCmd waits for the next change to the working copy.
+func (m Model) watchCmd() tea.Cmd {
+	w := m.watcher
+	if w == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		if err := w.Wait(); err != nil {
+			return nil
+		}
+		return RefreshMsg{}
+	}
+}
+
+// refresh reloads the changed files and the selected diff, keeping the tree
+// expansion, the selection and the line under the cursor.
+func (m *Model) refresh() tea.Cmd {
+	if m.pipedDiff != "" {
+		return nil
+	}
+	var anchor *cursorAnchor
+	if m.cursorValid() {
+		anchor = &cursorAnchor{
+			path:   m.selectedPath,
+			line:   m.diffLines[m.diffCursor],
+			offset: m.cursorPos() - m.diffViewport.YOffset,
+		}
+	}
+
+	cmd := m.reloadFiles()
+	if anchor != nil && anchor.path == m.selectedPath {
+		m.anchor = anchor
+	}
+	return cmd
+}
+
+func (m *Model) cursorValid() bool {
+	return m.diffCursor >= 0 && m.diffCursor < len(m.diffLines)
+}
+
+// restoreCursor puts the cursor back on the anchored line of a reloaded
+// diff: the nearest line with the same text, or failing that the line
+// closest to the same place in the file.
+func (m *Model) restoreCursor(a cursorAnchor) {
+	best, bestDist, bestSame := -1, 0, false
+	for i, l := range m.diffLines {
+		if l.Kind == diff.HunkHeader {
+			continue
+		}
+		same := l.Kind == a.line.Kind && l.Content == a.line.Content
+		dist := abs(anchorLine(l) - anchorLine(a.line))
+		if best < 0 || (same && !bestSame) || (same == bestSame && dist < bestDist) {
+			best, bestDist, bestSame = i, dist, same
+		}
+	}
+	if best < 0 {
+		return
+	}
+	m.diffCursor = best
+	m.setYOffset(m.cursorPos() - a.offset)
+}
+
+// anchorLine places l in the file: deleted lines by their old line number,
+// everything else by the new one.
+func anchorLine(l diff.Line) int {
+	if l.Kind == diff.Deleted {
+		return l.OldLine
+	}
+	return l.NewLine
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
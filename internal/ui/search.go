@@ -0,0 +1,302 @@
+package ui
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// searchMatch is one occurrence of the search pattern in m.diffLines.
+type searchMatch struct {
+	line int
+	span diff.Span
+}
+
+// SearchHitMsg names the next file, in direction Dir, whose diff matches the
+// search pattern. Path is empty when no file matches.
+type SearchHitMsg struct {
+	Path string
+	Dir  int
+}
+
+// compileSearch builds the search regexp. Patterns without upper-case
+// letters match case-insensitively. Invalid regexps are matched literally so
+// incremental search keeps working while a pattern is being typed.
+func compileSearch(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	flags := "(?i)"
+	for _, r := range pattern {
+		if unicode.IsUpper(r) {
+			flags = ""
+			break
+		}
+	}
+	re, err := regexp.Compile(flags + pattern)
+	if err != nil {
+		re = regexp.MustCompile(flags + regexp.QuoteMeta(pattern))
+	}
+	return re
+}
+
+// findMatches returns every match of re in the content of lines, in order.
+func findMatches(lines []diff.Line, re *regexp.Regexp) []searchMatch {
+	if re == nil {
+		return nil
+	}
+	var matches []searchMatch
+	for i, l := range lines {
+		if l.Kind == diff.HunkHeader {
+			continue
+		}
+		for _, loc := range re.FindAllStringIndex(l.Content, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			matches = append(matches, searchMatch{line: i, span: diff.Span{Start: loc[0], End: loc[1]}})
+		}
+	}
+	return matches
+}
+
+// matchSpans returns the search matches on diff line idx.
+func (m Model) matchSpans(idx int) []diff.Span {
+	k := sort.Search(len(m.searchMatches), func(k int) bool {
+		return m.searchMatches[k].line >= idx
+	})
+	var spans []diff.Span
+	for ; k < len(m.searchMatches) && m.searchMatches[k].line == idx; k++ {
+		spans = append(spans, m.searchMatches[k].span)
+	}
+	return spans
+}
+
+// startSearch opens the search prompt.
+func (m *Model) startSearch(backward bool) {
+	m.searching = true
+	m.searchBackward = backward
+	m.searchInput = ""
+	m.searchOrigin = m.diffCursor
+	m.visualMode = false
+	m.inputBuffer = ""
+}
+
+// handleSearchKey edits the search prompt. Matches are updated and the
+// cursor jumps to the nearest one as the pattern is typed.
+func (m Model) handleSearchKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.searching = false
+		if m.searchInput != "" {
+			m.searchPattern = m.searchInput
+		}
+		m.setSearch(m.searchPattern)
+		m.diffCursor = m.searchOrigin
+		m.searchIndex = -1
+		return m, m.nextMatch(1)
+
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.searching = false
+		m.diffCursor = m.searchOrigin
+		m.setSearch(m.searchPattern)
+		m.handleScrolling()
+		return m, nil
+
+	case tea.KeyTab:
+		m.searchAll = !m.searchAll
+		return m, nil
+
+	case tea.KeyBackspace:
+		r := []rune(m.searchInput)
+		if len(r) == 0 {
+			m.searching = false
+			m.diffCursor = m.searchOrigin
+			m.setSearch(m.searchPattern)
+			m.handleScrolling()
+			return m, nil
+		}
+		m.searchInput = string(r[:len(r)-1])
+
+	case tea.KeySpace:
+		m.searchInput += " "
+
+	case tea.KeyRunes:
+		m.searchInput += string(msg.Runes)
+
+	default:
+		return m, nil
+	}
+
+	m.setSearch(m.searchInput)
+	m.diffCursor = m.searchOrigin
+	m.searchIndex = -1
+	if idx := m.matchFrom(m.searchDir(1), true); idx >= 0 {
+		m.gotoMatch(idx)
+	} else {
+		m.handleScrolling()
+	}
+	return m, nil
+}
+
+// setSearch replaces the active pattern and recomputes the matches.
+func (m *Model) setSearch(pattern string) {
+	m.searchRe = compileSearch(pattern)
+	m.searchMatches = findMatches(m.diffLines, m.searchRe)
+	m.searchIndex = -1
+}
+
+// clearSearch removes the match highlighting; n and N still reuse the
+// last pattern.
+func (m *Model) clearSearch() {
+	m.searchRe = nil
+	m.searchMatches = nil
+	m.searchIndex = -1
+}
+
+// searchDir turns the direction of n (1) or N (-1) into a direction in the
+// diff, honouring a search started with ?.
+func (m *Model) searchDir(dir int) int {
+	if m.searchBackward {
+		return -dir
+	}
+	return dir
+}
+
+// matchFrom returns the index of the next match past the cursor in
+// direction dir, or -1. With wrap set the search continues from the other
+// end of the file.
+func (m *Model) matchFrom(dir int, wrap bool) int {
+	n := len(m.searchMatches)
+	if n == 0 {
+		return -1
+	}
+
+	idx := -1
+	if m.searchIndex >= 0 && m.searchIndex < n && m.searchMatches[m.searchIndex].line == m.diffCursor {
+		if next := m.searchIndex + dir; next >= 0 && next < n {
+			idx = next
+		}
+	} else if dir > 0 {
+		idx = sort.Search(n, func(k int) bool { return m.searchMatches[k].line > m.diffCursor })
+		if idx == n {
+			idx = -1
+		}
+	} else {
+		idx = sort.Search(n, func(k int) bool { return m.searchMatches[k].line >= m.diffCursor }) - 1
+	}
+
+	if idx < 0 && wrap {
+		if dir > 0 {
+			idx = 0
+		} else {
+			idx = n - 1
+		}
+	}
+	return idx
+}
+
+// gotoMatch moves the cursor to match idx.
+func (m *Model) gotoMatch(idx int) {
+	m.searchIndex = idx
+	m.jumpTo(m.searchMatches[idx].line)
+}
+
+// nextMatch implements n (dir 1) and N (dir -1). Past the last match it
+// either wraps around the file or, when searching all files, continues in
+// the next file with a hit.
+func (m *Model) nextMatch(dir int) tea.Cmd {
+	if m.searchPattern == "" {
+		m.statusMsg = "No previous search"
+		return nil
+	}
+	if m.searchRe == nil {
+		m.setSearch(m.searchPattern)
+	}
+
+	dir = m.searchDir(dir)
+	idx := m.matchFrom(dir, false)
+	if idx < 0 {
+		if m.searchAll && len(m.treeState.Files()) > 1 {
+			m.statusMsg = "Searching…"
+			return m.searchFilesCmd(dir)
+		}
+		if len(m.searchMatches) == 0 {
+			m.statusMsg = "Pattern not found: " + m.searchPattern
+			return nil
+		}
+		idx = m.matchFrom(dir, true)
+		if dir > 0 {
+			m.statusMsg = "Search hit BOTTOM, continuing at TOP"
+		} else {
+			m.statusMsg = "Search hit TOP, continuing at BOTTOM"
+		}
+	}
+	m.gotoMatch(idx)
+	return nil
+}
+
+// searchStatus returns the "match i/N" indicator for the status bar.
+func (m Model) searchStatus() string {
+	n := len(m.searchMatches)
+	if m.searchRe == nil || n == 0 {
+		return ""
+	}
+	if m.searchIndex >= 0 && m.searchIndex < n && m.searchMatches[m.searchIndex].line == m.diffCursor {
+		return fmt.Sprintf("match %d/%d", m.searchIndex+1, n)
+	}
+	return fmt.Sprintf("%d matches", n)
+}
+
+// searchFilesCmd looks for the next file after the selected one, in
+// direction dir and wrapping around, whose diff matches the pattern.
+func (m Model) searchFilesCmd(dir int) tea.Cmd {
+	files := m.treeState.Files()
+	start, selected := 0, m.treeKey(m.selectedPath)
+	for i, f := range files {
+		if f == selected {
+			start = i
+			break
+		}
+	}
+	re := m.searchRe
+
+	return func() tea.Msg {
+		n := len(files)
+		for k := 1; k <= n; k++ {
+			key := files[((start+dir*k)%n+n)%n]
+			if len(findMatches(m.loadRows(key), re)) > 0 {
+				return SearchHitMsg{Path: key, Dir: dir}
+			}
+		}
+		return SearchHitMsg{Dir: dir}
+	}
+}
+
+// loadRows fetches and parses the diff of the file with the given tree key
+// synchronously.
+func (m Model) loadRows(key string) []diff.Line {
+	section, path := m.splitKey(key)
+	var content string
+	if m.pipedDiff != "" {
+		content = diff.Extract(m.pipedDiff, path)
+	} else if msg, ok := m.fileDiffCmd(section, path)().(vcs.DiffMsg); ok {
+		content = msg.Content
+	}
+
+	files := diff.Parse(content)
+	f := diff.Find(files, path)
+	if f == nil && len(files) > 0 {
+		f = files[0]
+	}
+	if f == nil {
+		return nil
+	}
+	return f.Rows()
+}
@@ -0,0 +1,180 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// rowsOf builds diff lines from their unified form: "@@" starts a hunk
+// header and '-', '+' or ' ' mark the other lines.
+func rowsOf(lines ...string) []diff.Line {
+	var rows []diff.Line
+	for _, l := range lines {
+		if len(l) >= 2 && l[:2] == "@@" {
+			rows = append(rows, diff.Line{Kind: diff.HunkHeader, Content: l})
+			continue
+		}
+		row := linesOf(l[:1])[0]
+		row.Content = l[1:]
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestCompileSearch(t *testing.T) {
+	tests := []struct {
+		pattern, text string
+		want          bool
+	}{
+		{"foo", "FOO bar", true},  // lower case ignores case
+		{"Foo", "foo bar", false}, // an upper-case letter makes it exact
+		{"Foo", "a Foo", true},
+		{"f.o", "fxo", true}, // a regexp
+		{`\bbar\b`, "foo bar", true},
+		{"a(", "a(b", true}, // invalid, matched literally
+		{"a(", "ab", false},
+		{"[", "x[y", true},
+	}
+	for _, tt := range tests {
+		re := compileSearch(tt.pattern)
+		if re == nil {
+			t.Fatalf("compileSearch(%q) = nil", tt.pattern)
+		}
+		if got := re.MatchString(tt.text); got != tt.want {
+			t.Errorf("compileSearch(%q).MatchString(%q) = %v, want %v", tt.pattern, tt.text, got, tt.want)
+		}
+	}
+	if re := compileSearch(""); re != nil {
+		t.Errorf("compileSearch(\"\") = %v, want nil", re)
+	}
+}
+
+func TestFindMatches(t *testing.T) {
+	lines := rowsOf(
+		"@@ -1,3 +1,3 @@ func foo()",
+		" foo := foo()",
+		"-bar",
+		"+Foo",
+	)
+	tests := []struct {
+		pattern string
+		want    []searchMatch
+	}{
+		{"foo", []searchMatch{ // the hunk header is skipped
+			{line: 1, span: diff.Span{Start: 0, End: 3}},
+			{line: 1, span: diff.Span{Start: 7, End: 10}},
+			{line: 3, span: diff.Span{Start: 0, End: 3}},
+		}},
+		{"Foo", []searchMatch{{line: 3, span: diff.Span{Start: 0, End: 3}}}},
+		{"x*", nil}, // empty matches are dropped
+		{"baz", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := findMatches(lines, compileSearch(tt.pattern)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("findMatches(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestSetSearchCaseSwitch(t *testing.T) {
+	m := Model{diffLines: rowsOf(" foo", " Foo", " FOO")}
+	m.setSearch("foo")
+	if n := len(m.searchMatches); n != 3 {
+		t.Errorf("foo: %d matches, want 3", n)
+	}
+	m.setSearch("Foo")
+	if n := len(m.searchMatches); n != 1 {
+		t.Errorf("Foo: %d matches, want 1", n)
+	}
+	m.setSearch("fo")
+	if n := len(m.searchMatches); n != 3 {
+		t.Errorf("fo: %d matches, want 3", n)
+	}
+}
+
+func TestMatchFrom(t *testing.T) {
+	// Matches on lines 1, 3 and 5 of seven.
+	lines := rowsOf(" a", " x", " a", " x", " a", " x", " a")
+	tests := []struct {
+		name   string
+		cursor int
+		index  int // searchIndex
+		dir    int
+		wrap   bool
+		want   int
+	}{
+		{"forward", 0, -1, 1, false, 0},
+		{"forward past the cursor", 1, -1, 1, false, 1},
+		{"forward from a match", 3, 1, 1, false, 2},
+		{"backward", 4, -1, -1, false, 1},
+		{"backward from a match", 3, 1, -1, false, 0},
+		{"past the last match", 5, 2, 1, false, -1},
+		{"past the last match wraps", 5, 2, 1, true, 0},
+		{"after the last match wraps", 6, -1, 1, true, 0},
+		{"before the first match", 0, -1, -1, false, -1},
+		{"before the first match wraps", 0, -1, -1, true, 2},
+		{"stale index", 4, 0, 1, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Model{diffLines: lines}
+			m.setSearch("x")
+			m.diffCursor, m.searchIndex = tt.cursor, tt.index
+			if got := m.matchFrom(tt.dir, tt.wrap); got != tt.want {
+				t.Errorf("matchFrom(%d, %v) = %d, want %d", tt.dir, tt.wrap, got, tt.want)
+			}
+		})
+	}
+
+	var m Model
+	if got := m.matchFrom(1, true); got != -1 {
+		t.Errorf("matchFrom() without matches = %d, want -1", got)
+	}
+}
+
+func TestNextMatch(t *testing.T) {
+	m := Model{diffLines: rowsOf(" x", " a", " x", " a")}
+	m.searchPattern = "x"
+	m.diffCursor = 1
+
+	steps := []struct {
+		dir    int
+		cursor int
+		status string
+	}{
+		{1, 2, ""},
+		{1, 0, "Search hit BOTTOM, continuing at TOP"},
+		{-1, 2, "Search hit TOP, continuing at BOTTOM"},
+		{-1, 0, ""},
+	}
+	for i, s := range steps {
+		m.statusMsg = ""
+		m.nextMatch(s.dir)
+		if m.diffCursor != s.cursor || m.statusMsg != s.status {
+			t.Errorf("step %d: cursor %d, status %q, want %d, %q", i, m.diffCursor, m.statusMsg, s.cursor, s.status)
+		}
+	}
+
+	// A search started with ? runs n backwards.
+	m.searchBackward = true
+	m.nextMatch(1)
+	if m.diffCursor != 2 {
+		t.Errorf("n after ?: cursor %d, want 2", m.diffCursor)
+	}
+
+	m.searchPattern = "missing"
+	m.clearSearch()
+	m.nextMatch(1)
+	if m.statusMsg != "Pattern not found: missing" {
+		t.Errorf("status = %q", m.statusMsg)
+	}
+
+	m.searchPattern = ""
+	m.nextMatch(1)
+	if m.statusMsg != "No previous search" {
+		t.Errorf("status = %q", m.statusMsg)
+	}
+}
@@ -0,0 +1,143 @@
+package ui
+
+import (
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// The split view lists the working copy's changes under Staged, Unstaged
+// and Untracked roots. A file can be in two sections at once, so the tree
+// knows files by a key: the section, a slash and the path. selectedPath
+// stays the path in the repository and section tells which diff of it is
+// shown.
+
+// toggleSections switches the tree between all changes and the split view.
+func (m *Model) toggleSections() tea.Cmd {
+	switch {
+	case m.pipedDiff != "":
+		m.statusMsg = "Sections are unavailable for piped diffs"
+		return nil
+	case !m.rng.WorkingCopy():
+		m.statusMsg = "Sections are only available when reviewing the working copy"
+		return nil
+	}
+	want := !m.splitSections
+	m.splitSections = want
+	cmd := m.reloadFiles()
+	switch {
+	case want && m.sections == nil:
+		// listFiles reported why.
+	case want:
+		m.statusMsg = "Showing staged, unstaged and untracked changes"
+	default:
+		m.statusMsg = "Showing all changes"
+	}
+	return cmd
+}
+
+// listFiles returns the tree keys of the changed files. In the split view
+// it loads the sections, falling back to all changes when the backend has
+// no index.
+func (m *Model) listFiles() ([]string, error) {
+	m.sections = nil
+	if m.splitSections && m.pipedDiff == "" && m.rng.WorkingCopy() {
+		sections, err := m.vcs.SectionStatuses()
+		if err == nil {
+			m.sections = sections
+			return m.sectionKeys(), nil
+		}
+		m.splitSections = false
+		m.statusMsg = err.Error()
+	}
+	m.section = ""
+	return m.vcs.ListChangedFiles(m.rng)
+}
+
+// sectionKeys returns the tree keys of every file in the sections.
+func (m Model) sectionKeys() []string {
+	var keys []string
+	for _, s := range vcs.Sections {
+		for path := range m.sections[s] {
+			keys = append(keys, string(s)+"/"+path)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// treeKey returns the key of path in the tree, within the selected section.
+func (m Model) treeKey(path string) string {
+	if m.sections == nil || m.section == "" {
+		return path
+	}
+	return string(m.section) + "/" + path
+}
+
+// splitKey returns the section and repository path of a tree key.
+func (m Model) splitKey(key string) (vcs.Section, string) {
+	if m.sections == nil {
+		return "", key
+	}
+	section, path, _ := strings.Cut(key, "/")
+	return vcs.Section(section), path
+}
+
+// pathOf returns the repository path of a tree key.
+func (m Model) pathOf(key string) string {
+	_, path := m.splitKey(key)
+	return path
+}
+
+// changedPaths returns the repository path of every file in the tree once.
+func (m Model) changedPaths() []string {
+	if m.sections == nil {
+		return m.treeState.Files()
+	}
+	var paths []string
+	seen := make(map[string]bool)
+	for _, key := range m.treeState.Files() {
+		if path := m.pathOf(key); !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// sectionOf returns the first section path is in, for keeping a file
+// selected when the split view opens.
+func (m Model) sectionOf(path string) vcs.Section {
+	for _, s := range vcs.Sections {
+		if _, ok := m.sections[s][path]; ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// treeStatuses returns the status of each file by tree key.
+func (m Model) treeStatuses() map[string]vcs.FileStatus {
+	if m.sections == nil {
+		return m.fileStatuses
+	}
+	statuses := make(map[string]vcs.FileStatus)
+	for s, files := range m.sections {
+		for path, st := range files {
+			statuses[string(s)+"/"+path] = st
+		}
+	}
+	return statuses
+}
+
+// fileDiffCmd loads the diff of path, the one of its section in the split
+// view.
+func (m Model) fileDiffCmd(section vcs.Section, path string) tea.Cmd {
+	if section != "" {
+		return m.vcs.SectionDiffCmd(section, path, m.treeDelegate.Config.ContextLines)
+	}
+	return m.vcs.DiffCmd(m.rng, path, m.origin(path), m.treeDelegate.Config.ContextLines)
+}
@@ -0,0 +1,195 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// splitMinWidth is the narrowest diff pane that still fits two columns;
+// below it the split layout falls back to unified.
+const splitMinWidth = 100
+
+type splitSide int
+
+const (
+	sideRight splitSide = iota
+	sideLeft
+)
+
+// splitRow pairs the old-side and new-side rows of m.diffLines shown on one
+// line of the side-by-side layout. -1 marks a padded, empty cell.
+type splitRow struct {
+	left, right int
+}
+
+// buildSplitRows aligns each run of deletions with the additions that
+// follow it. Context lines and hunk headers appear on both sides.
+func buildSplitRows(lines []diff.Line) []splitRow {
+	var rows []splitRow
+	var dels, adds []int
+
+	flush := func() {
+		n := len(dels)
+		if len(adds) > n {
+			n = len(adds)
+		}
+		for k := 0; k < n; k++ {
+			r := splitRow{left: -1, right: -1}
+			if k < len(dels) {
+				r.left = dels[k]
+			}
+			if k < len(adds) {
+				r.right = adds[k]
+			}
+			rows = append(rows, r)
+		}
+		dels, adds = nil, nil
+	}
+
+	for i, l := range lines {
+		switch l.Kind {
+		case diff.Deleted:
+			if len(adds) > 0 {
+				flush()
+			}
+			dels = append(dels, i)
+		case diff.Added:
+			adds = append(adds, i)
+		default:
+			flush()
+			rows = append(rows, splitRow{left: i, right: i})
+		}
+	}
+	flush()
+	return rows
+}
+
+// renderSplitDiff draws the visible part of the side-by-side layout.
+func (m Model) renderSplitDiff() string {
+	var b strings.Builder
+
+	half := (m.diffViewport.Width - 1) / 2
+	start := m.diffViewport.YOffset
+	end := start + m.diffViewport.Height
+	if end > len(m.splitRows) {
+		end = len(m.splitRows)
+	}
+
+	selStart, selEnd := m.cursorPos(), m.cursorPos()
+	if m.visualMode {
+		selStart = m.posOf(m.visualStart)
+		if selStart > selEnd {
+			selStart, selEnd = selEnd, selStart
+		}
+	}
+
+	sep := DiffCtxGutter.Render("│")
+
+	for p := start; p < end; p++ {
+		r := m.splitRows[p]
+		if r.left >= 0 && m.diffLines[r.left].Kind == diff.HunkHeader {
+			if n := m.hiddenLines[r.left]; n > 0 {
+				b.WriteString(gapLine(n, 2*half+1) + "\n")
+				continue
+			}
+			if end < len(m.splitRows) {
+				end++
+			}
+			continue
+		}
+
+		inSel := m.focus == FocusDiff && p >= selStart && p <= selEnd
+		activeSide := m.splitSide
+		if (activeSide == sideLeft && r.left < 0) || (activeSide == sideRight && r.right < 0) {
+			activeSide = 1 - activeSide
+		}
+
+		left := m.renderSplitCell(r.left, p, half, sideLeft, inSel && activeSide == sideLeft)
+		right := m.renderSplitCell(r.right, p, half, sideRight, inSel && activeSide == sideRight)
+		b.WriteString(left + sep + right + "\n")
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// renderSplitCell draws one side of split row pos, including its line number.
+func (m Model) renderSplitCell(idx, pos, width int, side splitSide, active bool) string {
+	if idx < 0 {
+		return strings.Repeat(" ", width)
+	}
+
+	l := m.diffLines[idx]
+	numStr := m.splitLineNumber(idx, pos, side)
+
+	separator := "│"
+	if active {
+		separator = "┃"
+	}
+	marker := " "
+	switch l.Kind {
+	case diff.Added:
+		marker = "+"
+	case diff.Deleted:
+		marker = "-"
+	}
+	marker += m.gutterMark(idx)
+	gutterStr := marker + separator + " "
+
+	cellWidth := width - lipgloss.Width(numStr)
+	codeWidth := cellWidth - lipgloss.Width(gutterStr)
+	if codeWidth < 1 {
+		codeWidth = 1
+	}
+
+	if active {
+		content := emphasize(l.Content, m.matchSpans(idx), SearchMatchOn, SearchMatchOff)
+		text := gutterStr + ansi.Truncate(content, codeWidth, "")
+		style := CursorNormalStyle
+		switch l.Kind {
+		case diff.Added:
+			style = CursorAddStyle
+		case diff.Deleted:
+			style = CursorDelStyle
+		}
+		return numStr + style.Copy().Width(cellWidth).Render(text)
+	}
+
+	var gutter, code string
+	if m.treeDelegate.Config.UI.Theme == "git" {
+		color := lipgloss.NewStyle()
+		switch l.Kind {
+		case diff.Added:
+			color = color.Foreground(lipgloss.Color("2"))
+		case diff.Deleted:
+			color = color.Foreground(lipgloss.Color("1"))
+		}
+		gutter = color.Render(gutterStr)
+		if l.Kind == diff.Context {
+			gutter = DiffCtxGutter.Render(gutterStr)
+		}
+		code = color.Render(l.Content)
+	} else {
+		switch l.Kind {
+		case diff.Added:
+			gutter = DiffAddGutter.Render(gutterStr)
+		case diff.Deleted:
+			gutter = DiffDelGutter.Render(gutterStr)
+		default:
+			gutter = DiffCtxGutter.Render(gutterStr)
+		}
+		if idx < len(m.diffHighlighted) {
+			code = bgAnsiRe.ReplaceAllString(m.diffHighlighted[idx], "")
+		}
+	}
+
+	if bg, spans := m.lineEmphasis(idx); spans != nil {
+		code = emphasize(code, spans, bg, bgReset)
+	}
+	code = emphasize(code, m.matchSpans(idx), SearchMatchOn, SearchMatchOff)
+	code = ansi.Truncate(code, codeWidth, "")
+	return numStr + lipgloss.NewStyle().Width(cellWidth).Render(gutter+code)
+}
@@ -0,0 +1,53 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// linesOf builds diff lines from one character per line: '@' for a hunk
+// header, '-' for a deletion, '+' for an addition and ' ' for context.
+func linesOf(kinds string) []diff.Line {
+	lines := make([]diff.Line, len(kinds))
+	for i, c := range kinds {
+		switch c {
+		case '@':
+			lines[i].Kind = diff.HunkHeader
+		case '-':
+			lines[i].Kind = diff.Deleted
+		case '+':
+			lines[i].Kind = diff.Added
+		default:
+			lines[i].Kind = diff.Context
+		}
+	}
+	return lines
+}
+
+func TestBuildSplitRows(t *testing.T) {
+	tests := []struct {
+		name  string
+		kinds string
+		want  []splitRow
+	}{
+		{"empty", "", nil},
+		{"context", "@  ", []splitRow{{0, 0}, {1, 1}, {2, 2}}},
+		{"deletions", "@--", []splitRow{{0, 0}, {1, -1}, {2, -1}}},
+		{"additions", "@++", []splitRow{{0, 0}, {-1, 1}, {-1, 2}}},
+		{"paired", "@-+ ", []splitRow{{0, 0}, {1, 2}, {3, 3}}},
+		{"more deletions", "@---+", []splitRow{{0, 0}, {1, 4}, {2, -1}, {3, -1}}},
+		{"more additions", "@-+++", []splitRow{{0, 0}, {1, 2}, {-1, 3}, {-1, 4}}},
+		{"addition then deletion", "@+-", []splitRow{{0, 0}, {-1, 1}, {2, -1}}},
+		{"runs split by context", "@-+ -+", []splitRow{{0, 0}, {1, 2}, {3, 3}, {4, 5}}},
+		{"runs split by hunks", "@-@+", []splitRow{{0, 0}, {1, -1}, {2, 2}, {-1, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildSplitRows(linesOf(tt.kinds)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildSplitRows(%q) = %v, want %v", tt.kinds, got, tt.want)
+			}
+		})
+	}
+}
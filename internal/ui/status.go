@@ -0,0 +1,51 @@
+package ui
+
+import (
+	"github.com/oug-t/difi/internal/tree"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// setFileStatuses shows how each changed file changed in the tree.
+func (m *Model) setFileStatuses(statuses map[string]vcs.FileStatus) {
+	m.fileStatuses = statuses
+	m.treeState.SetStatuses(statusLetters(m.treeStatuses()))
+	m.setTreeItems()
+}
+
+// toggleStatusSort switches the tree between listing files by name and by
+// status.
+func (m *Model) toggleStatusSort() {
+	m.sortByStatus = !m.sortByStatus
+	m.treeState.SetSortByStatus(m.sortByStatus)
+	m.setTreeItems()
+	if m.sortByStatus {
+		m.statusMsg = "Sorted by status"
+	} else {
+		m.statusMsg = "Sorted by name"
+	}
+}
+
+// setTreeItems lists the tree again after its order or marks changed,
+// keeping the cursor on the same entry.
+func (m *Model) setTreeItems() {
+	prev, _ := m.fileList.SelectedItem().(tree.TreeItem)
+	items := m.treeState.Items()
+	m.fileList.SetItems(items)
+	for idx, item := range items {
+		if ti, ok := item.(tree.TreeItem); ok && ti.FullPath == prev.FullPath {
+			m.fileList.Select(idx)
+			return
+		}
+	}
+}
+
+func statusLetters(statuses map[string]vcs.FileStatus) map[string]byte {
+	if statuses == nil {
+		return nil
+	}
+	letters := make(map[string]byte, len(statuses))
+	for path, st := range statuses {
+		letters[path] = byte(st)
+	}
+	return letters
+}
@@ -9,7 +9,10 @@ var (
 	nord0  = lipgloss.Color("#2E3440")
 	nord3  = lipgloss.Color("#4C566A")
 	nord4  = lipgloss.Color("#D8DEE9")
+	nord7  = lipgloss.Color("#8FBCBB")
 	nord11 = lipgloss.Color("#BF616A")
+	nord12 = lipgloss.Color("#D08770")
+	nord13 = lipgloss.Color("#EBCB8B")
 	nord14 = lipgloss.Color("#A3BE8C")
 	nord9  = lipgloss.Color("#81A1C1")
 
@@ -73,8 +76,52 @@ var (
 	StatusAddedStyle   = lipgloss.NewStyle().Foreground(nord14).Padding(0, 1)
 	StatusDeletedStyle = lipgloss.NewStyle().Foreground(nord11).Padding(0, 1)
 	StatusDividerStyle = lipgloss.NewStyle().Foreground(nord3).Padding(0, 1)
+	StatusMsgStyle     = lipgloss.NewStyle().Foreground(nord13).Padding(0, 1)
+
+	StagedMarkStyle   = lipgloss.NewStyle().Foreground(nord14)
+	PartialMarkStyle  = lipgloss.NewStyle().Foreground(nord13)
+	UnstagedMarkStyle = lipgloss.NewStyle().Foreground(nord3)
+
+	// FileStatusStyles color the status letters of the tree.
+	FileStatusStyles = map[byte]lipgloss.Style{
+		'M': lipgloss.NewStyle().Foreground(nord13),
+		'A': lipgloss.NewStyle().Foreground(nord14),
+		'D': lipgloss.NewStyle().Foreground(nord11),
+		'?': lipgloss.NewStyle().Foreground(nord7),
+		'U': lipgloss.NewStyle().Foreground(nord12).Bold(true),
+	}
+
+	ViewedFileStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+	ViewedMarkStyle = lipgloss.NewStyle().Foreground(nord14)
+
+	CommentMarkStyle   = lipgloss.NewStyle().Foreground(nord13)
+	CommentStatusStyle = lipgloss.NewStyle().Foreground(nord4).Padding(0, 1)
+	CommentTitleStyle  = lipgloss.NewStyle().Foreground(nord9).Bold(true).Padding(0, 1)
+	CommentBoxStyle    = lipgloss.NewStyle().Border(lipgloss.NormalBorder(), true, false, false, false).BorderForeground(nord3)
+
+	FinderBoxStyle      = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(nord9).Padding(0, 1)
+	FinderPromptStyle   = lipgloss.NewStyle().Foreground(nord9).Bold(true)
+	FinderSelectedStyle = lipgloss.NewStyle().Background(lipgloss.Color("237")).Foreground(lipgloss.Color("255"))
+	FinderMatchStyle    = lipgloss.NewStyle().Foreground(nord13).Bold(true)
+
+	CommitHashStyle     = lipgloss.NewStyle().Foreground(nord13)
+	CommitSelectedStyle = lipgloss.NewStyle().Background(lipgloss.Color("237")).Foreground(lipgloss.Color("255")).Bold(true)
+	CommitSubjectStyle  = lipgloss.NewStyle().Foreground(nord4).Bold(true)
+	CommitMetaStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+
+	FileInfoStyle = lipgloss.NewStyle().Foreground(nord9)
 
 	ColorText = lipgloss.Color("252")
+
+	// Intraline emphasis backgrounds are raw escapes so they can be
+	// re-applied inside syntax-highlighted text.
+	DiffAddEmphasisBg = "\x1b[48;2;59;90;68m"
+	DiffDelEmphasisBg = "\x1b[48;2;107;48;55m"
+
+	// Search matches use reverse video so they show on any background,
+	// including the cursor line.
+	SearchMatchOn  = "\x1b[7m"
+	SearchMatchOff = "\x1b[27m"
 )
 
 func InitStyles(cfg config.Config) {
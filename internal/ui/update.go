@@ -1,13 +1,15 @@
 package ui
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
-	"github.com/alecthomas/chroma/v2/quick"
 	tea "github.com/charmbracelet/bubbletea"
 
+	"github.com/oug-t/difi/internal/diff"
 	"github.com/oug-t/difi/internal/tree"
 	"github.com/oug-t/difi/internal/vcs"
 )
@@ -23,6 +25,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.width = msg.Width
 		m.height = msg.Height
 		m.updateSizes()
+		m.handleScrolling()
 
 	case StatsMsg:
 		m.statsAdded = msg.Added
@@ -31,12 +34,144 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.fileStats = msg.ByFile
 		}
 
+	case StageStatesMsg:
+		m.treeDelegate.Stage = msg.States
+		m.fileList.SetDelegate(m.treeDelegate)
+
+	case StageMsg:
+		if msg.Err != nil {
+			m.statusMsg = msg.Err.Error()
+			return m, nil
+		}
+		m.visualMode = false
+		if msg.Unstage {
+			m.statusMsg = "Unstaged"
+		} else {
+			m.statusMsg = "Staged"
+		}
+		if m.sections != nil {
+			// The change moved between sections.
+			return m, tea.Batch(m.refresh(), m.fetchStageStatesCmd())
+		}
+		return m, m.fetchStageStatesCmd()
+
+	case DiscardMsg:
+		if msg.Err != nil {
+			m.statusMsg = msg.Err.Error()
+			return m, nil
+		}
+		m.visualMode = false
+		if msg.Undo {
+			m.statusMsg = "Restored"
+		} else {
+			m.undoStack = append(m.undoStack, discardEntry{path: msg.Path, patch: msg.Patch})
+			m.statusMsg = "Discarded (U to undo)"
+		}
+		if m.sections != nil {
+			return m, m.refresh()
+		}
+		cmds := []tea.Cmd{m.fetchStatsCmd(), m.fetchStageStatesCmd(), m.fetchHashesCmd()}
+		if msg.Path == m.selectedPath {
+			cmds = append(cmds, m.fetchDiffCmd())
+		}
+		return m, tea.Batch(cmds...)
+
+	case SearchHitMsg:
+		switch msg.Path {
+		case "":
+			m.statusMsg = "Pattern not found: " + m.searchPattern
+		case m.treeKey(m.selectedPath):
+			if idx := m.matchFrom(msg.Dir, true); idx >= 0 {
+				m.gotoMatch(idx)
+			}
+			m.statusMsg = "Search wrapped around all files"
+		default:
+			m.searchJump = msg.Dir
+			m.statusMsg = ""
+			return m, m.selectFile(msg.Path)
+		}
+		return m, nil
+
+	case CommitsMsg:
+		return m, m.handleCommits(msg)
+
+	case RefreshMsg:
+		cmds := []tea.Cmd{m.watchCmd()}
+		if m.rng.WorkingCopy() {
+			cmds = append(cmds, m.refresh())
+		}
+		return m, tea.Batch(cmds...)
+
+	case HashesMsg:
+		if msg.Range == m.rng {
+			m.diffHashes = msg.Hashes
+			m.hashesRng = msg.Range
+			m.syncViewed()
+		}
+
+	case RenamesMsg:
+		if msg.Range == m.rng {
+			return m, m.setRenames(msg)
+		}
+
+	case FileSizesMsg:
+		if msg.Path == m.selectedPath {
+			m.fileSizes = &msg
+			m.updateSizes()
+		}
+
+	case CommentEditedMsg:
+		m.handleCommentEdited(msg)
+		return m, nil
+
+	case ConflictResolvedMsg:
+		return m, m.handleConflictResolved(msg)
+
+	case FileStatusesMsg:
+		m.setFileStatuses(msg.Statuses)
+		if m.treeState.Filtered() {
+			return m, m.setFilter(m.filterQuery)
+		}
+
 	case tea.KeyMsg:
+		if m.composing {
+			return m.handleCommentKey(msg)
+		}
+		if m.searching {
+			return m.handleSearchKey(msg)
+		}
+		if m.finderOpen {
+			return m.handleFinderKey(msg)
+		}
+		if m.conflict != nil {
+			return m.handleConflictKey(msg)
+		}
+		if m.filtering {
+			return m.handleFilterKey(msg)
+		}
 		if msg.String() == "q" || msg.String() == "ctrl+c" {
 			return m, tea.Quit
 		}
+		m.statusMsg = ""
 
-		if len(m.fileList.Items()) == 0 {
+		if m.pendingDiscard != "" {
+			patch := m.pendingDiscard
+			m.pendingDiscard = ""
+			if msg.String() == "y" {
+				return m, m.discardCmd(m.selectedPath, patch, false)
+			}
+			m.statusMsg = "Discard cancelled"
+			return m, nil
+		}
+
+		if len(m.fileList.Items()) == 0 && !(m.inCommit() && isCommitKey(msg.String())) {
+			switch {
+			case !m.treeState.Filtered():
+			case msg.String() == "/":
+				m.startFilter()
+			case msg.String() == "esc":
+				return m, m.setFilter("")
+			}
 			return m, nil
 		}
 
@@ -47,20 +182,71 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				case "z", ".":
 					m.centerDiffCursor()
 				case "t":
-					m.setYOffset(m.diffCursor)
+					m.setYOffset(m.cursorPos())
 				case "b":
-					m.setYOffset(m.diffCursor - m.diffViewport.Height + 1)
+					m.setYOffset(m.cursorPos() - m.diffViewport.Height + 1)
+				case "k", "j", "o", "R", "M":
+					m.expandContext(msg.String())
 				}
 			}
 			return m, nil
 		}
 
+		if m.pendingBracket != "" {
+			bracket := m.pendingBracket
+			m.pendingBracket = ""
+			dir := 1
+			if bracket == "[" {
+				dir = -1
+			}
+			switch msg.String() {
+			case "c":
+				m.moveHunk(dir, m.getRepeatCount())
+				m.inputBuffer = ""
+				return m, nil
+			case "f":
+				cmd := m.moveFile(dir, m.getRepeatCount())
+				m.inputBuffer = ""
+				return m, cmd
+			case "u":
+				cmd := m.moveUnviewed(dir, m.getRepeatCount())
+				m.inputBuffer = ""
+				return m, cmd
+			case "esc":
+				return m, nil
+			}
+			// Not a bracket motion: "[" keeps its old meaning and the key
+			// is handled as usual.
+			if bracket == "[" {
+				m.visualMode = false
+				m.focus = FocusTree
+				m.updateTreeFocus()
+				m.inputBuffer = ""
+			}
+		}
+
 		if len(msg.String()) == 1 && strings.ContainsAny(msg.String(), "0123456789") {
 			m.inputBuffer += msg.String()
 			return m, nil
 		}
 
-		if msg.String() == "?" {
+		if m.focus == FocusDiff && !m.showHelp && (msg.String() == "/" || msg.String() == "?") {
+			m.startSearch(msg.String() == "?")
+			return m, nil
+		}
+
+		if msg.String() == "ctrl+p" {
+			m.openFinder()
+			return m, nil
+		}
+
+		if m.focus == FocusTree && msg.String() == "/" {
+			m.startFilter()
+			return m, nil
+		}
+
+		// ? searches backward in the diff pane, so F1 toggles help there.
+		if msg.String() == "?" || msg.String() == "f1" {
 			m.showHelp = !m.showHelp
 			m.updateSizes()
 			return m, nil
@@ -77,9 +263,26 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.inputBuffer = ""
 
 		case "esc":
+			if m.focus == FocusTree && m.treeState.Filtered() {
+				m.inputBuffer = ""
+				return m, m.setFilter("")
+			}
+			if !m.visualMode {
+				m.clearSearch()
+			}
 			m.visualMode = false
 			m.inputBuffer = ""
 
+		case "n", "N":
+			if m.focus == FocusDiff {
+				m.inputBuffer = ""
+				dir := 1
+				if msg.String() == "N" {
+					dir = -1
+				}
+				return m, m.nextMatch(dir)
+			}
+
 		case "tab":
 			m.visualMode = false
 			if m.focus == FocusTree {
@@ -94,12 +297,20 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.inputBuffer = ""
 
 		case "ctrl+h", "[":
+			if msg.String() == "[" && m.focus == FocusDiff {
+				m.pendingBracket = "["
+				return m, nil
+			}
 			m.visualMode = false
 			m.focus = FocusTree
 			m.updateTreeFocus()
 			m.inputBuffer = ""
 
 		case "ctrl+l", "]":
+			if msg.String() == "]" && m.focus == FocusDiff {
+				m.pendingBracket = "]"
+				return m, nil
+			}
 			m.visualMode = false
 			if m.focus == FocusTree {
 				if item, ok := m.fileList.SelectedItem().(tree.TreeItem); ok && item.IsDir {
@@ -111,15 +322,27 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.inputBuffer = ""
 
 		case "h", "left":
-			m.visualMode = false
 			keyHandled = true
+			if m.focus == FocusDiff && m.isSplit() && m.splitSide == sideRight {
+				m.splitSide = sideLeft
+				m.diffCursor = m.snapCursor(m.cursorPos(), 1)
+				m.inputBuffer = ""
+				break
+			}
+			m.visualMode = false
 			m.focus = FocusTree
 			m.updateTreeFocus()
 			m.inputBuffer = ""
 
 		case "l", "right":
-			m.visualMode = false
 			keyHandled = true
+			if m.focus == FocusDiff && m.isSplit() && m.splitSide == sideLeft {
+				m.splitSide = sideRight
+				m.diffCursor = m.snapCursor(m.cursorPos(), 1)
+				m.inputBuffer = ""
+				break
+			}
+			m.visualMode = false
 			if item, ok := m.fileList.SelectedItem().(tree.TreeItem); ok && item.IsDir {
 				return m, nil
 			}
@@ -142,14 +365,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					return m, nil
 				}
 
-				line := 0
-				if m.focus == FocusDiff {
-					line = m.vcs.CalculateFileLine(m.diffContent, m.diffCursor)
-				} else {
-					line = m.vcs.CalculateFileLine(m.diffContent, 0)
-				}
+				line, old := m.cursorFileLine()
 				m.inputBuffer = ""
-				return m, m.vcs.OpenEditorCmd(m.selectedPath, line, m.targetBranch, m.treeDelegate.Config.Editor)
+				return m.openEditor(line, old)
 			}
 
 		case "z":
@@ -158,6 +376,134 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 
+		case "s", "u":
+			if m.focus == FocusDiff {
+				m.inputBuffer = ""
+				if m.pipedDiff != "" {
+					m.statusMsg = "Staging is unavailable for piped diffs"
+					return m, nil
+				}
+				if !m.rng.WorkingCopy() {
+					m.statusMsg = "Staging is unavailable when reviewing committed revisions"
+					return m, nil
+				}
+				unstage := msg.String() == "u"
+				switch {
+				case unstage && m.section != "" && m.section != vcs.SectionStaged:
+					m.statusMsg = "Nothing staged here; unstage from the Staged section"
+					return m, nil
+				case !unstage && m.section == vcs.SectionStaged:
+					m.statusMsg = "Already staged; stage from the Unstaged section"
+					return m, nil
+				}
+				return m, m.stageCmd(unstage)
+			}
+
+		case "x":
+			if m.focus == FocusDiff {
+				m.inputBuffer = ""
+				if m.pipedDiff != "" {
+					m.statusMsg = "Discarding is unavailable for piped diffs"
+					return m, nil
+				}
+				if !m.rng.WorkingCopy() {
+					m.statusMsg = "Discarding is unavailable when reviewing committed revisions"
+					return m, nil
+				}
+				if m.section == vcs.SectionStaged {
+					m.statusMsg = "Unstage the changes before discarding them"
+					return m, nil
+				}
+				sel := m.selectedChanges()
+				if len(sel) == 0 || m.diffFile == nil {
+					m.statusMsg = "No changes under cursor"
+					return m, nil
+				}
+				m.pendingDiscard = m.diffFile.Patch(diff.MatchNew(sel), true)
+				m.statusMsg = fmt.Sprintf("Discard %d changed lines from %s? (y/n)", len(sel), m.selectedPath)
+				return m, nil
+			}
+
+		case "S":
+			m.toggleSplit()
+			if m.splitView && !m.isSplit() {
+				m.statusMsg = "Too narrow for split view, showing unified"
+			}
+			m.inputBuffer = ""
+
+		case "U":
+			if len(m.undoStack) == 0 {
+				m.statusMsg = "Nothing to undo"
+				return m, nil
+			}
+			last := m.undoStack[len(m.undoStack)-1]
+			m.undoStack = m.undoStack[:len(m.undoStack)-1]
+			return m, m.discardCmd(last.path, last.patch, true)
+
+		case "#":
+			m.cycleLineNumbers()
+			m.inputBuffer = ""
+
+		case "v":
+			m.toggleViewed()
+			m.inputBuffer = ""
+
+		case "o":
+			m.toggleStatusSort()
+			m.inputBuffer = ""
+
+		case "i":
+			m.inputBuffer = ""
+			return m, m.toggleSections()
+
+		case "m":
+			m.inputBuffer = ""
+			m.openConflict()
+
+		case "a":
+			if m.focus == FocusDiff {
+				m.startComment()
+			}
+			m.inputBuffer = ""
+
+		case "A":
+			m.inputBuffer = ""
+			if m.focus == FocusDiff {
+				return m, m.editComment()
+			}
+
+		case "c":
+			m.inputBuffer = ""
+			return m, m.toggleCommits()
+
+		case "R":
+			m.inputBuffer = ""
+			if m.pipedDiff != "" {
+				m.statusMsg = "Nothing to reload for piped diffs"
+				return m, nil
+			}
+			m.statusMsg = "Reloaded"
+			return m, m.refresh()
+
+		case ")", "(":
+			dir := 1
+			if msg.String() == "(" {
+				dir = -1
+			}
+			cmd := m.stepCommit(dir, m.getRepeatCount())
+			m.inputBuffer = ""
+			return m, cmd
+
+		case "}", "{":
+			if m.focus == FocusDiff {
+				dir := 1
+				if msg.String() == "{" {
+					dir = -1
+				}
+				m.moveHunk(dir, m.getRepeatCount())
+			}
+			m.inputBuffer = ""
+
 		case "H":
 			if m.focus == FocusDiff {
 				m.diffCursor = m.snapCursor(m.diffViewport.YOffset, 1)
@@ -177,7 +523,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		case "ctrl+d":
 			if m.focus == FocusDiff {
-				target := m.diffCursor + m.diffViewport.Height/2
+				target := m.cursorPos() + m.diffViewport.Height/2
 				m.diffCursor = m.snapCursor(target, 1)
 				m.centerDiffCursor()
 			}
@@ -185,7 +531,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		case "ctrl+u":
 			if m.focus == FocusDiff {
-				target := m.diffCursor - m.diffViewport.Height/2
+				target := m.cursorPos() - m.diffViewport.Height/2
 				m.diffCursor = m.snapCursor(target, -1)
 				m.centerDiffCursor()
 			}
@@ -195,7 +541,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			keyHandled = true
 			for i := 0; i < m.getRepeatCount(); i++ {
 				if m.focus == FocusDiff {
-					m.diffCursor = m.snapCursor(m.diffCursor+1, 1)
+					m.diffCursor = m.snapCursor(m.cursorPos()+1, 1)
 					m.handleScrolling()
 				} else {
 					m.fileList.CursorDown()
@@ -207,7 +553,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			keyHandled = true
 			for i := 0; i < m.getRepeatCount(); i++ {
 				if m.focus == FocusDiff {
-					m.diffCursor = m.snapCursor(m.diffCursor-1, -1)
+					m.diffCursor = m.snapCursor(m.cursorPos()-1, -1)
 					m.handleScrolling()
 				} else {
 					m.fileList.CursorUp()
@@ -219,7 +565,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.focus == FocusDiff {
 				if m.inputBuffer == "g" {
 					m.diffCursor = m.snapCursor(0, 1)
-					m.setYOffset(m.diffCursor)
+					m.setYOffset(m.cursorPos())
 					m.inputBuffer = ""
 				} else {
 					m.inputBuffer = "g"
@@ -233,9 +579,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					target := count - 1
 					m.diffCursor = m.snapCursor(target, 1)
 				} else {
-					m.diffCursor = m.snapCursor(len(m.diffLines)-1, -1)
+					m.diffCursor = m.snapCursor(m.rowCount()-1, -1)
 				}
-				m.setYOffset(m.diffCursor - m.diffViewport.Height + 1)
+				m.setYOffset(m.cursorPos() - m.diffViewport.Height + 1)
 				m.inputBuffer = ""
 			}
 
@@ -251,92 +597,114 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 		if item, ok := m.fileList.SelectedItem().(tree.TreeItem); ok {
-			if !item.IsDir && item.FullPath != m.selectedPath {
-				m.selectedPath = item.FullPath
+			if !item.IsDir && item.FullPath != m.treeKey(m.selectedPath) {
+				m.section, m.selectedPath = m.splitKey(item.FullPath)
 				m.diffCursor = 0
 				m.visualMode = false
 				m.diffViewport.GotoTop()
-				if m.pipedDiff != "" {
-					cmds = append(cmds, func() tea.Msg {
-						return vcs.DiffMsg{Content: m.vcs.ExtractFileDiff(m.pipedDiff, m.selectedPath)}
-					})
-				} else {
-					cmds = append(cmds, m.vcs.DiffCmd(m.targetBranch, m.selectedPath))
-				}
+				cmds = append(cmds, m.fetchDiffCmd())
 			}
 		}
 	}
 
 	switch msg := msg.(type) {
 	case vcs.DiffMsg:
-		fullLines := strings.Split(msg.Content, "\n")
-		var cleanLines, hlLines []string
+		files := diff.Parse(msg.Content)
+		file := diff.Find(files, m.selectedPath)
+		if file == nil && len(files) > 0 {
+			file = files[0]
+		}
 		var added, deleted int
-		foundHunk := false
-
-		ext := filepath.Ext(m.selectedPath)
-		if len(ext) > 0 {
-			ext = ext[1:]
-		} else {
-			ext = "txt"
+		if file != nil {
+			added, deleted = file.Stats()
 		}
 
-		isGitTheme := m.treeDelegate.Config.UI.Theme == "git"
-
-		for _, line := range fullLines {
-			cleanLine := stripAnsi(line)
+		m.diffContent = msg.Content
+		m.diffBase = file
+		m.keepExpansion()
+		m.setDiffFile(m.expandedFile())
+		m.currentFileAdded = added
+		m.currentFileDeleted = deleted
+		m.diffCursor = m.snapCursor(0, 1)
 
-			if strings.HasPrefix(cleanLine, "@@") {
-				foundHunk = true
+		if m.searchRe != nil || m.searchJump != 0 {
+			m.setSearch(m.searchPattern)
+			if m.searchJump != 0 && len(m.searchMatches) > 0 {
+				idx := 0
+				if m.searchJump < 0 {
+					idx = len(m.searchMatches) - 1
+				}
+				m.gotoMatch(idx)
 			}
+		}
+		m.searchJump = 0
+		m.syncComments()
+		if m.fileSizes != nil && m.fileSizes.Path != m.selectedPath {
+			m.fileSizes = nil
+		}
+		m.updateSizes()
+		cmds = append(cmds, m.fetchFileSizesCmd(file))
 
-			if !foundHunk {
-				continue
+		if a := m.anchor; a != nil {
+			m.anchor = nil
+			if a.path == m.selectedPath {
+				m.restoreCursor(*a)
 			}
+		}
 
-			cleanLines = append(cleanLines, line)
-
-			isAdd := strings.HasPrefix(cleanLine, "+") && !strings.HasPrefix(cleanLine, "+++")
-			isDel := strings.HasPrefix(cleanLine, "-") && !strings.HasPrefix(cleanLine, "---")
-
-			if isAdd {
-				added++
-			} else if isDel {
-				deleted++
-			}
+	case vcs.EditorFinishedMsg:
+		if m.readOnlyFile != "" {
+			_ = os.Remove(m.readOnlyFile)
+			m.readOnlyFile = ""
+		}
+		if m.pipedDiff != "" {
+			return m, m.fetchDiffCmd()
+		}
+		return m, m.refresh()
+	}
 
-			codeContent := cleanLine
-			if len(codeContent) > 0 && (isAdd || isDel || strings.HasPrefix(codeContent, " ")) {
-				codeContent = codeContent[1:]
-			}
+	return m, tea.Batch(cmds...)
+}
 
-			if isGitTheme {
-				hlLines = append(hlLines, codeContent)
-			} else {
-				var buf strings.Builder
-				err := quick.Highlight(&buf, codeContent, ext, "terminal16m", "nord")
-				if err == nil && buf.String() != "" {
-					hlLines = append(hlLines, strings.TrimSuffix(buf.String(), "\n"))
-				} else {
-					hlLines = append(hlLines, codeContent)
-				}
-			}
+// openEditor opens the selected file at line. Files that are not checked
+// out, the base side of the split layout or the head of a range of
+// committed revisions, open as read-only copies.
+func (m Model) openEditor(line int, old bool) (tea.Model, tea.Cmd) {
+	f := m.diffFile
+	if m.pipedDiff == "" && f != nil {
+		switch {
+		case old && !f.NewFile:
+			return m.openRevision(m.rng.Base, f.OldPath, line)
+		case !m.rng.WorkingCopy() && f.DeletedFile:
+			return m.openRevision(m.rng.Base, f.OldPath, line)
+		case !m.rng.WorkingCopy():
+			return m.openRevision(m.rng.Head, f.Path(), line)
 		}
+	}
+	return m, m.vcs.OpenEditorCmd(m.selectedPath, line, m.rng, m.treeDelegate.Config.Editor)
+}
 
-		m.diffLines = cleanLines
-		m.diffHighlighted = hlLines
-		m.currentFileAdded = added
-		m.currentFileDeleted = deleted
-		m.diffCursor = m.snapCursor(0, 1)
+// openRevision opens a read-only copy of path as it is in rev.
+func (m Model) openRevision(rev, path string, line int) (tea.Model, tea.Cmd) {
+	content, err := m.vcs.ShowFile(rev, path)
+	if err != nil {
+		m.statusMsg = err.Error()
+		return m, nil
+	}
 
-	case vcs.EditorFinishedMsg:
-		if m.pipedDiff != "" {
-			return m, func() tea.Msg {
-				return vcs.DiffMsg{Content: m.vcs.ExtractFileDiff(m.pipedDiff, m.selectedPath)}
-			}
+	f, err := os.CreateTemp("", "difi-*-"+filepath.Base(path))
+	if err == nil {
+		_, err = f.Write(content)
+		if cerr := f.Close(); err == nil {
+			err = cerr
 		}
-		return m, m.vcs.DiffCmd(m.targetBranch, m.selectedPath)
 	}
+	if err != nil {
+		m.statusMsg = "Cannot write " + rev + " revision: " + err.Error()
+		return m, nil
+	}
+	_ = os.Chmod(f.Name(), 0444)
 
-	return m, tea.Batch(cmds...)
+	m.readOnlyFile = f.Name()
+	return m, m.vcs.OpenEditorCmd(f.Name(), line, m.rng, m.treeDelegate.Config.Editor)
 }
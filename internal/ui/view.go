@@ -2,12 +2,12 @@ package ui
 
 import (
 	"fmt"
-	"math"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/x/ansi"
 
+	"github.com/oug-t/difi/internal/diff"
 	"github.com/oug-t/difi/internal/tree"
 	"github.com/oug-t/difi/internal/vcs"
 )
@@ -22,14 +22,21 @@ func (m Model) View() string {
 	var mainContent string
 	contentHeight := m.height - 2
 	if m.showHelp {
-		contentHeight -= 6
+		contentHeight -= lipgloss.Height(m.renderHelpDrawer()) - 1
+	}
+	if m.composing {
+		contentHeight -= m.commentBoxHeight() - 1
 	}
 	if contentHeight < 0 {
 		contentHeight = 0
 	}
 
-	if len(m.fileList.Items()) == 0 {
-		mainContent = m.renderEmptyState(m.width, contentHeight, "No changes found against "+m.targetBranch)
+	if m.finderOpen {
+		mainContent = m.renderFinder(m.width, contentHeight)
+	} else if len(m.fileList.Items()) == 0 && m.treeState.Filtered() {
+		mainContent = m.renderEmptyState(m.width, contentHeight, "No files match filter: "+m.filterQuery)
+	} else if len(m.fileList.Items()) == 0 && !m.inCommit() {
+		mainContent = m.renderEmptyState(m.width, contentHeight, "No changes found against "+m.rng.String())
 	} else {
 		treeStyle := PaneStyle
 		if m.focus == FocusTree {
@@ -47,175 +54,192 @@ func (m Model) View() string {
 
 		if ok && selectedItem.IsDir {
 			rightPaneView = m.renderEmptyState(m.diffViewport.Width, m.diffViewport.Height, "Directory: "+selectedItem.Name)
+		} else if m.conflict != nil {
+			height := m.diffViewport.Height + len(m.diffHeader(m.diffViewport.Width))
+			rightPaneView = DiffStyle.Copy().
+				Width(m.diffViewport.Width).
+				Height(height).
+				Render("\n" + m.renderConflict(m.diffViewport.Width, height-1))
 		} else {
-			var renderedDiff strings.Builder
-
 			viewportHeight := m.diffViewport.Height
-			start := m.diffViewport.YOffset
-			end := start + viewportHeight
-			if end > len(m.diffLines) {
-				end = len(m.diffLines)
-			}
 
-			maxLineWidth := m.diffViewport.Width - 7
-			if maxLineWidth < 1 {
-				maxLineWidth = 1
+			var diffBody string
+			if m.isSplit() {
+				diffBody = m.renderSplitDiff()
+			} else {
+				diffBody = m.renderUnifiedDiff()
+			}
+			if len(m.fileList.Items()) == 0 {
+				diffBody = EmptyStatusStyle.Render("  This commit changes no files")
+			}
+			diffContentStr := "\n" + diffBody
+			if header := m.diffHeader(m.diffViewport.Width); header != nil {
+				diffContentStr = "\n" + strings.Join(header, "\n") + diffContentStr
+				viewportHeight += len(header)
 			}
 
-			isGitTheme := m.treeDelegate.Config.UI.Theme == "git"
+			rightPaneView = DiffStyle.Copy().
+				Width(m.diffViewport.Width).
+				Height(viewportHeight).
+				Render(diffContentStr)
+		}
 
-			for i := start; i < end; i++ {
-				rawLine := m.diffLines[i]
-				cleanLine := stripAnsi(rawLine)
+		mainContent = lipgloss.JoinHorizontal(lipgloss.Top, m.joinCommitPane(treeView), rightPaneView)
+	}
 
-				if isDiffMetadata(cleanLine) {
-					if end < len(m.diffLines) {
-						end++
-					}
-					continue
-				}
+	var bottomBar string
+	if m.composing {
+		bottomBar = m.renderCommentBox()
+	} else if m.showHelp {
+		bottomBar = m.renderHelpDrawer()
+	} else {
+		bottomBar = m.viewStatusBar()
+	}
 
-				isAdd := strings.HasPrefix(cleanLine, "+")
-				isDel := strings.HasPrefix(cleanLine, "-")
+	return lipgloss.JoinVertical(lipgloss.Top, topBar, mainContent, bottomBar)
+}
 
-				codeContent := cleanLine
-				if len(codeContent) > 0 && (isAdd || isDel || strings.HasPrefix(codeContent, " ")) {
-					codeContent = codeContent[1:]
-				}
+// renderUnifiedDiff draws the visible part of the unified layout.
+func (m Model) renderUnifiedDiff() string {
+	var renderedDiff strings.Builder
 
-				// Active line evaluation handles both single cursor and Visual Mode
-				isCursor := false
-				if m.focus == FocusDiff {
-					if m.visualMode {
-						minIdx, maxIdx := m.visualStart, m.diffCursor
-						if minIdx > maxIdx {
-							minIdx, maxIdx = maxIdx, minIdx
-						}
-						isCursor = (i >= minIdx && i <= maxIdx)
-					} else {
-						isCursor = (i == m.diffCursor)
-					}
-				}
+	viewportHeight := m.diffViewport.Height
+	start := m.diffViewport.YOffset
+	end := start + viewportHeight
+	if end > len(m.diffLines) {
+		end = len(m.diffLines)
+	}
 
-				separator := "│"
-				if isCursor {
-					separator = "┃"
-				}
+	maxLineWidth := m.diffViewport.Width - m.unifiedGutterWidth() - 2
+	if maxLineWidth < 1 {
+		maxLineWidth = 1
+	}
 
-				var gutterStr string
-				if isAdd {
-					gutterStr = "+ " + separator + " "
-				} else if isDel {
-					gutterStr = "- " + separator + " "
-				} else {
-					gutterStr = "  " + separator + " "
-				}
+	isGitTheme := m.treeDelegate.Config.UI.Theme == "git"
 
-				var numStr string
-				mode := "relative"
-
-				if mode != "hidden" {
-					if isCursor && mode == "hybrid" {
-						realLine := m.vcs.CalculateFileLine(m.diffContent, m.diffCursor)
-						numStr = fmt.Sprintf("%d", realLine)
-					} else if isCursor && mode == "relative" {
-						numStr = "0"
-					} else if mode == "absolute" {
-						numStr = fmt.Sprintf("%d", i+1)
-					} else {
-						dist := int(math.Abs(float64(i - m.diffCursor)))
-						numStr = fmt.Sprintf("%d", dist)
-					}
-				}
+	for i := start; i < end; i++ {
+		row := m.diffLines[i]
 
-				lineNumRendered := ""
-				if numStr != "" {
-					lineNumRendered = LineNumberStyle.Render(numStr)
+		if row.Kind == diff.HunkHeader {
+			if n := m.hiddenLines[i]; n > 0 {
+				renderedDiff.WriteString(gapLine(n, m.diffViewport.Width-2) + "\n")
+				continue
+			}
+			if end < len(m.diffLines) {
+				end++
+			}
+			continue
+		}
+
+		isAdd := row.Kind == diff.Added
+		isDel := row.Kind == diff.Deleted
+		codeContent := row.Content
+
+		// Active line evaluation handles both single cursor and Visual Mode
+		isCursor := false
+		if m.focus == FocusDiff {
+			if m.visualMode {
+				minIdx, maxIdx := m.visualStart, m.diffCursor
+				if minIdx > maxIdx {
+					minIdx, maxIdx = maxIdx, minIdx
 				}
+				isCursor = (i >= minIdx && i <= maxIdx)
+			} else {
+				isCursor = (i == m.diffCursor)
+			}
+		}
 
-				var line string
+		separator := "│"
+		if isCursor {
+			separator = "┃"
+		}
+
+		var gutterStr string
+		if isAdd {
+			gutterStr = "+" + m.gutterMark(i) + separator + " "
+		} else if isDel {
+			gutterStr = "-" + m.gutterMark(i) + separator + " "
+		} else {
+			gutterStr = " " + m.gutterMark(i) + separator + " "
+		}
+
+		lineNumRendered := m.unifiedLineNumber(i)
+
+		var line string
 
-				if isCursor {
-					fullStr := gutterStr + ansi.Truncate(codeContent, maxLineWidth-4, "")
+		if isCursor {
+			codeContent = emphasize(codeContent, m.matchSpans(i), SearchMatchOn, SearchMatchOff)
+			fullStr := gutterStr + ansi.Truncate(codeContent, maxLineWidth-4, "")
 
-					visibleLen := lipgloss.Width(fullStr)
-					padLen := maxLineWidth - visibleLen
-					if padLen > 0 {
-						fullStr += strings.Repeat(" ", padLen)
-					}
+			visibleLen := lipgloss.Width(fullStr)
+			padLen := maxLineWidth - visibleLen
+			if padLen > 0 {
+				fullStr += strings.Repeat(" ", padLen)
+			}
+
+			if isAdd {
+				line = CursorAddStyle.Copy().Width(maxLineWidth).Render(fullStr)
+			} else if isDel {
+				line = CursorDelStyle.Copy().Width(maxLineWidth).Render(fullStr)
+			} else {
+				line = CursorNormalStyle.Copy().Width(maxLineWidth).Render(fullStr)
+			}
+		} else {
+			var hlCode string
+			var gutter string
 
-					if isAdd {
-						line = CursorAddStyle.Copy().Width(maxLineWidth).Render(fullStr)
-					} else if isDel {
-						line = CursorDelStyle.Copy().Width(maxLineWidth).Render(fullStr)
-					} else {
-						line = CursorNormalStyle.Copy().Width(maxLineWidth).Render(fullStr)
-					}
+			if isGitTheme {
+				if isAdd {
+					hlCode = lipgloss.NewStyle().Foreground(lipgloss.Color("2")).Render(codeContent)
+					gutter = lipgloss.NewStyle().Foreground(lipgloss.Color("2")).Render(gutterStr)
+				} else if isDel {
+					hlCode = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Render(codeContent)
+					gutter = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Render(gutterStr)
 				} else {
-					var hlCode string
-					var gutter string
-
-					if isGitTheme {
-						if isAdd {
-							hlCode = lipgloss.NewStyle().Foreground(lipgloss.Color("2")).Render(codeContent)
-							gutter = lipgloss.NewStyle().Foreground(lipgloss.Color("2")).Render(gutterStr)
-						} else if isDel {
-							hlCode = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Render(codeContent)
-							gutter = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Render(gutterStr)
-						} else {
-							hlCode = codeContent
-							gutter = DiffCtxGutter.Render(gutterStr)
-						}
-					} else {
-						if i < len(m.diffHighlighted) {
-							hlCode = m.diffHighlighted[i]
-							hlCode = bgAnsiRe.ReplaceAllString(hlCode, "")
-						}
-
-						if isAdd {
-							gutter = DiffAddGutter.Render(gutterStr)
-						} else if isDel {
-							gutter = DiffDelGutter.Render(gutterStr)
-						} else {
-							gutter = DiffCtxGutter.Render(gutterStr)
-						}
-					}
-
-					hlCode = ansi.Truncate(hlCode, maxLineWidth-4, "")
-
-					line = gutter + hlCode
+					hlCode = codeContent
+					gutter = DiffCtxGutter.Render(gutterStr)
+				}
+			} else {
+				if i < len(m.diffHighlighted) {
+					hlCode = m.diffHighlighted[i]
+					hlCode = bgAnsiRe.ReplaceAllString(hlCode, "")
 				}
 
-				renderedDiff.WriteString(lineNumRendered + line + "\n")
+				if isAdd {
+					gutter = DiffAddGutter.Render(gutterStr)
+				} else if isDel {
+					gutter = DiffDelGutter.Render(gutterStr)
+				} else {
+					gutter = DiffCtxGutter.Render(gutterStr)
+				}
 			}
 
-			diffContentStr := "\n" + strings.TrimRight(renderedDiff.String(), "\n")
+			if bg, spans := m.lineEmphasis(i); spans != nil {
+				hlCode = emphasize(hlCode, spans, bg, bgReset)
+			}
+			hlCode = emphasize(hlCode, m.matchSpans(i), SearchMatchOn, SearchMatchOff)
+			hlCode = ansi.Truncate(hlCode, maxLineWidth-4, "")
 
-			rightPaneView = DiffStyle.Copy().
-				Width(m.diffViewport.Width).
-				Height(viewportHeight).
-				Render(diffContentStr)
+			line = gutter + hlCode
 		}
 
-		mainContent = lipgloss.JoinHorizontal(lipgloss.Top, treeView, rightPaneView)
-	}
-
-	var bottomBar string
-	if m.showHelp {
-		bottomBar = m.renderHelpDrawer()
-	} else {
-		bottomBar = m.viewStatusBar()
+		renderedDiff.WriteString(lineNumRendered + line + "\n")
 	}
 
-	return lipgloss.JoinVertical(lipgloss.Top, topBar, mainContent, bottomBar)
+	return strings.TrimRight(renderedDiff.String(), "\n")
 }
 
 func (m Model) renderTopBar() string {
 	vcsType := "git"
-	if m.vcs != nil {
-		if _, isHg := m.vcs.(vcs.HgVCS); isHg {
-			vcsType = "hg"
-		}
+	switch m.vcs.(type) {
+	case vcs.HgVCS:
+		vcsType = "hg"
+	case vcs.JjVCS:
+		vcsType = "jj"
+	}
+	if m.pipedDiff != "" {
+		// Piped diffs are read by their own format, whatever the repository
+		vcsType = diff.Sniff(m.pipedDiff).String()
 	}
 
 	repoStats := ""
@@ -223,7 +247,17 @@ func (m Model) renderTopBar() string {
 		repoStats = fmt.Sprintf(" +%d -%d", m.statsAdded, m.statsDeleted)
 	}
 
-	info := fmt.Sprintf(" %s:%s  %s ➜ %s%s", m.repoName, vcsType, m.currentBranch, m.targetBranch, repoStats)
+	if viewed, total := m.viewedCount(); total > 0 {
+		repoStats += fmt.Sprintf("  %d/%d viewed", viewed, total)
+	}
+
+	head, base := m.currentBranch, m.rng.BaseLabel()
+	if m.inCommit() {
+		head, base = m.commitLabels()
+	} else if !m.rng.WorkingCopy() {
+		head = m.rng.Head
+	}
+	info := fmt.Sprintf(" %s:%s  %s ➜ %s%s", m.repoName, vcsType, head, base, repoStats)
 	leftSide := TopInfoStyle.Render(info)
 
 	rightSide := ""
@@ -284,46 +318,134 @@ func (m Model) renderTopBar() string {
 }
 
 func (m Model) viewStatusBar() string {
-	shortcuts := StatusKeyStyle.Render("? Help  q Quit  Tab Switch  V Visual")
+	if m.searching {
+		prompt := "/"
+		if m.searchBackward {
+			prompt = "?"
+		}
+		scope := "file"
+		if m.searchAll {
+			scope = "all files"
+		}
+		hint := StatusKeyStyle.Render(fmt.Sprintf("  [%s, Tab to toggle]", scope))
+		return StatusBarStyle.Width(m.width).Render(prompt + m.searchInput + "█" + hint)
+	}
+
+	if m.filtering {
+		hint := StatusKeyStyle.Render("  [Enter keep, Esc cancel]")
+		return StatusBarStyle.Width(m.width).Render("filter: " + m.filterQuery + "█" + hint)
+	}
+
+	keys := "? Help  q Quit  Tab Switch  V Visual"
+	if m.focus == FocusDiff {
+		keys = "F1 Help  / Search  q Quit  Tab Switch  V Visual"
+	}
+	shortcuts := StatusKeyStyle.Render(keys)
+	if m.treeState.Filtered() {
+		filter := fmt.Sprintf("filter: %s (%d files)", m.filterQuery, m.filteredCount())
+		shortcuts = lipgloss.JoinHorizontal(lipgloss.Top, shortcuts, StatusMsgStyle.Render(filter))
+	}
+	if status := m.searchStatus(); status != "" {
+		shortcuts = lipgloss.JoinHorizontal(lipgloss.Top, shortcuts, StatusMsgStyle.Render(status))
+	}
+	if status := m.commentStatus(); status != "" && m.statusMsg == "" {
+		shortcuts = lipgloss.JoinHorizontal(lipgloss.Top, shortcuts, CommentStatusStyle.Render(status))
+	}
+	if m.statusMsg != "" {
+		shortcuts = lipgloss.JoinHorizontal(lipgloss.Top, shortcuts, StatusMsgStyle.Render(m.statusMsg))
+	}
 	return StatusBarStyle.Width(m.width).Render(shortcuts)
 }
 
+// helpEntries lists the key bindings shown in the help drawer, column by
+// column.
+var helpEntries = []string{
+	"↑/k   Move Up",
+	"↓/j   Move Down",
+	"←/h   Left Panel",
+	"→/l   Right Panel",
+
+	"C-d/u Page Dn/Up",
+	"zz/zt Scroll View",
+	"H/M/L Move Cursor",
+	"e     Edit File",
+
+	"V     Visual Mode",
+	"esc   Cancel Visual",
+	"s/u   Stage/Unstage",
+	"x/U   Discard/Undo",
+
+	"]c/[c Next/Prev Hunk",
+	"]f/[f Next/Prev File",
+	"/ ?   Search (diff)",
+	"n/N   Next/Prev Match",
+	"?/F1  Toggle Help",
+
+	"C-p   Find File",
+	"/     Filter (tree)",
+	"S     Split View",
+	"#     Line Numbers",
+
+	"c     Commit Mode",
+	"( )   Prev/Next Commit",
+	"R     Reload",
+	"v     Toggle Viewed",
+
+	"]u/[u Next/Prev Unviewed",
+	"a     Comment",
+	"A     Comment in Editor",
+	"o     Sort by Status",
+	"i     Staged/Unstaged",
+	"m     Resolve Conflicts",
+	"zk/zj Expand Up/Down",
+	"zo/zR Open Gap/File",
+	"zM    Hide Context",
+}
+
+// helpGap is the space between the columns of the help drawer.
+const helpGap = 4
+
+// renderHelpDrawer lays the key bindings out in as many columns as fit the
+// width. When the rows they need leave no room for the panes, the last
+// entry shown says how many were left out.
 func (m Model) renderHelpDrawer() string {
-	col1 := lipgloss.JoinVertical(lipgloss.Left,
-		HelpTextStyle.Render("↑/k   Move Up"),
-		HelpTextStyle.Render("↓/j   Move Down"),
-	)
-	col2 := lipgloss.JoinVertical(lipgloss.Left,
-		HelpTextStyle.Render("←/h   Left Panel"),
-		HelpTextStyle.Render("→/l   Right Panel"),
-	)
-	col3 := lipgloss.JoinVertical(lipgloss.Left,
-		HelpTextStyle.Render("C-d/u Page Dn/Up"),
-		HelpTextStyle.Render("zz/zt Scroll View"),
-	)
-	col4 := lipgloss.JoinVertical(lipgloss.Left,
-		HelpTextStyle.Render("H/M/L Move Cursor"),
-		HelpTextStyle.Render("e     Edit File"),
-	)
-	col5 := lipgloss.JoinVertical(lipgloss.Left,
-		HelpTextStyle.Render("V     Visual Mode"),
-		HelpTextStyle.Render("esc   Cancel Visual"),
-	)
+	entryWidth := 0
+	for _, entry := range helpEntries {
+		entryWidth = max(entryWidth, lipgloss.Width(HelpTextStyle.Render(entry)))
+	}
+	inner := m.width - HelpDrawerStyle.GetHorizontalFrameSize()
+	columns := max((inner+helpGap)/(entryWidth+helpGap), 1)
+	rows := (len(helpEntries) + columns - 1) / columns
+
+	entries := helpEntries
+	frame := HelpDrawerStyle.GetVerticalFrameSize()
+	if maxRows := max(m.height-frame-4, 1); rows > maxRows {
+		rows = maxRows
+		if shown := rows * columns; shown < len(entries) {
+			entries = append(entries[:shown-1:shown-1], fmt.Sprintf("…     %d more", len(entries)-shown+1))
+		}
+	}
+
+	var cols []string
+	for i := 0; i < len(entries); i += rows {
+		var lines []string
+		for _, entry := range entries[i:min(i+rows, len(entries))] {
+			lines = append(lines, HelpTextStyle.Render(entry))
+		}
+		if len(cols) > 0 {
+			cols = append(cols, lipgloss.NewStyle().Width(helpGap).Render(""))
+		}
+		cols = append(cols, lipgloss.JoinVertical(lipgloss.Left, lines...))
+	}
 
 	return HelpDrawerStyle.Copy().
 		Width(m.width).
-		Render(lipgloss.JoinHorizontal(lipgloss.Top,
-			col1, lipgloss.NewStyle().Width(4).Render(""),
-			col2, lipgloss.NewStyle().Width(4).Render(""),
-			col3, lipgloss.NewStyle().Width(4).Render(""),
-			col4, lipgloss.NewStyle().Width(4).Render(""),
-			col5,
-		))
+		Render(lipgloss.JoinHorizontal(lipgloss.Top, cols...))
 }
 
 func (m Model) renderEmptyState(w, h int, statusMsg string) string {
 	logo := EmptyLogoStyle.Render("difi")
-	desc := EmptyDescStyle.Render("A calm, focused way to review Git & Mercurial diffs.")
+	desc := EmptyDescStyle.Render("A calm, focused way to review Git, Mercurial & Jujutsu diffs.")
 	status := EmptyStatusStyle.Render(statusMsg)
 
 	usageHeader := EmptyHeaderStyle.Render("Usage Patterns")
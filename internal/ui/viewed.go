@@ -0,0 +1,141 @@
+package ui
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/oug-t/difi/internal/review"
+	"github.com/oug-t/difi/internal/tree"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// HashesMsg carries the hash of each changed file's diff in Range, which
+// viewed state is keyed by.
+type HashesMsg struct {
+	Range  vcs.Range
+	Hashes map[string]string
+}
+
+// fetchHashesCmd hashes the diff of every changed file.
+func (m Model) fetchHashesCmd() tea.Cmd {
+	rng := m.rng
+	if m.pipedDiff != "" {
+		text := m.pipedDiff
+		return func() tea.Msg {
+			return HashesMsg{Range: rng, Hashes: review.FileHashes(text)}
+		}
+	}
+	files := m.changedPaths()
+	return func() tea.Msg {
+		hashes, err := review.DiffHashes(m.vcs, rng, files)
+		if err != nil {
+			return nil
+		}
+		return HashesMsg{Range: rng, Hashes: hashes}
+	}
+}
+
+// hash returns the diff hash of path, or "" while the hashes of the
+// current range are loading.
+func (m Model) hash(path string) string {
+	if m.hashesRng != m.rng {
+		return ""
+	}
+	return m.diffHashes[path]
+}
+
+func (m Model) isViewed(path string) bool {
+	return m.viewed.IsViewed(path, m.hash(path))
+}
+
+// syncViewed passes the viewed files on to the tree.
+func (m *Model) syncViewed() {
+	viewed := make(map[string]bool)
+	for _, f := range m.changedPaths() {
+		if m.isViewed(f) {
+			viewed[f] = true
+		}
+	}
+	m.treeDelegate.Viewed = viewed
+	m.fileList.SetDelegate(m.treeDelegate)
+}
+
+// viewedCount returns how many of the changed files are viewed.
+func (m Model) viewedCount() (viewed, total int) {
+	for _, f := range m.changedPaths() {
+		if m.isViewed(f) {
+			viewed++
+		}
+		total++
+	}
+	return viewed, total
+}
+
+// toggleViewed marks the selected file as viewed, or as not viewed again.
+func (m *Model) toggleViewed() {
+	if item, ok := m.fileList.SelectedItem().(tree.TreeItem); ok && item.IsDir && m.focus == FocusTree {
+		m.statusMsg = "Select a file to mark it as viewed"
+		return
+	}
+	path := m.selectedPath
+	hash := m.hash(path)
+	if hash == "" {
+		m.statusMsg = "The diff of " + path + " is still loading"
+		return
+	}
+
+	viewed := !m.isViewed(path)
+	err := m.viewed.Set(path, hash, viewed)
+	m.syncViewed()
+	switch {
+	case err != nil:
+		m.statusMsg = "Could not save viewed files: " + err.Error()
+	case viewed:
+		m.statusMsg = fmt.Sprintf("Marked %s as viewed", path)
+	default:
+		m.statusMsg = fmt.Sprintf("Marked %s as not viewed", path)
+	}
+}
+
+// moveUnviewed selects the count-th next file not yet viewed, or the
+// previous one when dir is negative, wrapping around the ends of the tree.
+func (m *Model) moveUnviewed(dir, count int) tea.Cmd {
+	files := m.treeState.MatchingFiles()
+	n := len(files)
+	cur, selected := -1, m.treeKey(m.selectedPath)
+	for i, f := range files {
+		if f == selected {
+			cur = i
+			break
+		}
+	}
+	if cur < 0 && dir < 0 {
+		cur = n
+	}
+
+	target, wrapped := -1, false
+	for step := 1; step <= n && count > 0; step++ {
+		i := cur + dir*step
+		if i < 0 || i >= n {
+			wrapped = true
+		}
+		i = (i%n + n) % n
+		if !m.isViewed(m.pathOf(files[i])) {
+			target = i
+			count--
+		}
+	}
+
+	switch {
+	case target < 0:
+		m.statusMsg = "All files viewed"
+		return nil
+	case files[target] == selected:
+		m.statusMsg = "No other unviewed file"
+		return nil
+	case wrapped:
+		m.statusMsg = "Wrapped around the file list"
+	}
+	return m.selectFile(files[target])
+}
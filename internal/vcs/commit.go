@@ -0,0 +1,54 @@
+package vcs
+
+import "strings"
+
+// Commit is one revision of a range reviewed commit by commit.
+type Commit struct {
+	ID      string
+	Short   string
+	Parent  string // first parent, or the backend's empty revision for a root
+	Author  string
+	Date    string
+	Message string
+}
+
+// Subject returns the first line of the commit message.
+func (c Commit) Subject() string {
+	subject, _, _ := strings.Cut(c.Message, "\n")
+	return subject
+}
+
+// Range returns the range holding only the changes of c.
+func (c Commit) Range() Range {
+	return Range{Base: c.Parent, Head: c.ID}
+}
+
+// commitFields is the number of NUL-terminated fields a backend's log
+// writes per commit.
+const commitFields = 6
+
+// parseCommits reads the NUL-separated log of a backend. root names the
+// revision to diff a parentless commit against.
+func parseCommits(out string, err error, root string) ([]Commit, error) {
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(out, "\x00")
+	var commits []Commit
+	for i := 0; i+commitFields <= len(fields); i += commitFields {
+		f := fields[i : i+commitFields]
+		parent, _, _ := strings.Cut(strings.TrimSpace(f[2]), " ")
+		if parent == "" || strings.Trim(parent, "0") == "" {
+			parent = root
+		}
+		commits = append(commits, Commit{
+			ID:      strings.TrimSpace(f[0]),
+			Short:   strings.TrimSpace(f[1]),
+			Parent:  parent,
+			Author:  f[3],
+			Date:    f[4],
+			Message: strings.TrimSpace(f[5]),
+		})
+	}
+	return commits, nil
+}
@@ -0,0 +1,63 @@
+package vcs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseCommits(t *testing.T) {
+	out := "aaaa1111\x00aaaa\x00\x00Ann\x002026-01-02\x00Initial import\n\x00\n" +
+		"bbbb2222\x00bbbb\x00aaaa1111 cccc3333\x00Bob\x002026-01-03\x00Merge topic\n\nDetails here.\n\x00\n"
+
+	commits, err := parseCommits(out, nil, "ROOT")
+	if err != nil {
+		t.Fatalf("parseCommits() error = %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("parseCommits() returned %d commits, want 2", len(commits))
+	}
+
+	first := commits[0]
+	if first.ID != "aaaa1111" || first.Short != "aaaa" || first.Author != "Ann" || first.Date != "2026-01-02" {
+		t.Errorf("first commit = %+v", first)
+	}
+	if first.Parent != "ROOT" {
+		t.Errorf("root commit parent = %q, want ROOT", first.Parent)
+	}
+
+	second := commits[1]
+	if second.ID != "bbbb2222" {
+		t.Errorf("second commit ID = %q, want bbbb2222", second.ID)
+	}
+	if second.Parent != "aaaa1111" {
+		t.Errorf("merge commit parent = %q, want first parent aaaa1111", second.Parent)
+	}
+	if second.Subject() != "Merge topic" {
+		t.Errorf("Subject() = %q, want %q", second.Subject(), "Merge topic")
+	}
+	if second.Message != "Merge topic\n\nDetails here." {
+		t.Errorf("Message = %q", second.Message)
+	}
+	if r := second.Range(); r.Base != "aaaa1111" || r.Head != "bbbb2222" {
+		t.Errorf("Range() = %+v", r)
+	}
+}
+
+func TestParseCommitsNullParent(t *testing.T) {
+	// hg reports the parent of a root changeset as the null node.
+	out := "1234\x001234\x000000000000\x00Ann\x002026-01-02\x00root\x00"
+	commits, err := parseCommits(out, nil, "null")
+	if err != nil || len(commits) != 1 {
+		t.Fatalf("parseCommits() = %v, %v", commits, err)
+	}
+	if commits[0].Parent != "null" {
+		t.Errorf("Parent = %q, want null", commits[0].Parent)
+	}
+}
+
+func TestParseCommitsError(t *testing.T) {
+	want := errors.New("boom")
+	if _, err := parseCommits("", want, ""); err != want {
+		t.Errorf("parseCommits() error = %v, want %v", err, want)
+	}
+}
@@ -5,20 +5,25 @@ import (
 	"path/filepath"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oug-t/difi/internal/diff"
 	"github.com/oug-t/difi/internal/git"
 	"github.com/oug-t/difi/internal/hg"
+	"github.com/oug-t/difi/internal/jj"
 )
 
 type GitVCS struct{}
 type HgVCS struct{}
+type JjVCS struct{}
 
 func (g GitVCS) GetCurrentBranch() string { return git.GetCurrentBranch() }
 func (g GitVCS) GetRepoName() string      { return git.GetRepoName() }
-func (g GitVCS) ListChangedFiles(targetBranch string) ([]string, error) {
-	return git.ListChangedFiles(targetBranch)
+func (g GitVCS) GetRepoRoot() string      { return git.GetRepoRoot() }
+func (g GitVCS) GetStateDir() string      { return git.GetStateDir() }
+func (g GitVCS) ListChangedFiles(r Range) ([]string, error) {
+	return git.ListChangedFiles(r.Base, r.Head)
 }
-func (g GitVCS) DiffCmd(targetBranch, path string) tea.Cmd {
-	gitCmd := git.DiffCmd(targetBranch, path)
+func (g GitVCS) DiffCmd(r Range, path, from string, context int) tea.Cmd {
+	gitCmd := git.DiffCmd(r.Base, r.Head, path, from, context)
 	return func() tea.Msg {
 		msg := gitCmd()
 		if gitMsg, ok := msg.(git.DiffMsg); ok {
@@ -27,8 +32,9 @@ func (g GitVCS) DiffCmd(targetBranch, path string) tea.Cmd {
 		return msg
 	}
 }
-func (g GitVCS) OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
-	gitCmd := git.OpenEditorCmd(path, lineNumber, targetBranch, editor)
+func (g GitVCS) Diff(r Range) (string, error) { return git.Diff(r.Base, r.Head) }
+func (g GitVCS) OpenEditorCmd(path string, lineNumber int, r Range, editor string) tea.Cmd {
+	gitCmd := git.OpenEditorCmd(path, lineNumber, r.Base, r.Head, editor)
 	return func() tea.Msg {
 		msg := gitCmd()
 		if gitMsg, ok := msg.(git.EditorFinishedMsg); ok {
@@ -37,27 +43,47 @@ func (g GitVCS) OpenEditorCmd(path string, lineNumber int, targetBranch string,
 		return msg
 	}
 }
-func (g GitVCS) DiffStats(targetBranch string) (added int, deleted int, err error) {
-	return git.DiffStats(targetBranch)
+func (g GitVCS) DiffStats(r Range) (added int, deleted int, err error) {
+	return git.DiffStats(r.Base, r.Head)
 }
-func (g GitVCS) DiffStatsByFile(targetBranch string) (map[string][2]int, error) {
-	return git.DiffStatsByFile(targetBranch)
+func (g GitVCS) DiffStatsByFile(r Range) (map[string][2]int, error) {
+	return git.DiffStatsByFile(r.Base, r.Head)
 }
-func (g GitVCS) CalculateFileLine(diffContent string, visualLineIndex int) int {
-	return git.CalculateFileLine(diffContent, visualLineIndex)
+func (g GitVCS) Stage(path string, sel []diff.Line) error { return git.Stage(path, sel) }
+func (g GitVCS) Unstage(path string, sel []diff.Line) error {
+	return git.Unstage(path, sel)
 }
-func (g GitVCS) ParseFilesFromDiff(diffText string) []string { return git.ParseFilesFromDiff(diffText) }
-func (g GitVCS) ExtractFileDiff(diffText, targetPath string) string {
-	return git.ExtractFileDiff(diffText, targetPath)
+func (g GitVCS) ApplyPatch(patch string, reverse bool) error {
+	return git.ApplyPatch(patch, reverse)
+}
+func (g GitVCS) ShowFile(revision, path string) ([]byte, error) {
+	return git.ShowFile(revision, path)
+}
+func (g GitVCS) StageStates() (map[string]StageState, error) {
+	return stageStates(git.StageStates())
+}
+func (g GitVCS) FileStatuses(r Range) (map[string]FileStatus, error) {
+	return fileStatuses(git.FileStatuses(r.Base, r.Head))
+}
+func (g GitVCS) IgnoredDirs(dirs []string) (map[string]bool, error) {
+	return git.IgnoredDirs(dirs)
+}
+func (g GitVCS) MarkResolved(path string) error        { return git.MarkResolved(path) }
+func (g GitVCS) MergeBase(a, b string) (string, error) { return git.MergeBase(a, b) }
+func (g GitVCS) Commits(r Range) ([]Commit, error) {
+	out, err := git.Log(r.Base, r.Head)
+	return parseCommits(out, err, git.EmptyTree)
 }
 
 func (h HgVCS) GetCurrentBranch() string { return hg.GetCurrentBranch() }
 func (h HgVCS) GetRepoName() string      { return hg.GetRepoName() }
-func (h HgVCS) ListChangedFiles(targetBranch string) ([]string, error) {
-	return hg.ListChangedFiles(targetBranch)
+func (h HgVCS) GetRepoRoot() string      { return hg.GetRepoRoot() }
+func (h HgVCS) GetStateDir() string      { return hg.GetStateDir() }
+func (h HgVCS) ListChangedFiles(r Range) ([]string, error) {
+	return hg.ListChangedFiles(r.Base, r.Head)
 }
-func (h HgVCS) DiffCmd(targetBranch, path string) tea.Cmd {
-	hgCmd := hg.DiffCmd(targetBranch, path)
+func (h HgVCS) DiffCmd(r Range, path, from string, context int) tea.Cmd {
+	hgCmd := hg.DiffCmd(r.Base, r.Head, path, from, context)
 	return func() tea.Msg {
 		msg := hgCmd()
 		if hgMsg, ok := msg.(hg.DiffMsg); ok {
@@ -66,8 +92,9 @@ func (h HgVCS) DiffCmd(targetBranch, path string) tea.Cmd {
 		return msg
 	}
 }
-func (h HgVCS) OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
-	hgCmd := hg.OpenEditorCmd(path, lineNumber, targetBranch, editor)
+func (h HgVCS) Diff(r Range) (string, error) { return hg.Diff(r.Base, r.Head) }
+func (h HgVCS) OpenEditorCmd(path string, lineNumber int, r Range, editor string) tea.Cmd {
+	hgCmd := hg.OpenEditorCmd(path, lineNumber, r.Base, r.Head, editor)
 	return func() tea.Msg {
 		msg := hgCmd()
 		if hgMsg, ok := msg.(hg.EditorFinishedMsg); ok {
@@ -76,49 +103,157 @@ func (h HgVCS) OpenEditorCmd(path string, lineNumber int, targetBranch string, e
 		return msg
 	}
 }
-func (h HgVCS) DiffStats(targetBranch string) (added int, deleted int, err error) {
-	return hg.DiffStats(targetBranch)
+func (h HgVCS) DiffStats(r Range) (added int, deleted int, err error) {
+	return hg.DiffStats(r.Base, r.Head)
+}
+func (h HgVCS) DiffStatsByFile(r Range) (map[string][2]int, error) {
+	return hg.DiffStatsByFile(r.Base, r.Head)
+}
+func (h HgVCS) Stage(path string, sel []diff.Line) error { return hg.Stage(path, sel) }
+func (h HgVCS) Unstage(path string, sel []diff.Line) error {
+	return hg.Unstage(path, sel)
 }
-func (h HgVCS) DiffStatsByFile(targetBranch string) (map[string][2]int, error) {
-	return hg.DiffStatsByFile(targetBranch)
+func (h HgVCS) ApplyPatch(patch string, reverse bool) error {
+	return hg.ApplyPatch(patch, reverse)
 }
-func (h HgVCS) CalculateFileLine(diffContent string, visualLineIndex int) int {
-	return hg.CalculateFileLine(diffContent, visualLineIndex)
+func (h HgVCS) ShowFile(revision, path string) ([]byte, error) {
+	return hg.ShowFile(revision, path)
 }
-func (h HgVCS) ParseFilesFromDiff(diffText string) []string { return hg.ParseFilesFromDiff(diffText) }
-func (h HgVCS) ExtractFileDiff(diffText, targetPath string) string {
-	return hg.ExtractFileDiff(diffText, targetPath)
+func (h HgVCS) StageStates() (map[string]StageState, error) {
+	return stageStates(hg.StageStates())
+}
+func (h HgVCS) FileStatuses(r Range) (map[string]FileStatus, error) {
+	return fileStatuses(hg.FileStatuses(r.Base, r.Head))
+}
+func (h HgVCS) IgnoredDirs(dirs []string) (map[string]bool, error) {
+	return hg.IgnoredDirs(dirs)
+}
+func (h HgVCS) MarkResolved(path string) error        { return hg.MarkResolved(path) }
+func (h HgVCS) MergeBase(a, b string) (string, error) { return hg.MergeBase(a, b) }
+func (h HgVCS) Commits(r Range) ([]Commit, error) {
+	out, err := hg.Log(r.Base, r.Head)
+	return parseCommits(out, err, "null")
 }
 
+func (j JjVCS) GetCurrentBranch() string { return jj.GetCurrentBranch() }
+func (j JjVCS) GetRepoName() string      { return jj.GetRepoName() }
+func (j JjVCS) GetRepoRoot() string      { return jj.GetRepoRoot() }
+func (j JjVCS) GetStateDir() string      { return jj.GetStateDir() }
+func (j JjVCS) ListChangedFiles(r Range) ([]string, error) {
+	return jj.ListChangedFiles(r.Base, r.Head)
+}
+func (j JjVCS) DiffCmd(r Range, path, from string, context int) tea.Cmd {
+	jjCmd := jj.DiffCmd(r.Base, r.Head, path, from, context)
+	return func() tea.Msg {
+		msg := jjCmd()
+		if jjMsg, ok := msg.(jj.DiffMsg); ok {
+			return DiffMsg{Content: jjMsg.Content}
+		}
+		return msg
+	}
+}
+func (j JjVCS) Diff(r Range) (string, error) { return jj.Diff(r.Base, r.Head) }
+func (j JjVCS) OpenEditorCmd(path string, lineNumber int, r Range, editor string) tea.Cmd {
+	jjCmd := jj.OpenEditorCmd(path, lineNumber, r.Base, r.Head, editor)
+	return func() tea.Msg {
+		msg := jjCmd()
+		if jjMsg, ok := msg.(jj.EditorFinishedMsg); ok {
+			return EditorFinishedMsg{Err: jjMsg.Err}
+		}
+		return msg
+	}
+}
+func (j JjVCS) DiffStats(r Range) (added int, deleted int, err error) {
+	return jj.DiffStats(r.Base, r.Head)
+}
+func (j JjVCS) DiffStatsByFile(r Range) (map[string][2]int, error) {
+	return jj.DiffStatsByFile(r.Base, r.Head)
+}
+func (j JjVCS) Stage(path string, sel []diff.Line) error { return jj.Stage(path, sel) }
+func (j JjVCS) Unstage(path string, sel []diff.Line) error {
+	return jj.Unstage(path, sel)
+}
+func (j JjVCS) ApplyPatch(patch string, reverse bool) error {
+	return jj.ApplyPatch(patch, reverse)
+}
+func (j JjVCS) ShowFile(revision, path string) ([]byte, error) {
+	return jj.ShowFile(revision, path)
+}
+func (j JjVCS) StageStates() (map[string]StageState, error) { return nil, nil }
+func (j JjVCS) FileStatuses(r Range) (map[string]FileStatus, error) {
+	return fileStatuses(jj.FileStatuses(r.Base, r.Head))
+}
+func (j JjVCS) IgnoredDirs(dirs []string) (map[string]bool, error) {
+	return jj.IgnoredDirs(dirs)
+}
+func (j JjVCS) MarkResolved(path string) error        { return jj.MarkResolved(path) }
+func (j JjVCS) MergeBase(a, b string) (string, error) { return jj.MergeBase(a, b) }
+func (j JjVCS) Commits(r Range) ([]Commit, error) {
+	out, err := jj.Log(r.Base, r.Head)
+	return parseCommits(out, err, "root()")
+}
+
+// fileStatuses converts a backend's status letters.
+func fileStatuses(letters map[string]byte, err error) (map[string]FileStatus, error) {
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[string]FileStatus, len(letters))
+	for path, c := range letters {
+		statuses[path] = FileStatus(c)
+	}
+	return statuses, nil
+}
+
+// stageStates merges per-path staged/unstaged sets into a StageState map.
+func stageStates(staged, unstaged map[string]bool, err error) (map[string]StageState, error) {
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]StageState)
+	for path := range unstaged {
+		states[path] = Unstaged
+	}
+	for path := range staged {
+		if unstaged[path] {
+			states[path] = PartiallyStaged
+		} else {
+			states[path] = Staged
+		}
+	}
+	return states, nil
+}
+
+// DetectVCS walks up from the working directory looking for a repository.
+// Jujutsu wins over a colocated .git, and Git wins over Mercurial.
 func DetectVCS() VCS {
 	dir, err := os.Getwd()
 	if err != nil {
 		return GitVCS{}
 	}
 
-	checkDir := dir
-	for {
-		if _, err := os.Stat(filepath.Join(checkDir, ".git")); err == nil {
-			return GitVCS{}
-		}
-		parent := filepath.Dir(checkDir)
-		if parent == checkDir {
-			break
-		}
-		checkDir = parent
+	switch {
+	case findUp(dir, ".jj"):
+		return JjVCS{}
+	case findUp(dir, ".git"):
+		return GitVCS{}
+	case findUp(dir, ".hg"):
+		return HgVCS{}
 	}
 
-	checkDir = dir
+	return GitVCS{}
+}
+
+// findUp reports whether name exists in dir or any of its parents.
+func findUp(dir, name string) bool {
 	for {
-		if _, err := os.Stat(filepath.Join(checkDir, ".hg")); err == nil {
-			return HgVCS{}
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
 		}
-		parent := filepath.Dir(checkDir)
-		if parent == checkDir {
-			break
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
 		}
-		checkDir = parent
+		dir = parent
 	}
-
-	return GitVCS{}
 }
@@ -0,0 +1,141 @@
+package vcs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/oug-t/difi/internal/git"
+)
+
+const devNull = "/dev/null"
+
+// Difftool diffs the paths git difftool hands its tool: local and remote
+// versions of the file merged, or with --dir-diff two directories holding
+// the changed files. The diff is labelled with repository paths rather
+// than git's temporary files.
+func Difftool(local, remote, merged string) (string, error) {
+	if isDir(local) && isDir(remote) {
+		return diffDirs(local, remote)
+	}
+	if merged == "" {
+		merged = remote
+		if merged == devNull {
+			merged = local
+		}
+	}
+	return diffFiles(local, remote, filepath.ToSlash(merged))
+}
+
+// diffDirs diffs every file of the two directories, which git fills with
+// copies of the old version and, for the working tree, symlinks to it.
+func diffDirs(left, right string) (string, error) {
+	seen := make(map[string]bool)
+	for _, dir := range []string{left, right} {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if rel, err := filepath.Rel(dir, path); err == nil {
+				seen[filepath.ToSlash(rel)] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		text, err := diffFiles(side(left, name), side(right, name), name)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(text)
+	}
+	return b.String(), nil
+}
+
+// side returns name in dir, or /dev/null when it is missing there.
+func side(dir, name string) string {
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if _, err := os.Lstat(path); err != nil {
+		return devNull
+	}
+	return path
+}
+
+// diffFiles diffs two files, following symlinks so that linked working
+// tree files are compared by content, and labels both sides as name.
+func diffFiles(a, b, name string) (string, error) {
+	a, b = resolve(a), resolve(b)
+	if isDir(a) || isDir(b) {
+		return "", nil
+	}
+	text, err := git.DiffNoIndex(a, b)
+	if err != nil || text == "" {
+		return text, err
+	}
+	return relabel(text, name), nil
+}
+
+func resolve(path string) string {
+	if path == devNull {
+		return path
+	}
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		return p
+	}
+	return path
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// relabel rewrites the header of a single-file diff to name both sides
+// name, dropping the rename git reports between two differently named
+// files.
+func relabel(text, name string) string {
+	header, body := text, ""
+	if i := strings.Index(text, "\n@@"); i >= 0 {
+		header, body = text[:i+1], text[i+1:]
+	}
+
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(header, "\n") {
+		content := strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "diff --git "):
+			content = "diff --git a/" + name + " b/" + name
+		case strings.HasPrefix(line, "--- ") && content != "--- "+devNull:
+			content = "--- a/" + name
+		case strings.HasPrefix(line, "+++ ") && content != "+++ "+devNull:
+			content = "+++ b/" + name
+		case strings.HasPrefix(line, "Binary files "):
+			old, new := "a/"+name, "b/"+name
+			if strings.HasPrefix(content, "Binary files "+devNull+" ") {
+				old = devNull
+			}
+			if strings.HasSuffix(content, " "+devNull+" differ") {
+				new = devNull
+			}
+			content = "Binary files " + old + " and " + new + " differ"
+		case strings.HasPrefix(line, "rename "), strings.HasPrefix(line, "similarity index "):
+			continue
+		}
+		b.WriteString(content + "\n")
+	}
+	return b.String() + body
+}
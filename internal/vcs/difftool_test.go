@@ -0,0 +1,98 @@
+package vcs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRelabel(t *testing.T) {
+	in := `diff --git a/tmp/x/git-blob-1_f.go b/src/f.go
+similarity index 50%
+rename from tmp/x/git-blob-1_f.go
+rename to src/f.go
+index 422c2b7..0f7bc76 100644
+--- a/tmp/x/git-blob-1_f.go
++++ b/src/f.go
+@@ -1,2 +1,2 @@
+ a
+--- a/not/a/header
++c
+`
+	want := `diff --git a/src/f.go b/src/f.go
+index 422c2b7..0f7bc76 100644
+--- a/src/f.go
++++ b/src/f.go
+@@ -1,2 +1,2 @@
+ a
+--- a/not/a/header
++c
+`
+	if got := relabel(in, "src/f.go"); got != want {
+		t.Errorf("relabel() =\n%s\nwant\n%s", got, want)
+	}
+
+	binary := "diff --git a/tmp/new.png b/tmp/new.png\nnew file mode 100644\nBinary files /dev/null and b/tmp/new.png differ\n"
+	if got := relabel(binary, "img/new.png"); !strings.Contains(got, "Binary files /dev/null and b/img/new.png differ") {
+		t.Errorf("relabel() of a binary diff = %q", got)
+	}
+}
+
+func TestDifftool(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp := t.TempDir()
+	left, right := filepath.Join(tmp, "left"), filepath.Join(tmp, "right")
+	writeFile(t, filepath.Join(left, "src", "f.go"), "a\nb\n")
+	writeFile(t, filepath.Join(left, "gone.txt"), "x\n")
+	writeFile(t, filepath.Join(left, "same.txt"), "same\n")
+	writeFile(t, filepath.Join(right, "same.txt"), "same\n")
+	writeFile(t, filepath.Join(right, "new.txt"), "y\n")
+	// git links working tree files into the right directory
+	worktree := filepath.Join(tmp, "worktree.go")
+	writeFile(t, worktree, "a\nc\n")
+	if err := os.MkdirAll(filepath.Join(right, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(worktree, filepath.Join(right, "src", "f.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := Difftool(left, right, "")
+	if err != nil {
+		t.Fatalf("Difftool() error = %v", err)
+	}
+	files := diff.Parse(text)
+	if got := strings.Join(diff.Paths(files), " "); got != "gone.txt new.txt src/f.go" {
+		t.Fatalf("paths = %q, want gone.txt new.txt src/f.go\n%s", got, text)
+	}
+	if !diff.Find(files, "gone.txt").DeletedFile || !diff.Find(files, "new.txt").NewFile {
+		t.Error("added and deleted files are not marked as such")
+	}
+	if added, deleted := diff.Find(files, "src/f.go").Stats(); added != 1 || deleted != 1 {
+		t.Errorf("src/f.go stats = +%d -%d, want the symlinked content compared", added, deleted)
+	}
+
+	text, err = Difftool(filepath.Join(left, "src", "f.go"), worktree, "src/f.go")
+	if err != nil {
+		t.Fatalf("Difftool() error = %v", err)
+	}
+	if got := strings.Join(diff.Paths(diff.Parse(text)), " "); got != "src/f.go" {
+		t.Errorf("paths of a file pair = %q, want src/f.go", got)
+	}
+}
@@ -0,0 +1,40 @@
+package vcs
+
+import (
+	"fmt"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// Interdiff compares two versions of a branch, such as its tips before and
+// after a force-push, and returns the diff of their diffs as described by
+// diff.Interdiff. Each version is diffed from its merge base with base, or
+// from the merge base of both versions when base is empty.
+func Interdiff(client VCS, old, new, base string) (string, error) {
+	oldBase, newBase := base, base
+	if base == "" {
+		mb, err := client.MergeBase(old, new)
+		if err != nil {
+			return "", fmt.Errorf("no merge base for %s and %s: %w", old, new, err)
+		}
+		oldBase, newBase = mb, mb
+	} else {
+		var err error
+		if oldBase, err = client.MergeBase(base, old); err != nil {
+			return "", fmt.Errorf("no merge base for %s and %s: %w", base, old, err)
+		}
+		if newBase, err = client.MergeBase(base, new); err != nil {
+			return "", fmt.Errorf("no merge base for %s and %s: %w", base, new, err)
+		}
+	}
+
+	oldDiff, err := client.Diff(Range{Base: oldBase, Head: old})
+	if err != nil {
+		return "", err
+	}
+	newDiff, err := client.Diff(Range{Base: newBase, Head: new})
+	if err != nil {
+		return "", err
+	}
+	return diff.Interdiff(diff.Parse(oldDiff), diff.Parse(newDiff)), nil
+}
@@ -1,18 +1,76 @@
 package vcs
 
-import tea "github.com/charmbracelet/bubbletea"
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oug-t/difi/internal/diff"
+)
 
 type VCS interface {
 	GetCurrentBranch() string
 	GetRepoName() string
-	ListChangedFiles(targetBranch string) ([]string, error)
-	DiffCmd(targetBranch, path string) tea.Cmd
-	OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd
-	DiffStats(targetBranch string) (added int, deleted int, err error)
-	DiffStatsByFile(targetBranch string) (map[string][2]int, error)
-	CalculateFileLine(diffContent string, visualLineIndex int) int
-	ParseFilesFromDiff(diffText string) []string
-	ExtractFileDiff(diffText, targetPath string) string
+	GetRepoRoot() string
+	GetStateDir() string
+	ListChangedFiles(r Range) ([]string, error)
+	DiffCmd(r Range, path, from string, context int) tea.Cmd
+	Diff(r Range) (string, error)
+	OpenEditorCmd(path string, lineNumber int, r Range, editor string) tea.Cmd
+	DiffStats(r Range) (added int, deleted int, err error)
+	DiffStatsByFile(r Range) (map[string][2]int, error)
+	Renames(r Range) (map[string]Rename, error)
+	Stage(path string, sel []diff.Line) error
+	Unstage(path string, sel []diff.Line) error
+	StageStates() (map[string]StageState, error)
+	ApplyPatch(patch string, reverse bool) error
+	ShowFile(revision, path string) ([]byte, error)
+	FileStatuses(r Range) (map[string]FileStatus, error)
+	SectionStatuses() (map[Section]map[string]FileStatus, error)
+	SectionDiffCmd(s Section, path string, context int) tea.Cmd
+	SectionFile(s Section, path string) ([]byte, error)
+	MarkResolved(path string) error
+	IgnoredDirs(dirs []string) (map[string]bool, error)
+	MergeBase(a, b string) (string, error)
+	Commits(r Range) ([]Commit, error)
+}
+
+// DefaultContext is the number of unchanged lines git, hg and jj show
+// around each change unless told otherwise.
+const DefaultContext = 3
+
+// StageState tells how much of a file's change is staged for the next commit.
+type StageState int
+
+const (
+	Unstaged StageState = iota
+	PartiallyStaged
+	Staged
+)
+
+// FileStatus tells how a file changed, using the letters of git status.
+type FileStatus byte
+
+const (
+	StatusModified   FileStatus = 'M'
+	StatusAdded      FileStatus = 'A'
+	StatusDeleted    FileStatus = 'D'
+	StatusUntracked  FileStatus = '?'
+	StatusConflicted FileStatus = 'U'
+)
+
+// FileStatusesFromDiff derives file statuses from a unified diff, for input
+// that did not come from a backend.
+func FileStatusesFromDiff(diffText string) map[string]FileStatus {
+	statuses := make(map[string]FileStatus)
+	for _, f := range diff.Parse(diffText) {
+		switch {
+		case f.NewFile:
+			statuses[f.Path()] = StatusAdded
+		case f.DeletedFile:
+			statuses[f.Path()] = StatusDeleted
+		default:
+			statuses[f.Path()] = StatusModified
+		}
+	}
+	return statuses
 }
 
 type DiffMsg struct{ Content string }
@@ -14,6 +14,7 @@ func TestVCSInterfaceConsistency(t *testing.T) {
 	}{
 		{"Git", GitVCS{}},
 		{"Mercurial", HgVCS{}},
+		{"Jujutsu", JjVCS{}},
 	}
 
 	for _, impl := range implementations {
@@ -57,7 +58,7 @@ func TestVCSInterfaceConsistency(t *testing.T) {
 				// Test with common branch names
 				testBranches := []string{"main", "master", "default", "HEAD"}
 				for _, branch := range testBranches {
-					files, err := vcs.ListChangedFiles(branch)
+					files, err := vcs.ListChangedFiles(Range{Base: branch})
 					// Error is expected if not in a repo, but shouldn't panic
 					_ = files
 					_ = err
@@ -70,7 +71,7 @@ func TestVCSInterfaceConsistency(t *testing.T) {
 						t.Errorf("%s DiffStats() panicked: %v", impl.name, r)
 					}
 				}()
-				added, deleted, err := vcs.DiffStats("main")
+				added, deleted, err := vcs.DiffStats(Range{Base: "main"})
 				// Error is expected if not in a repo, but shouldn't panic
 				_ = added
 				_ = deleted
@@ -83,52 +84,10 @@ func TestVCSInterfaceConsistency(t *testing.T) {
 						t.Errorf("%s DiffStatsByFile() panicked: %v", impl.name, r)
 					}
 				}()
-				byFile, err := vcs.DiffStatsByFile("main")
+				byFile, err := vcs.DiffStatsByFile(Range{Base: "main"})
 				_ = byFile
 				_ = err
 			})
-
-			// Test utility functions with known inputs
-			t.Run("ParseFilesFromDiff", func(t *testing.T) {
-				// Test with empty input
-				files := vcs.ParseFilesFromDiff("")
-				if len(files) != 0 {
-					t.Errorf("%s ParseFilesFromDiff('') should return empty slice, got %d files", impl.name, len(files))
-				}
-
-				// Test with invalid input
-				files = vcs.ParseFilesFromDiff("not a diff")
-				if len(files) != 0 {
-					t.Errorf("%s ParseFilesFromDiff('not a diff') should return empty slice, got %d files", impl.name, len(files))
-				}
-			})
-
-			t.Run("ExtractFileDiff", func(t *testing.T) {
-				// Test with empty inputs
-				result := vcs.ExtractFileDiff("", "file.txt")
-				if result != "" {
-					t.Errorf("%s ExtractFileDiff('', 'file.txt') should return empty string, got %q", impl.name, result)
-				}
-
-				result = vcs.ExtractFileDiff("some diff", "")
-				if result != "" {
-					t.Errorf("%s ExtractFileDiff('some diff', '') should return empty string, got %q", impl.name, result)
-				}
-			})
-
-			t.Run("CalculateFileLine", func(t *testing.T) {
-				// Test with empty diff
-				line := vcs.CalculateFileLine("", 0)
-				if line != 1 && line != 0 {
-					t.Errorf("%s CalculateFileLine('', 0) should return 1 or 0, got %d", impl.name, line)
-				}
-
-				// Test with out-of-bounds index
-				line = vcs.CalculateFileLine("single line", 10)
-				if line < 0 {
-					t.Errorf("%s CalculateFileLine with out-of-bounds index should not return negative, got %d", impl.name, line)
-				}
-			})
 		})
 	}
 }
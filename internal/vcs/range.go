@@ -0,0 +1,76 @@
+package vcs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Range is the pair of revisions under review: the changes that turn Base
+// into Head. An empty Head stands for the working copy.
+type Range struct {
+	Base string
+	Head string
+
+	// MergeBase holds the left side of an A...B range, whose merge base
+	// with Head was resolved into Base.
+	MergeBase string
+}
+
+// WorkingCopy reports whether the head side is the working copy, the only
+// case in which files can be edited, staged or discarded.
+func (r Range) WorkingCopy() bool {
+	return r.Head == ""
+}
+
+// BaseLabel names the base side for display.
+func (r Range) BaseLabel() string {
+	if r.MergeBase != "" {
+		return r.MergeBase + " (merge base)"
+	}
+	return r.Base
+}
+
+func (r Range) String() string {
+	switch {
+	case r.MergeBase != "":
+		return r.MergeBase + "..." + r.Head
+	case r.Head != "":
+		return r.Base + ".." + r.Head
+	}
+	return r.Base
+}
+
+// ParseRange splits a revision argument into its sides. "A..B" compares two
+// revisions, "A...B" compares B with its merge base with A (symmetric is
+// set), and a single revision is compared with the working copy. An empty
+// side of a range defaults to def.
+func ParseRange(spec, def string) (base, head string, symmetric bool) {
+	if a, b, ok := strings.Cut(spec, "..."); ok {
+		return orDefault(a, def), orDefault(b, def), true
+	}
+	if a, b, ok := strings.Cut(spec, ".."); ok {
+		return orDefault(a, def), orDefault(b, def), false
+	}
+	return orDefault(spec, def), "", false
+}
+
+// ResolveRange parses spec for client, looking up the merge base of an
+// A...B range.
+func ResolveRange(client VCS, spec, def string) (Range, error) {
+	base, head, symmetric := ParseRange(spec, def)
+	if !symmetric {
+		return Range{Base: base, Head: head}, nil
+	}
+	mb, err := client.MergeBase(base, head)
+	if err != nil {
+		return Range{}, fmt.Errorf("no merge base for %s...%s: %w", base, head, err)
+	}
+	return Range{Base: mb, Head: head, MergeBase: base}, nil
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
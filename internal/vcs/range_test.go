@@ -0,0 +1,53 @@
+package vcs
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		spec      string
+		base      string
+		head      string
+		symmetric bool
+	}{
+		{"main", "main", "", false},
+		{"", "HEAD", "", false},
+		{"v1.2..v1.3", "v1.2", "v1.3", false},
+		{"main...feature", "main", "feature", true},
+		{"main..", "main", "HEAD", false},
+		{"..feature", "HEAD", "feature", false},
+		{"...feature", "HEAD", "feature", true},
+	}
+
+	for _, tt := range tests {
+		base, head, symmetric := ParseRange(tt.spec, "HEAD")
+		if base != tt.base || head != tt.head || symmetric != tt.symmetric {
+			t.Errorf("ParseRange(%q) = %q, %q, %v; want %q, %q, %v",
+				tt.spec, base, head, symmetric, tt.base, tt.head, tt.symmetric)
+		}
+	}
+}
+
+func TestRangeLabels(t *testing.T) {
+	tests := []struct {
+		r       Range
+		str     string
+		label   string
+		working bool
+	}{
+		{Range{Base: "main"}, "main", "main", true},
+		{Range{Base: "v1.2", Head: "v1.3"}, "v1.2..v1.3", "v1.2", false},
+		{Range{Base: "abc123", Head: "feature", MergeBase: "main"}, "main...feature", "main (merge base)", false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.r.String(); got != tt.str {
+			t.Errorf("%#v.String() = %q, want %q", tt.r, got, tt.str)
+		}
+		if got := tt.r.BaseLabel(); got != tt.label {
+			t.Errorf("%#v.BaseLabel() = %q, want %q", tt.r, got, tt.label)
+		}
+		if got := tt.r.WorkingCopy(); got != tt.working {
+			t.Errorf("%#v.WorkingCopy() = %v, want %v", tt.r, got, tt.working)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package vcs
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/git"
+)
+
+// Rename records where a renamed or copied file came from.
+type Rename struct {
+	From       string
+	Similarity int  // percent; 0 when the backend does not score renames
+	Copy       bool // From still exists
+}
+
+// RenamesFromDiff returns the renamed and copied files of a diff by their
+// new path.
+func RenamesFromDiff(diffText string) map[string]Rename {
+	renames := make(map[string]Rename)
+	for _, f := range diff.Parse(diffText) {
+		if f.Renamed() || f.Copied {
+			renames[f.NewPath] = Rename{From: f.OldPath, Similarity: f.Similarity, Copy: f.Copied}
+		}
+	}
+	return renames
+}
+
+func (g GitVCS) Renames(r Range) (map[string]Rename, error) {
+	return parseRenames(git.Renames(r.Base, r.Head))
+}
+
+// hg and jj report renames and copies only in the headers of their
+// git-style diffs.
+func (h HgVCS) Renames(r Range) (map[string]Rename, error) { return renamesOf(h.Diff(r)) }
+func (j JjVCS) Renames(r Range) (map[string]Rename, error) { return renamesOf(j.Diff(r)) }
+
+func renamesOf(diffText string, err error) (map[string]Rename, error) {
+	if err != nil {
+		return nil, err
+	}
+	return RenamesFromDiff(diffText), nil
+}
+
+// parseRenames reads the NUL-separated output of git diff --name-status
+// -z restricted to renames and copies: a status with a score, the source
+// and the destination of each file.
+func parseRenames(out string, err error) (map[string]Rename, error) {
+	if err != nil {
+		return nil, err
+	}
+	renames := make(map[string]Rename)
+	fields := strings.Split(out, "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		status := fields[i]
+		if status == "" {
+			continue
+		}
+		score, _ := strconv.Atoi(status[1:])
+		renames[fields[i+2]] = Rename{From: fields[i+1], Similarity: score, Copy: status[0] == 'C'}
+	}
+	return renames, nil
+}
@@ -0,0 +1,49 @@
+package vcs
+
+import "testing"
+
+const copyDiff = `diff --git a/keep.txt b/copy.txt
+similarity index 100%
+copy from keep.txt
+copy to copy.txt
+diff --git a/notes.txt b/notes.txt
+index 3be11c6..f3a5c4e 100644
+--- a/notes.txt
++++ b/notes.txt
+@@ -1 +1 @@
+-a
++b
+`
+
+func TestRenamesFromDiff(t *testing.T) {
+	renames := RenamesFromDiff(reportDiff + copyDiff)
+	if len(renames) != 2 {
+		t.Fatalf("RenamesFromDiff() = %+v, want 2 entries", renames)
+	}
+	if r := renames["new.go"]; r != (Rename{From: "old.go", Similarity: 90}) {
+		t.Errorf("new.go = %+v", r)
+	}
+	if r := renames["copy.txt"]; r != (Rename{From: "keep.txt", Similarity: 100, Copy: true}) {
+		t.Errorf("copy.txt = %+v", r)
+	}
+}
+
+func TestParseRenames(t *testing.T) {
+	out := "R087\x00old.go\x00dir with space/new.go\x00C100\x00keep.txt\x00copy.txt\x00"
+	renames, err := parseRenames(out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renames) != 2 {
+		t.Fatalf("parseRenames() = %+v, want 2 entries", renames)
+	}
+	if r := renames["dir with space/new.go"]; r != (Rename{From: "old.go", Similarity: 87}) {
+		t.Errorf("new.go = %+v", r)
+	}
+	if r := renames["copy.txt"]; r != (Rename{From: "keep.txt", Similarity: 100, Copy: true}) {
+		t.Errorf("copy.txt = %+v", r)
+	}
+	if renames, _ := parseRenames("", nil); len(renames) != 0 {
+		t.Errorf("parseRenames(\"\") = %+v, want none", renames)
+	}
+}
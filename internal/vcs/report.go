@@ -0,0 +1,170 @@
+package vcs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// FileReport describes the change to one file for machine-readable output.
+type FileReport struct {
+	Path    string      `json:"path"`
+	OldPath string      `json:"old_path,omitempty"` // source of a rename or copy
+	Status  string      `json:"status"`             // A, M, D, R, C or ?
+	Added   int         `json:"added"`
+	Deleted int         `json:"deleted"`
+	Binary  bool        `json:"binary"`
+	Hunks   []HunkRange `json:"hunks"`
+}
+
+// HunkRange is the line range of a hunk on both sides of the diff.
+type HunkRange struct {
+	OldStart int `json:"old_start"`
+	OldLines int `json:"old_lines"`
+	NewStart int `json:"new_start"`
+	NewLines int `json:"new_lines"`
+}
+
+// ReportDiff describes every file of a unified diff, sorted by path.
+func ReportDiff(diffText string) []FileReport {
+	var reports []FileReport
+	for _, f := range diff.Parse(diffText) {
+		r := FileReport{Path: f.Path(), Binary: f.Binary, Hunks: []HunkRange{}}
+		switch {
+		case f.NewFile:
+			r.Status = "A"
+		case f.DeletedFile:
+			r.Status = "D"
+		case f.Copied:
+			r.Status = "C"
+			r.OldPath = f.OldPath
+		case f.Renamed():
+			r.Status = "R"
+			r.OldPath = f.OldPath
+		default:
+			r.Status = "M"
+		}
+		r.Added, r.Deleted = f.Stats()
+		for _, h := range f.Hunks {
+			r.Hunks = append(r.Hunks, HunkRange{h.OldStart, h.OldLines, h.NewStart, h.NewLines})
+		}
+		reports = append(reports, r)
+	}
+	sortReports(reports)
+	return reports
+}
+
+// Report describes the changed files of r. Untracked files, which are left
+// out of the diff, are described from their content.
+func Report(client VCS, r Range) ([]FileReport, error) {
+	text, err := client.Diff(r)
+	if err != nil {
+		return nil, err
+	}
+	reports := ReportDiff(text)
+
+	files, err := client.ListChangedFiles(r)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, rep := range reports {
+		seen[rep.Path] = true
+	}
+	var missing []string
+	for _, f := range files {
+		if !seen[f] {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) == 0 {
+		return reports, nil
+	}
+
+	statuses, _ := client.FileStatuses(r)
+	root := client.GetRepoRoot()
+	for _, f := range missing {
+		status := StatusUntracked
+		if s, ok := statuses[f]; ok {
+			status = s
+		}
+		rep := FileReport{Path: f, Status: string(status), Hunks: []HunkRange{}}
+		if content, err := os.ReadFile(filepath.Join(root, f)); err == nil {
+			rep.Binary = bytes.IndexByte(content, 0) >= 0
+			if n := countLines(content); n > 0 && !rep.Binary {
+				rep.Added = n
+				rep.Hunks = append(rep.Hunks, HunkRange{NewStart: 1, NewLines: n})
+			}
+		}
+		reports = append(reports, rep)
+	}
+	sortReports(reports)
+	return reports, nil
+}
+
+// Files returns the diff of every changed file of r. Untracked files, which
+// are left out of the full diff, are diffed one by one.
+func Files(client VCS, r Range) ([]*diff.File, error) {
+	text, err := client.Diff(r)
+	if err != nil {
+		return nil, err
+	}
+	files := diff.Parse(text)
+
+	changed, err := client.ListChangedFiles(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range changed {
+		if diff.Find(files, path) != nil {
+			continue
+		}
+		if msg, ok := client.DiffCmd(r, path, "", DefaultContext)().(DiffMsg); ok {
+			if f := diff.Find(diff.Parse(msg.Content), path); f != nil {
+				files = append(files, f)
+			}
+		}
+	}
+	return files, nil
+}
+
+func sortReports(reports []FileReport) {
+	sort.SliceStable(reports, func(i, j int) bool { return reports[i].Path < reports[j].Path })
+}
+
+func countLines(content []byte) int {
+	n := bytes.Count(content, []byte("\n"))
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// Numstat formats the report like git diff --numstat: added and deleted
+// lines, "-" for binary files, then the path.
+func (f FileReport) Numstat() string {
+	if f.Binary {
+		return "-\t-\t" + f.displayPath()
+	}
+	return fmt.Sprintf("%d\t%d\t%s", f.Added, f.Deleted, f.displayPath())
+}
+
+// NameStatus formats the report like git diff --name-status: the status,
+// then the path, preceded by its source for renames.
+func (f FileReport) NameStatus() string {
+	if f.OldPath != "" {
+		return f.Status + "\t" + f.OldPath + "\t" + f.Path
+	}
+	return f.Status + "\t" + f.Path
+}
+
+func (f FileReport) displayPath() string {
+	if f.OldPath != "" {
+		return f.OldPath + " => " + f.Path
+	}
+	return f.Path
+}
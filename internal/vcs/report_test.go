@@ -0,0 +1,73 @@
+package vcs
+
+import "testing"
+
+const reportDiff = `diff --git a/old.go b/new.go
+similarity index 90%
+rename from old.go
+rename to new.go
+--- a/old.go
++++ b/new.go
+@@ -3,2 +3,2 @@ func f() {
+-	a()
++	b()
+ }
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+--- a/gone.txt
++++ /dev/null
+@@ -1,2 +0,0 @@
+-x
+-y
+diff --git a/logo.png b/logo.png
+new file mode 100644
+Binary files /dev/null and b/logo.png differ
+`
+
+func TestReportDiff(t *testing.T) {
+	reports := ReportDiff(reportDiff)
+	if len(reports) != 3 {
+		t.Fatalf("got %d reports, want 3", len(reports))
+	}
+
+	gone, logo, renamed := reports[0], reports[1], reports[2]
+	if gone.Path != "gone.txt" || gone.Status != "D" || gone.Deleted != 2 {
+		t.Errorf("deleted file: %+v", gone)
+	}
+	if logo.Status != "A" || !logo.Binary || len(logo.Hunks) != 0 {
+		t.Errorf("binary file: %+v", logo)
+	}
+	if renamed.Status != "R" || renamed.OldPath != "old.go" || renamed.Added != 1 || renamed.Deleted != 1 {
+		t.Errorf("renamed file: %+v", renamed)
+	}
+	if want := (HunkRange{3, 2, 3, 2}); len(renamed.Hunks) != 1 || renamed.Hunks[0] != want {
+		t.Errorf("renamed hunks = %+v, want [%+v]", renamed.Hunks, want)
+	}
+}
+
+func TestReportFormats(t *testing.T) {
+	reports := ReportDiff(reportDiff)
+	numstat := []string{"0\t2\tgone.txt", "-\t-\tlogo.png", "1\t1\told.go => new.go"}
+	nameStatus := []string{"D\tgone.txt", "A\tlogo.png", "R\told.go\tnew.go"}
+	for i, r := range reports {
+		if got := r.Numstat(); got != numstat[i] {
+			t.Errorf("Numstat() = %q, want %q", got, numstat[i])
+		}
+		if got := r.NameStatus(); got != nameStatus[i] {
+			t.Errorf("NameStatus() = %q, want %q", got, nameStatus[i])
+		}
+	}
+}
+
+func TestReportCopy(t *testing.T) {
+	reports := ReportDiff(copyDiff)
+	if len(reports) != 2 {
+		t.Fatalf("got %d reports, want 2", len(reports))
+	}
+	if got := reports[0].NameStatus(); got != "C\tkeep.txt\tcopy.txt" {
+		t.Errorf("NameStatus() = %q", got)
+	}
+	if got := reports[1].NameStatus(); got != "M\tnotes.txt" {
+		t.Errorf("NameStatus() = %q", got)
+	}
+}
@@ -0,0 +1,80 @@
+package vcs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oug-t/difi/internal/git"
+)
+
+// Section is a part of the working copy's changes listed on its own by the
+// split view of the tree.
+type Section string
+
+const (
+	SectionStaged    Section = "Staged"    // index against HEAD
+	SectionUnstaged  Section = "Unstaged"  // working tree against the index
+	SectionUntracked Section = "Untracked" // files git does not know about
+)
+
+// Sections lists the sections in the order they are shown.
+var Sections = []Section{SectionStaged, SectionUnstaged, SectionUntracked}
+
+// errNoSections is returned by backends without an index.
+var errNoSections = errors.New("staged and unstaged sections need a git index")
+
+func (g GitVCS) SectionStatuses() (map[Section]map[string]FileStatus, error) {
+	staged, unstaged, untracked, err := git.SectionStatuses()
+	if err != nil {
+		return nil, err
+	}
+	sections := map[Section]map[string]FileStatus{
+		SectionStaged:    make(map[string]FileStatus),
+		SectionUnstaged:  make(map[string]FileStatus),
+		SectionUntracked: make(map[string]FileStatus),
+	}
+	for path, c := range staged {
+		sections[SectionStaged][path] = FileStatus(c)
+	}
+	for path, c := range unstaged {
+		sections[SectionUnstaged][path] = FileStatus(c)
+	}
+	for _, path := range untracked {
+		sections[SectionUntracked][path] = StatusUntracked
+	}
+	return sections, nil
+}
+
+func (g GitVCS) SectionDiffCmd(s Section, path string, context int) tea.Cmd {
+	gitCmd := git.SectionDiffCmd(s == SectionStaged, path, context)
+	return func() tea.Msg {
+		msg := gitCmd()
+		if gitMsg, ok := msg.(git.DiffMsg); ok {
+			return DiffMsg{Content: gitMsg.Content}
+		}
+		return msg
+	}
+}
+
+// SectionFile returns the content of path on the new side of section s:
+// the index for the staged section and the working tree for the others.
+func (g GitVCS) SectionFile(s Section, path string) ([]byte, error) {
+	if s == SectionStaged {
+		return git.ShowIndexFile(path)
+	}
+	return os.ReadFile(filepath.Join(g.GetRepoRoot(), path))
+}
+
+func (h HgVCS) SectionStatuses() (map[Section]map[string]FileStatus, error) {
+	return nil, errNoSections
+}
+func (h HgVCS) SectionDiffCmd(s Section, path string, context int) tea.Cmd { return nil }
+func (h HgVCS) SectionFile(s Section, path string) ([]byte, error)         { return nil, errNoSections }
+
+func (j JjVCS) SectionStatuses() (map[Section]map[string]FileStatus, error) {
+	return nil, errNoSections
+}
+func (j JjVCS) SectionDiffCmd(s Section, path string, context int) tea.Cmd { return nil }
+func (j JjVCS) SectionFile(s Section, path string) ([]byte, error)         { return nil, errNoSections }
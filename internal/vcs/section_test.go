@@ -0,0 +1,116 @@
+package vcs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+func TestGitSections(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer func() {
+		if err := os.Chdir(originalDir); err != nil {
+			t.Errorf("Failed to restore directory: %v", err)
+		}
+	}()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change to temp dir: %v", err)
+	}
+
+	gitRun := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+	}
+	gitRun("init", "-q")
+	writeFile(t, filepath.Join(dir, "a.txt"), "one\ntwo\n")
+	writeFile(t, filepath.Join(dir, "gone.txt"), "x\n")
+	gitRun("add", ".")
+	gitRun("commit", "-q", "-m", "init")
+
+	// a.txt has a staged and an unstaged change.
+	writeFile(t, filepath.Join(dir, "a.txt"), "ONE\ntwo\n")
+	gitRun("add", "a.txt")
+	writeFile(t, filepath.Join(dir, "a.txt"), "ONE\nTWO\n")
+	gitRun("rm", "-q", "gone.txt")
+	writeFile(t, filepath.Join(dir, "new.txt"), "n\n")
+
+	g := GitVCS{}
+	sections, err := g.SectionStatuses()
+	if err != nil {
+		t.Fatalf("SectionStatuses() error = %v", err)
+	}
+	if got := sections[SectionStaged]; len(got) != 2 || got["a.txt"] != StatusModified || got["gone.txt"] != StatusDeleted {
+		t.Errorf("staged = %v", got)
+	}
+	if got := sections[SectionUnstaged]; len(got) != 1 || got["a.txt"] != StatusModified {
+		t.Errorf("unstaged = %v", got)
+	}
+	if got := sections[SectionUntracked]; len(got) != 1 || got["new.txt"] != StatusUntracked {
+		t.Errorf("untracked = %v", got)
+	}
+
+	diffOf := func(s Section, path string) string {
+		msg, _ := g.SectionDiffCmd(s, path, DefaultContext)().(DiffMsg)
+		return diff.StripANSI(msg.Content)
+	}
+	if d := diffOf(SectionStaged, "a.txt"); !strings.Contains(d, "+ONE") || strings.Contains(d, "TWO") {
+		t.Errorf("staged diff of a.txt:\n%s", d)
+	}
+	if d := diffOf(SectionUnstaged, "a.txt"); !strings.Contains(d, "+TWO") || strings.Contains(d, "-one") {
+		t.Errorf("unstaged diff of a.txt:\n%s", d)
+	}
+	if d := diffOf(SectionUntracked, "new.txt"); !strings.Contains(d, "+n") {
+		t.Errorf("untracked diff of new.txt:\n%s", d)
+	}
+
+	// Paths are relative to the top of the working tree, wherever difi runs.
+	writeFile(t, filepath.Join(dir, "sub", "deep.txt"), "deep\n")
+	if err := os.Chdir(filepath.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	if d := diffOf(SectionUntracked, "sub/deep.txt"); !strings.Contains(d, "+deep") {
+		t.Errorf("untracked diff of sub/deep.txt from sub:\n%s", d)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	fileOf := func(s Section, path string) string {
+		content, err := g.SectionFile(s, path)
+		if err != nil {
+			t.Fatalf("SectionFile(%s, %s) error = %v", s, path, err)
+		}
+		return string(content)
+	}
+	if got := fileOf(SectionStaged, "a.txt"); got != "ONE\ntwo\n" {
+		t.Errorf("staged a.txt = %q", got)
+	}
+	if got := fileOf(SectionUnstaged, "a.txt"); got != "ONE\nTWO\n" {
+		t.Errorf("unstaged a.txt = %q", got)
+	}
+}
+
+func TestSectionsWithoutIndex(t *testing.T) {
+	for _, client := range []VCS{HgVCS{}, JjVCS{}} {
+		if _, err := client.SectionStatuses(); err == nil {
+			t.Errorf("%T.SectionStatuses() should fail", client)
+		}
+		if _, err := client.SectionFile(SectionStaged, "a.txt"); err == nil {
+			t.Errorf("%T.SectionFile() should fail", client)
+		}
+	}
+}
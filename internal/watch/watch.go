@@ -0,0 +1,30 @@
+// Package watch reports changes to the files of a working copy so the UI can
+// refresh without being restarted.
+package watch
+
+import "errors"
+
+var (
+	// ErrUnsupported is returned by New on platforms without a watcher.
+	ErrUnsupported = errors.New("file watching is not supported on this platform")
+
+	// ErrClosed is returned by Wait once the watcher is closed.
+	ErrClosed = errors.New("watcher closed")
+)
+
+// IgnoreFunc reports which of dirs, given relative to the watched root,
+// are ignored by the version control system and so left unwatched: build
+// output and dependency trees change often and can be large enough to use
+// up the available watches.
+type IgnoreFunc func(dirs []string) map[string]bool
+
+// skipDir reports whether a directory is left unwatched. Repository metadata
+// changes whenever difi itself queries the VCS, so watching it would make
+// every refresh trigger the next one.
+func skipDir(name string) bool {
+	switch name {
+	case ".git", ".hg", ".jj":
+		return true
+	}
+	return false
+}
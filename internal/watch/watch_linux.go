@@ -0,0 +1,202 @@
+//go:build linux
+
+package watch
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ONLYDIR
+
+// pollTimeout bounds how long the reader blocks before checking for Close.
+const pollTimeout = 500 // milliseconds
+
+// Watcher watches a directory tree with inotify. Directories created after
+// New are watched as they appear.
+type Watcher struct {
+	fd       int
+	root     string
+	debounce time.Duration
+	ignored  IgnoreFunc
+
+	mu   sync.Mutex
+	dirs map[int]string // watch descriptor to directory
+
+	changes   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New starts watching root and every directory below it that ignored does
+// not report; a nil ignored watches them all. Changes are coalesced until
+// none arrived for the debounce interval.
+func New(root string, debounce time.Duration, ignored IgnoreFunc) (*Watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		fd:       fd,
+		root:     root,
+		debounce: debounce,
+		ignored:  ignored,
+		dirs:     make(map[int]string),
+		changes:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	w.addTree(root)
+	go w.read()
+	return w, nil
+}
+
+// Wait blocks until files change, then until no further change arrives for
+// the debounce interval.
+func (w *Watcher) Wait() error {
+	select {
+	case <-w.changes:
+	case <-w.done:
+		return ErrClosed
+	}
+
+	timer := time.NewTimer(w.debounce)
+	defer timer.Stop()
+	for {
+		select {
+		case <-w.changes:
+			timer.Reset(w.debounce)
+		case <-timer.C:
+			return nil
+		case <-w.done:
+			return ErrClosed
+		}
+	}
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() { close(w.done) })
+	return nil
+}
+
+// addTree watches dir and the directories below it, level by level so the
+// ignored ones are looked up in one batch per level. Running out of inotify
+// watches leaves the rest of the tree unwatched.
+func (w *Watcher) addTree(dir string) {
+	for level := []string{dir}; len(level) > 0; {
+		var subdirs []string
+		for _, d := range level {
+			wd, err := unix.InotifyAddWatch(w.fd, d, watchMask)
+			if err == unix.ENOSPC {
+				return
+			}
+			if err != nil {
+				continue
+			}
+			w.mu.Lock()
+			w.dirs[wd] = d
+			w.mu.Unlock()
+
+			entries, _ := os.ReadDir(d)
+			for _, e := range entries {
+				if e.IsDir() && !skipDir(e.Name()) {
+					subdirs = append(subdirs, filepath.Join(d, e.Name()))
+				}
+			}
+		}
+		level = w.unignored(subdirs)
+	}
+}
+
+// unignored returns the directories of dirs that are not ignored.
+func (w *Watcher) unignored(dirs []string) []string {
+	if w.ignored == nil || len(dirs) == 0 {
+		return dirs
+	}
+	rel := make([]string, len(dirs))
+	for i, dir := range dirs {
+		rel[i], _ = filepath.Rel(w.root, dir)
+	}
+	ignored := w.ignored(rel)
+	var kept []string
+	for i, dir := range dirs {
+		if !ignored[rel[i]] {
+			kept = append(kept, dir)
+		}
+	}
+	return kept
+}
+
+func (w *Watcher) read() {
+	defer unix.Close(w.fd)
+
+	buf := make([]byte, 64*1024)
+	fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+	for {
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+
+		n, err := unix.Poll(fds, pollTimeout)
+		if err == unix.EINTR || n == 0 {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		n, err = unix.Read(w.fd, buf)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if w.handle(buf[:n]) {
+			select {
+			case w.changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// handle processes a batch of inotify events, watching new directories,
+// and reports whether any of them is a change worth refreshing for.
+func (w *Watcher) handle(buf []byte) bool {
+	changed := false
+	for off := 0; off+unix.SizeofInotifyEvent <= len(buf); {
+		ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+		nameStart := off + unix.SizeofInotifyEvent
+		name := string(bytes.TrimRight(buf[nameStart:nameStart+int(ev.Len)], "\x00"))
+		off = nameStart + int(ev.Len)
+
+		w.mu.Lock()
+		dir := w.dirs[int(ev.Wd)]
+		if ev.Mask&unix.IN_IGNORED != 0 {
+			delete(w.dirs, int(ev.Wd))
+		}
+		w.mu.Unlock()
+
+		if name == "" || skipDir(name) {
+			continue
+		}
+		if ev.Mask&unix.IN_ISDIR != 0 && ev.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 && dir != "" {
+			path := filepath.Join(dir, name)
+			if len(w.unignored([]string{path})) == 0 {
+				continue
+			}
+			w.addTree(path)
+		}
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,131 @@
+//go:build linux
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testDebounce = 20 * time.Millisecond
+
+// waitFor runs Wait and fails the test unless it returns within a second.
+func waitFor(t *testing.T, w *Watcher) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- w.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait() did not report the change")
+	}
+}
+
+// expectQuiet fails the test if a change is reported within a short while.
+func expectQuiet(t *testing.T, w *Watcher) {
+	t.Helper()
+	select {
+	case <-w.changes:
+		t.Fatal("unexpected change reported")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWatcherReportsChanges(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := New(root, testDebounce, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer w.Close()
+
+	if err := os.WriteFile(filepath.Join(root, "sub", "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, w)
+
+	// Directories created while watching are picked up too.
+	nested := filepath.Join(root, "new", "deeper")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, w)
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(nested, "b.txt"), []byte("b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, w)
+}
+
+func TestWatcherSkipsRepositoryMetadata(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := New(root, testDebounce, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer w.Close()
+
+	if err := os.WriteFile(filepath.Join(root, ".git", "index"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectQuiet(t, w)
+}
+
+func TestWatcherSkipsIgnored(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "node_modules", "pkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	ignored := func(dirs []string) map[string]bool {
+		m := make(map[string]bool)
+		for _, dir := range dirs {
+			m[dir] = dir == "node_modules" || dir == "build"
+		}
+		return m
+	}
+
+	w, err := New(root, testDebounce, ignored)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer w.Close()
+
+	if err := os.WriteFile(filepath.Join(root, "node_modules", "pkg", "index.js"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectQuiet(t, w)
+
+	// Ignored directories created while watching are left alone too.
+	if err := os.MkdirAll(filepath.Join(root, "build", "out"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	expectQuiet(t, w)
+	if err := os.WriteFile(filepath.Join(root, "build", "out", "a.o"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectQuiet(t, w)
+}
+
+func TestWatcherClose(t *testing.T) {
+	w, err := New(t.TempDir(), testDebounce, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	w.Close()
+	if err := w.Wait(); err != ErrClosed {
+		t.Errorf("Wait() after Close = %v, want ErrClosed", err)
+	}
+}
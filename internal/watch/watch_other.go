@@ -0,0 +1,19 @@
+//go:build !linux
+
+package watch
+
+import "time"
+
+// Watcher is unavailable on this platform; New always fails.
+type Watcher struct{}
+
+// New reports ErrUnsupported.
+func New(root string, debounce time.Duration, ignored IgnoreFunc) (*Watcher, error) {
+	return nil, ErrUnsupported
+}
+
+// Wait reports ErrUnsupported.
+func (w *Watcher) Wait() error { return ErrUnsupported }
+
+// Close does nothing.
+func (w *Watcher) Close() error { return nil }